@@ -67,6 +67,7 @@ type Analyzer struct {
 
 	levels    [][]*analyzerNode
 	litmaps   []map[string]int
+	typmaps   []map[int]int
 	nodeCount []int
 
 	mu sync.RWMutex
@@ -126,6 +127,10 @@ func (this *Analyzer) Analyze(seq Sequence) (Sequence, error) {
 	this.mu.RLock()
 	defer this.mu.RUnlock()
 
+	// The trailer of a multi-line message is too different from message to message
+	// to be part of a pattern
+	seq, _ = seq.withoutTrailer()
+
 	path, err := this.analyzeMessage(seq)
 	if err != nil {
 		return nil, err
@@ -135,6 +140,7 @@ func (this *Analyzer) Analyze(seq Sequence) (Sequence, error) {
 
 	for i, n := range path {
 		n.Token.Value, n.Token.IsKey, n.Token.IsValue = seq[i].Value, seq[i].IsKey, seq[i].IsValue
+		n.Token.Start, n.Token.End, n.Token.Original = seq[i].Start, seq[i].End, seq[i].Original
 		seq2 = append(seq2, n.Token)
 	}
 
@@ -148,21 +154,10 @@ func (this *Analyzer) Add(seq Sequence) error {
 	this.mu.Lock()
 	defer this.mu.Unlock()
 
-	// Add enough levels to support the depth of the token list
-	if l := len(seq) + 1 - len(this.levels); l > 0 {
-		newlevels := make([][]*analyzerNode, l)
-		// the maps are used to hash literals to see if they exist
-		newmaps := make([]map[string]int, l)
-
-		for i := 0; i < l; i++ {
-			newlevels[i] = make([]*analyzerNode, minFixedChildren)
-			newlevels[i][0] = this.leaf
-			newmaps[i] = make(map[string]int)
-		}
+	seq, _ = seq.withoutTrailer()
 
-		this.levels = append(this.levels, newlevels...)
-		this.litmaps = append(this.litmaps, newmaps...)
-	}
+	// Add enough levels to support the depth of the token list
+	this.grow(len(seq) + 1)
 
 	var (
 		parent, foundNode *analyzerNode = this.root, nil
@@ -175,27 +170,13 @@ func (this *Analyzer) Add(seq Sequence) error {
 		case token.Field != FieldUnknown:
 			// if Field is not FieldUnknown, it means the Field is one of the recognized
 			// field type. In this case, we just add it to the list of field types.
-
-			if foundNode = this.levels[i][int(token.Field)]; foundNode == nil {
-				foundNode = newAnalyzerNode()
-				foundNode.Token = token
-				foundNode.level = i
-				foundNode.index = int(token.Field)
-				this.levels[i][foundNode.index] = foundNode
-			}
+			foundNode = this.typeNode(i, token)
 
 		case token.Type != TokenUnknown && token.Type != TokenLiteral:
 			// If this is a known token type but it's not a literal, it means this
 			// token could contain different values. In this case, we add it to the
 			// list of token types.
-
-			if foundNode = this.levels[i][numFieldTypes+int(token.Type)]; foundNode == nil {
-				foundNode = newAnalyzerNode()
-				foundNode.Token = token
-				foundNode.level = i
-				foundNode.index = numFieldTypes + int(token.Type)
-				this.levels[i][foundNode.index] = foundNode
-			}
+			foundNode = this.typeNode(i, token)
 
 		case token.Field == FieldUnknown && token.Type == TokenLiteral:
 			// if the field type is unknown, and the token type is literal, that
@@ -244,6 +225,211 @@ func (this *Analyzer) Add(seq Sequence) error {
 	return nil
 }
 
+// typeNode returns the node at level i for the field type of token, or for its
+// token type if it has no field type, creating it if it does not exist yet. The
+// builtin types have a fixed node in each level. The registered types are added
+// to the end of the level, like the literals, and tracked in the type map.
+func (this *Analyzer) typeNode(i int, token Token) *analyzerNode {
+	j, k := typeIndex(token)
+
+	if j < 0 {
+		if idx, ok := this.typmaps[i][k]; ok {
+			return this.levels[i][idx]
+		}
+	} else if this.levels[i][j] != nil {
+		return this.levels[i][j]
+	}
+
+	node := newAnalyzerNode()
+	node.Token = token
+	node.level = i
+
+	if j < 0 {
+		this.levels[i] = append(this.levels[i], node)
+		node.index = len(this.levels[i]) - 1
+		this.typmaps[i][k] = node.index
+	} else {
+		node.index = j
+		this.levels[i][j] = node
+	}
+
+	return node
+}
+
+// typeIndex returns the index of the fixed node for the type of token, or -1 if
+// it's a registered type, and the key of the type in the type maps.
+func typeIndex(token Token) (int, int) {
+	if token.Field != FieldUnknown {
+		if token.Field >= field__END__ {
+			return -1, int(token.Field)
+		}
+
+		return int(token.Field), int(token.Field)
+	}
+
+	if token.Type >= token__END__ {
+		return -1, maxFieldTypes + int(token.Type)
+	}
+
+	return numFieldTypes + int(token.Type), maxFieldTypes + int(token.Type)
+}
+
+// isTypeNode returns true if the node at index j of its level is a field or token
+// type node, rather than a literal or a string merged from literals.
+func isTypeNode(j int, node *analyzerNode) bool {
+	return j < minFixedChildren || node.Field != FieldUnknown ||
+		(node.Type != TokenLiteral && node.Type != TokenString)
+}
+
+// grow adds enough levels so the tree has at least n levels.
+func (this *Analyzer) grow(n int) {
+	if l := n - len(this.levels); l > 0 {
+		newlevels := make([][]*analyzerNode, l)
+		// the maps are used to hash literals and registered types to see if they exist
+		newmaps := make([]map[string]int, l)
+		newtypmaps := make([]map[int]int, l)
+
+		for i := 0; i < l; i++ {
+			newlevels[i] = make([]*analyzerNode, minFixedChildren)
+			newlevels[i][0] = this.leaf
+			newmaps[i] = make(map[string]int)
+			newtypmaps[i] = make(map[int]int)
+		}
+
+		this.levels = append(this.levels, newlevels...)
+		this.litmaps = append(this.litmaps, newmaps...)
+		this.typmaps = append(this.typmaps, newtypmaps...)
+	}
+}
+
+// Merge adds all the message sequences that have been added to the other analyzer
+// into this analyzer, as if they were added to this one. This way, analyzers that
+// are built separately, e.g., on different hosts or different days, can be combined
+// to find the patterns for all of the messages. The other analyzer can be finalized
+// or not, but Finalize should be called after all the analyzers are merged.
+func (this *Analyzer) Merge(other *Analyzer) error {
+	if this == other {
+		return nil
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	other.mu.RLock()
+	defer other.mu.RUnlock()
+
+	this.mergeFrom(other, minFixedChildren)
+
+	return nil
+}
+
+// mergeFrom merges the nodes from the other analyzer into this analyzer. The first
+// fixed nodes of each level in other are the builtin field and token type nodes,
+// and the rest are the registered types, literals and strings.
+func (this *Analyzer) mergeFrom(other *Analyzer, fixed int) {
+	this.grow(len(other.levels))
+
+	// idx[i][j] is the index in this analyzer of the jth node at level i of other,
+	// or -1 if there's no such node. The 0th node of each level is always the leaf.
+	idx := make([][]int, len(other.levels))
+
+	for i, level := range other.levels {
+		idx[i] = make([]int, len(level))
+
+		for j, node := range level {
+			switch {
+			case j == 0:
+				idx[i][j] = 0
+
+			case node == nil:
+				idx[i][j] = -1
+
+			default:
+				idx[i][j] = this.mergeNode(i, node, j < fixed).index
+			}
+		}
+	}
+
+	// Now that all the nodes exist in this analyzer, we can add the parent and
+	// children relationships of the nodes in other.
+	for i, level := range other.levels {
+		for j, node := range level {
+			if j == 0 || node == nil {
+				continue
+			}
+
+			cur := this.levels[i][idx[i][j]]
+			cur.leafNode = cur.leafNode || node.leafNode
+
+			for k, e := node.parents.NextSet(0); e; k, e = node.parents.NextSet(k + 1) {
+				if i == 0 {
+					cur.parents.Set(0)
+				} else if p := mergeIndex(idx[i-1], k); p >= 0 {
+					cur.parents.Set(uint(p))
+				}
+			}
+
+			for k, e := node.children.NextSet(0); e; k, e = node.children.NextSet(k + 1) {
+				if k == 0 {
+					cur.children.Set(0)
+				} else if i < len(idx)-1 {
+					if c := mergeIndex(idx[i+1], k); c >= 0 {
+						cur.children.Set(uint(c))
+					}
+				}
+			}
+		}
+	}
+
+	if len(idx) > 0 {
+		for k, e := other.root.children.NextSet(0); e; k, e = other.root.children.NextSet(k + 1) {
+			if c := mergeIndex(idx[0], k); c > 0 {
+				this.root.children.Set(uint(c))
+			}
+		}
+	}
+}
+
+// mergeNode returns the node at level i in this analyzer that is the same as the
+// node supplied, creating it if it does not exist yet. Literals are looked up by
+// their values, and strings, which are merged literals, are always added as new
+// nodes so Finalize can merge them again.
+func (this *Analyzer) mergeNode(i int, node *analyzerNode, fixed bool) *analyzerNode {
+	switch {
+	case fixed || isTypeNode(minFixedChildren, node):
+		return this.typeNode(i, node.Token)
+
+	case node.Type == TokenLiteral:
+		if k, ok := this.litmaps[i][node.Value]; ok {
+			return this.levels[i][k]
+		}
+	}
+
+	found := newAnalyzerNode()
+	found.Token = node.Token
+	found.level = i
+	found.isKey = node.isKey
+	found.isValue = node.isValue
+
+	this.levels[i] = append(this.levels[i], found)
+	found.index = len(this.levels[i]) - 1
+
+	if found.Type == TokenLiteral {
+		this.litmaps[i][found.Value] = found.index
+	}
+
+	return found
+}
+
+// mergeIndex returns idx[k], or -1 if k is out of range.
+func mergeIndex(idx []int, k uint) int {
+	if k >= uint(len(idx)) {
+		return -1
+	}
+
+	return idx[k]
+}
+
 // Finalize will go through the analysis tree and determine which tokens share common
 // parent and child, merge all the nodes that share at least 1 parent and 1 child,
 // and finally compact the tree and remove all dead nodes.
@@ -273,7 +459,11 @@ func (this *Analyzer) merge() error {
 			//   be merged, so let's move on.
 			// - If the node is a single character literal, then it shouldn't be merged,
 			//   so let's move on.
-			if cur == nil || (cur.Type == TokenLiteral && len(cur.Value) == 1) || cur.isKey {
+			// - If the node is a registered field or token type, then it's already a
+			//   variable, so let's move on.
+			if cur == nil || (cur.Type == TokenLiteral && len(cur.Value) == 1) || cur.isKey ||
+				isTypeNode(j, cur) {
+
 				continue
 			}
 
@@ -397,8 +587,7 @@ func (this *Analyzer) getMergeSet(i, j int, cur *analyzerNode) (*bitset.BitSet,
 		// - We only merge nodes that are literals or strings, anything else
 		//   is already a variable so move on
 		// - If node is a single character literal, then not merging, move on
-		if tmp == nil ||
-			(tmp.Type != TokenLiteral && tmp.Type != TokenString) ||
+		if tmp == nil || isTypeNode(k+j+1, tmp) ||
 			(tmp.Type == TokenLiteral && len(tmp.Value) == 1) {
 
 			continue
@@ -438,13 +627,15 @@ func (this *Analyzer) compact() error {
 	// Each level has a hash map of literals that points to the literal's
 	// index position in the level slice
 	newmaps := make([]map[string]int, len(this.litmaps))
+	newtypmaps := make([]map[int]int, len(this.typmaps))
 	for i := 0; i < len(newmaps); i++ {
 		newmaps[i] = make(map[string]int)
+		newtypmaps[i] = make(map[int]int)
 	}
 
 	this.nodeCount = make([]int, len(this.levels))
 
-	// Copy all the fixed children (leaf, TokenNames, FieldTokenMap) into the slice
+	// Copy all the fixed children (leaf, field types, token types) into the slice
 	// Copy any non-nil children into the slice
 	// Fix the index for all the children
 	// Add any literals to the hash
@@ -459,6 +650,9 @@ func (this *Analyzer) compact() error {
 
 					if cur.Type == TokenLiteral {
 						newmaps[i][cur.Value] = cur.index
+					} else if j >= minFixedChildren && isTypeNode(j, cur) {
+						_, k := typeIndex(cur.Token)
+						newtypmaps[i][k] = cur.index
 					}
 				}
 			}
@@ -503,6 +697,7 @@ func (this *Analyzer) compact() error {
 
 	this.levels = newLevels
 	this.litmaps = newmaps
+	this.typmaps = newtypmaps
 
 	return nil
 }
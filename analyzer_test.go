@@ -249,3 +249,105 @@ func TestAnalyzerMatchPatterns(t *testing.T) {
 		assert.Equal(t, true, analyzerSshdPatterns[i], seq.String())
 	}
 }
+
+func TestAnalyzerMerge(t *testing.T) {
+	a1, a2 := NewAnalyzer(), NewAnalyzer()
+	msg := &message{}
+
+	for i, data := range append(analyzerSshdSamples, analyzerKeyValueSamples...) {
+		msg.data = data
+		err := msg.tokenize()
+		assert.NoError(t, true, err)
+
+		// Neither analyzer has seen enough messages to find the patterns alone
+		if i%2 == 0 {
+			a1.Add(msg.tokens)
+		} else {
+			a2.Add(msg.tokens)
+		}
+	}
+
+	// Merging works with both finalized and non-finalized analyzers
+	a1.Finalize()
+
+	atree := NewAnalyzer()
+	assert.NoError(t, true, atree.Merge(a1))
+	assert.NoError(t, true, atree.Merge(a2))
+	atree.Finalize()
+
+	checkAnalyzerPatterns(t, atree)
+}
+
+func TestAnalyzerMarshalBinary(t *testing.T) {
+	a1, a2 := NewAnalyzer(), NewAnalyzer()
+	msg := &message{}
+
+	for i, data := range append(analyzerSshdSamples, analyzerKeyValueSamples...) {
+		msg.data = data
+		err := msg.tokenize()
+		assert.NoError(t, true, err)
+
+		if i%2 == 0 {
+			a1.Add(msg.tokens)
+		} else {
+			a2.Add(msg.tokens)
+		}
+	}
+
+	a2.Finalize()
+
+	atree := NewAnalyzer()
+
+	for _, a := range []*Analyzer{a1, a2} {
+		data, err := a.MarshalBinary()
+		assert.NoError(t, true, err)
+
+		saved := NewAnalyzer()
+		assert.NoError(t, true, saved.UnmarshalBinary(data))
+		assert.NoError(t, true, atree.Merge(saved))
+
+		// The saved analyzer is the same as the original
+		data2, err := saved.MarshalBinary()
+		assert.NoError(t, true, err)
+		assert.Equal(t, true, data, data2)
+
+		assert.Equal(t, true, ErrAnalyzerCorrupt, saved.UnmarshalBinary(data[:len(data)-1]))
+	}
+
+	atree.Finalize()
+
+	checkAnalyzerPatterns(t, atree)
+
+	data, err := atree.MarshalBinary()
+	assert.NoError(t, true, err)
+
+	saved := NewAnalyzer()
+	assert.NoError(t, true, saved.UnmarshalBinary(data))
+
+	checkAnalyzerPatterns(t, saved)
+
+	assert.Equal(t, true, ErrNotAnalyzer, saved.UnmarshalBinary([]byte(parserMagic)))
+	assert.Equal(t, true, ErrAnalyzerVersion, saved.UnmarshalBinary(append([]byte(analyzerMagic), byte(analyzerVersion+1))))
+}
+
+func checkAnalyzerPatterns(t *testing.T, atree *Analyzer) {
+	msg := &message{}
+
+	for i, data := range analyzerSshdSamples {
+		msg.data = data
+		err := msg.tokenize()
+		assert.NoError(t, true, err)
+		seq, err := atree.Analyze(msg.tokens)
+		assert.NoError(t, true, err)
+		assert.Equal(t, true, analyzerSshdPatterns[i], seq.String())
+	}
+
+	for i, data := range analyzerKeyValueSamples {
+		msg.data = data
+		err := msg.tokenize()
+		assert.NoError(t, true, err)
+		seq, err := atree.Analyze(msg.tokens)
+		assert.NoError(t, true, err)
+		assert.Equal(t, true, analyzerKeyValuePatterns[i], seq.String())
+	}
+}
@@ -0,0 +1,520 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidCEF  = errors.New("sequence: invalid CEF message")
+	ErrInvalidLEEF = errors.New("sequence: invalid LEEF message")
+)
+
+// CEFTimeFormats are the formats of the CEF and LEEF time stamps, such as rt and
+// devTime, that are not in TimeFormats, e.g., "Oct 11 2023 22:14:15". They are only
+// recognized in CEF and LEEF messages, so that the same text in other messages is
+// scanned as it always was.
+var CEFTimeFormats []string = []string{
+	"Jan _2 2006 15:04:05",
+	"Jan _2 2006 15:04:05.000",
+}
+
+// cefScanner is the Scanner CEFMessage.Sequence uses if it's given none.
+var cefScanner = newCEFScanner()
+
+func newCEFScanner() *Scanner {
+	scanner, err := NewScannerWithOptions(ScannerOptions{TimeFormats: CEFTimeFormats})
+	if err != nil {
+		panic(err)
+	}
+
+	return scanner
+}
+
+// CEFFields maps the extension keys of CEF and LEEF messages to field types. The
+// keys are in lower case. Both the short and the full CEF key names are included,
+// e.g., src and sourceaddress. Keys can be added before messages are decoded, e.g.,
+// CEFFields["cs1"] = FieldPolicyID.
+var CEFFields map[string]FieldType = map[string]FieldType{
+	// CEF
+	"src":                          FieldSrcIPv4,
+	"sourceaddress":                FieldSrcIPv4,
+	"dst":                          FieldDstIPv4,
+	"destinationaddress":           FieldDstIPv4,
+	"spt":                          FieldSrcPort,
+	"sourceport":                   FieldSrcPort,
+	"dpt":                          FieldDstPort,
+	"destinationport":              FieldDstPort,
+	"suser":                        FieldSrcUser,
+	"sourceusername":               FieldSrcUser,
+	"duser":                        FieldDstUser,
+	"destinationusername":          FieldDstUser,
+	"shost":                        FieldSrcHost,
+	"sourcehostname":               FieldSrcHost,
+	"dhost":                        FieldDstHost,
+	"destinationhostname":          FieldDstHost,
+	"smac":                         FieldSrcMac,
+	"sourcemacaddress":             FieldSrcMac,
+	"dmac":                         FieldDstMac,
+	"destinationmacaddress":        FieldDstMac,
+	"sntdom":                       FieldSrcDomain,
+	"sourcentdomain":               FieldSrcDomain,
+	"dntdom":                       FieldDstDomain,
+	"destinationntdomain":          FieldDstDomain,
+	"sourcetranslatedaddress":      FieldSrcIPv4NAT,
+	"destinationtranslatedaddress": FieldDstIPv4NAT,
+	"sourcetranslatedport":         FieldSrcPortNAT,
+	"destinationtranslatedport":    FieldDstPortNAT,
+	"proto":                        FieldProtocol,
+	"transportprotocol":            FieldProtocol,
+	"act":                          FieldAction,
+	"deviceaction":                 FieldAction,
+	"outcome":                      FieldStatus,
+	"eventoutcome":                 FieldStatus,
+	"reason":                       FieldReason,
+	"in":                           FieldBytesRecv,
+	"bytesin":                      FieldBytesRecv,
+	"out":                          FieldBytesSent,
+	"bytesout":                     FieldBytesSent,
+	"deviceinboundinterface":       FieldInIface,
+	"deviceoutboundinterface":      FieldOutIface,
+	"start":                        FieldCreateTime,
+	"starttime":                    FieldCreateTime,
+	"rt":                           FieldRecvTime,
+	"devicereceipttime":            FieldRecvTime,
+	"cat":                          FieldMsgClass,
+	"deviceeventcategory":          FieldMsgClass,
+	"dvc":                          FieldAppIPv4,
+	"deviceaddress":                FieldAppIPv4,
+	"dvchost":                      FieldAppHost,
+	"devicehostname":               FieldAppHost,
+
+	// LEEF, where it differs from CEF
+	"srcport":        FieldSrcPort,
+	"dstport":        FieldDstPort,
+	"usrname":        FieldSrcUser,
+	"srcmac":         FieldSrcMac,
+	"dstmac":         FieldDstMac,
+	"srcpostnat":     FieldSrcIPv4NAT,
+	"dstpostnat":     FieldDstIPv4NAT,
+	"srcpostnatport": FieldSrcPortNAT,
+	"dstpostnatport": FieldDstPortNAT,
+	"srcbytes":       FieldBytesSent,
+	"dstbytes":       FieldBytesRecv,
+	"srcpackets":     FieldPktsSent,
+	"dstpackets":     FieldPktsRecv,
+	"sev":            FieldSeverity,
+	"devtime":        FieldCreateTime,
+}
+
+// CEFMessage is a message decoded from either the ArcSight Common Event Format
+// (CEF), e.g.,
+//
+//   CEF:0|Security|threatmanager|1.0|100|worm successfully stopped|10|src=10.0.0.1 dst=2.1.2.2 spt=1232
+//
+// or the IBM Log Event Extended Format (LEEF), e.g.,
+//
+//   LEEF:1.0|Microsoft|MSExchange|4.0 SP1|15345|src=192.0.2.0	dst=172.50.123.1	sev=5
+//
+// The header and extension values are unescaped, i.e., \| is |, \= is =, \\ is \,
+// and \n and \r are the new line and carriage return characters.
+type CEFMessage struct {
+	// Format is either "CEF" or "LEEF".
+	Format  string
+	Version string
+
+	Vendor         string
+	Product        string
+	ProductVersion string
+
+	// EventClassID is the Device Event Class ID of CEF, or the EventID of LEEF.
+	EventClassID string
+
+	// Name and Severity are only in the CEF header. The severity of LEEF messages
+	// is the sev extension key.
+	Name     string
+	Severity string
+
+	// Extension is the key=value pairs that follow the header, in the order they
+	// appear in the message.
+	Extension []CEFExtension
+
+	// HeaderOffsets are the start and end byte offsets of the header values in the
+	// message, from Version to Severity for CEF, or to EventClassID for LEEF. The
+	// offsets are of the escaped values, e.g., HeaderOffsets[1] is the Vendor.
+	HeaderOffsets [][2]int
+}
+
+// CEFExtension is a key=value pair in the extension of a CEF or LEEF message.
+type CEFExtension struct {
+	Key   string
+	Value string
+
+	// KeyStart is the byte offset of the key in the message, and Start and End are
+	// the byte offsets of the escaped value. End is the offset of the first byte
+	// after the value.
+	KeyStart, Start, End int
+}
+
+// ParseCEF decodes the CEF message in data. Anything before "CEF:", such as a
+// syslog header, is skipped. The extension is a list of space separated key=value
+// pairs, where the values can contain spaces, so a value ends where the next key
+// starts.
+func ParseCEF(data string) (*CEFMessage, error) {
+	i := strings.Index(data, "CEF:")
+	if i < 0 {
+		return nil, ErrInvalidCEF
+	}
+
+	header, offsets, rest, ok := cefHeader(data, i+4, 7)
+	if !ok {
+		return nil, ErrInvalidCEF
+	}
+
+	msg := &CEFMessage{
+		Format:         "CEF",
+		Version:        header[0],
+		Vendor:         header[1],
+		Product:        header[2],
+		ProductVersion: header[3],
+		EventClassID:   header[4],
+		Name:           header[5],
+		Severity:       header[6],
+		Extension:      cefExtension(data, rest, ""),
+		HeaderOffsets:  offsets,
+	}
+
+	return msg, nil
+}
+
+// ParseLEEF decodes the LEEF message in data. Anything before "LEEF:", such as a
+// syslog header, is skipped. The extension is a list of key=value pairs separated
+// by tabs, or for LEEF 2.0, by the delimiter in the header, e.g., ^ or x5E. If the
+// extension has no delimiters, the pairs are separated by spaces as in CEF.
+func ParseLEEF(data string) (*CEFMessage, error) {
+	i := strings.Index(data, "LEEF:")
+	if i < 0 {
+		return nil, ErrInvalidLEEF
+	}
+
+	header, offsets, rest, ok := cefHeader(data, i+5, 5)
+	if !ok {
+		return nil, ErrInvalidLEEF
+	}
+
+	msg := &CEFMessage{
+		Format:         "LEEF",
+		Version:        header[0],
+		Vendor:         header[1],
+		Product:        header[2],
+		ProductVersion: header[3],
+		EventClassID:   header[4],
+		HeaderOffsets:  offsets,
+	}
+
+	delim := "\t"
+
+	if strings.HasPrefix(msg.Version, "2") {
+		if d, _, r, ok := cefHeader(data, rest, 1); ok {
+			if v, ok := leefDelimiter(d[0]); ok {
+				delim, rest = v, r
+			}
+		}
+	}
+
+	msg.Extension = cefExtension(data, rest, delim)
+
+	for _, ext := range msg.Extension {
+		if ext.Key == "sev" {
+			msg.Severity = ext.Value
+		}
+	}
+
+	return msg, nil
+}
+
+// Sequence returns the message as a Sequence of key = value tokens, the same tokens
+// the Scanner returns for key=value pairs. The header values come first, with the
+// keys deviceVendor, deviceProduct, deviceVersion, deviceEventClassId, name and
+// severity, followed by the extension. The values are typed and lowercased as they
+// are by the scanner, using its time formats and epoch window. If scanner is nil, a
+// Scanner that also recognizes the CEFTimeFormats is used, so the times are converted
+// by Scanner.Extract of a Scanner with the same formats, e.g., the one returned by
+// NewScannerWithOptions(ScannerOptions{TimeFormats: CEFTimeFormats}). The unescaped values are kept as the Original
+// values, and the Start and End of each token are its offsets in the message. The
+// header keys and the = after them are not in the message, so their tokens are
+// empty at the start of the header value.
+//
+// The product is FieldAppType, the event class ID is FieldMsgType and the severity
+// is FieldSeverity. The extension values are given the field types of their keys
+// in CEFFields. Address keys with IPv6 values, such as src and dst, are given the
+// IPv6 field types instead, e.g., FieldSrcIPv6.
+func (this *CEFMessage) Sequence(scanner *Scanner) Sequence {
+	var seq Sequence
+
+	if scanner == nil {
+		scanner = cefScanner
+	}
+
+	msg := &message{timeFsm: scanner.timeFsm, epoch: scanner.epoch, kv: scanner.kv}
+
+	epoch := scanner.epoch
+	if epoch == nil {
+		epoch = defaultEpochWindow
+	}
+
+	add := func(key, value string, field FieldType, keyStart, start, end int) {
+		token := msg.valueToken(value, start, end)
+
+		if field != FieldUnknown {
+			switch {
+			case field == FieldSrcIPv4 && token.Type == TokenIPv6:
+				field = FieldSrcIPv6
+
+			case field == FieldDstIPv4 && token.Type == TokenIPv6:
+				field = FieldDstIPv6
+
+			case field.TokenType() == TokenTime && (token.Type == TokenInteger || token.Type == TokenFloat):
+				// Epoch times, e.g., rt=1697040000000, are only recognized for time fields
+				if _, ok := epoch.time(value); ok {
+					token.Type = TokenTime
+				}
+			}
+
+			token.Field = field
+		}
+
+		// The = is right before the value, and the key is at keyStart, unless it's
+		// a header key, which is not in the message
+		key1, key2, eq := keyStart, keyStart+len(key), start-1
+		if keyStart < 0 {
+			key1, key2, eq = start, start, start
+		}
+
+		seq = append(seq,
+			Token{Type: TokenLiteral, Field: FieldUnknown, Value: strings.ToLower(key), IsKey: true,
+				Start: key1, End: key2, Original: key},
+			Token{Type: TokenLiteral, Field: FieldUnknown, Value: "=", Start: eq, End: start, Original: "="},
+			token)
+	}
+
+	for i, h := range []struct {
+		k string
+		v string
+		f FieldType
+	}{
+		{"deviceVendor", this.Vendor, FieldUnknown},
+		{"deviceProduct", this.Product, FieldAppType},
+		{"deviceVersion", this.ProductVersion, FieldUnknown},
+		{"deviceEventClassId", this.EventClassID, FieldMsgType},
+		{"name", this.Name, FieldUnknown},
+		{"severity", this.Severity, FieldSeverity},
+	} {
+		// The severity of LEEF messages is already in the extension
+		if h.v != "" && (h.k != "severity" || this.Format == "CEF") {
+			var start, end int
+			if i+1 < len(this.HeaderOffsets) {
+				start, end = this.HeaderOffsets[i+1][0], this.HeaderOffsets[i+1][1]
+			}
+
+			add(h.k, h.v, h.f, -1, start, end)
+		}
+	}
+
+	for _, ext := range this.Extension {
+		add(ext.Key, ext.Value, CEFFields[strings.ToLower(ext.Key)], ext.KeyStart, ext.Start, ext.End)
+	}
+
+	return seq
+}
+
+// cefHeader returns the first n header values in data, starting at offset start,
+// which are each terminated by an unescaped |, their offsets in data, and the offset
+// of the rest of data after them. It returns false if there are fewer than n header
+// values.
+func cefHeader(data string, start, n int) ([]string, [][2]int, int, bool) {
+	header := make([]string, 0, n)
+	offsets := make([][2]int, 0, n)
+
+	for i := start; i < len(data) && len(header) < n; i++ {
+		switch data[i] {
+		case '\\':
+			i++
+
+		case '|':
+			header = append(header, cefUnescape(data[start:i]))
+			offsets = append(offsets, [2]int{start, i})
+			start = i + 1
+		}
+	}
+
+	if len(header) < n {
+		return nil, nil, 0, false
+	}
+
+	return header, offsets, start, true
+}
+
+// cefExtension returns the key=value pairs in data, starting at offset start, which
+// are separated by delim, or by spaces if delim is empty or is not in data.
+func cefExtension(data string, start int, delim string) []CEFExtension {
+	var ext []CEFExtension
+
+	if delim != "" && strings.Contains(data[start:], delim) {
+		for start <= len(data) {
+			end := strings.Index(data[start:], delim)
+			if end < 0 {
+				end = len(data)
+			} else {
+				end += start
+			}
+
+			if i := cefEquals(data[:end], start); i > start {
+				k := start + len(data[start:i]) - len(strings.TrimLeft(data[start:i], " "))
+				ext = append(ext, CEFExtension{strings.TrimSpace(data[k:i]), cefUnescape(data[i+1 : end]), k, i + 1, end})
+			}
+
+			start = end + len(delim)
+		}
+
+		return ext
+	}
+
+	// A value ends before the key of the next pair, which is the word before the
+	// next unescaped =
+	vstart := -1
+
+	for i := cefEquals(data, start); i >= 0; i = cefEquals(data, i+1) {
+		j := i
+		for j > start && data[j-1] != ' ' {
+			j--
+		}
+
+		if j == i || j < vstart || !cefKey(data[j:i]) {
+			// Not a key, so the = is part of the value
+			continue
+		}
+
+		if vstart >= 0 {
+			ext[len(ext)-1].setValue(data, vstart, j)
+		}
+
+		ext = append(ext, CEFExtension{Key: data[j:i], KeyStart: j})
+		vstart = i + 1
+	}
+
+	if vstart >= 0 {
+		ext[len(ext)-1].setValue(data, vstart, len(data))
+	}
+
+	return ext
+}
+
+// setValue sets the value of the pair to data[start:end], without the spaces that
+// separate it from the next pair.
+func (this *CEFExtension) setValue(data string, start, end int) {
+	end = start + len(strings.TrimRight(data[start:end], " "))
+	this.Value, this.Start, this.End = cefUnescape(data[start:end]), start, end
+}
+
+// cefEquals returns the index of the first unescaped = in data at or after i, or -1
+// if there is none.
+func cefEquals(data string, i int) int {
+	for ; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++
+
+		case '=':
+			return i
+		}
+	}
+
+	return -1
+}
+
+// cefKey returns true if k is a valid extension key, which is made up of letters,
+// digits, underscores and dots.
+func cefKey(k string) bool {
+	for i := 0; i < len(k); i++ {
+		if !isWordByte(k[i]) && k[i] != '.' {
+			return false
+		}
+	}
+
+	return len(k) > 0
+}
+
+// cefUnescape returns v with the escaped characters unescaped.
+func cefUnescape(v string) string {
+	if strings.IndexByte(v, '\\') < 0 {
+		return v
+	}
+
+	buf := make([]byte, 0, len(v))
+
+	for i := 0; i < len(v); i++ {
+		if v[i] != '\\' || i == len(v)-1 {
+			buf = append(buf, v[i])
+			continue
+		}
+
+		i++
+
+		switch v[i] {
+		case 'n':
+			buf = append(buf, '\n')
+
+		case 'r':
+			buf = append(buf, '\r')
+
+		default:
+			buf = append(buf, v[i])
+		}
+	}
+
+	return string(buf)
+}
+
+// leefDelimiter returns the delimiter of a LEEF 2.0 header, which is either a
+// single character, or its code in hex, e.g., x5E or 0x5E.
+func leefDelimiter(d string) (string, bool) {
+	if len(d) == 1 {
+		return d, true
+	}
+
+	h := strings.ToLower(d)
+
+	switch {
+	case strings.HasPrefix(h, "0x"):
+		h = h[2:]
+
+	case strings.HasPrefix(h, "x"):
+		h = h[1:]
+
+	default:
+		return "", false
+	}
+
+	c, err := strconv.ParseUint(h, 16, 8)
+	if err != nil || c == 0 {
+		return "", false
+	}
+
+	return string(rune(c)), true
+}
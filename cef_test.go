@@ -0,0 +1,177 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dataence/assert"
+)
+
+var (
+	cefSamples map[string]CEFMessage = map[string]CEFMessage{
+		`CEF:0|Security|threatmanager|1.0|100|worm successfully stopped|10|src=10.0.0.1 dst=2.1.2.2 spt=1232`: CEFMessage{
+			Format: "CEF", Version: "0", Vendor: "Security", Product: "threatmanager", ProductVersion: "1.0",
+			EventClassID: "100", Name: "worm successfully stopped", Severity: "10",
+			Extension: []CEFExtension{{Key: "src", Value: "10.0.0.1"}, {Key: "dst", Value: "2.1.2.2"}, {Key: "spt", Value: "1232"}},
+		},
+		`<134>Oct 11 22:14:15 host CEF:0|Acme|Fire\|Wall|2.1|deny|Blocked \\ traffic|High|suser=John Doe msg=rule\=42 matched path=C:\\Temp`: CEFMessage{
+			Format: "CEF", Version: "0", Vendor: "Acme", Product: "Fire|Wall", ProductVersion: "2.1",
+			EventClassID: "deny", Name: `Blocked \ traffic`, Severity: "High",
+			Extension: []CEFExtension{{Key: "suser", Value: "John Doe"}, {Key: "msg", Value: "rule=42 matched"}, {Key: "path", Value: `C:\Temp`}},
+		},
+		`CEF:0|Vendor|Product|1|id|name|3|`: CEFMessage{
+			Format: "CEF", Version: "0", Vendor: "Vendor", Product: "Product", ProductVersion: "1",
+			EventClassID: "id", Name: "name", Severity: "3",
+		},
+		"LEEF:1.0|Microsoft|MSExchange|4.0 SP1|15345|src=192.0.2.0\tdst=172.50.123.1\tsev=5\tusrName=Joe Bloggs": CEFMessage{
+			Format: "LEEF", Version: "1.0", Vendor: "Microsoft", Product: "MSExchange", ProductVersion: "4.0 SP1",
+			EventClassID: "15345", Severity: "5",
+			Extension: []CEFExtension{{Key: "src", Value: "192.0.2.0"}, {Key: "dst", Value: "172.50.123.1"}, {Key: "sev", Value: "5"}, {Key: "usrName", Value: "Joe Bloggs"}},
+		},
+		"LEEF:2.0|Lancope|StealthWatch|1.0|41|^|src=10.0.1.8^dst=10.0.0.5^srcPort=81": CEFMessage{
+			Format: "LEEF", Version: "2.0", Vendor: "Lancope", Product: "StealthWatch", ProductVersion: "1.0",
+			EventClassID: "41",
+			Extension:    []CEFExtension{{Key: "src", Value: "10.0.1.8"}, {Key: "dst", Value: "10.0.0.5"}, {Key: "srcPort", Value: "81"}},
+		},
+		"LEEF:2.0|Lancope|StealthWatch|1.0|41|x7C|src=10.0.1.8|dst=10.0.0.5": CEFMessage{
+			Format: "LEEF", Version: "2.0", Vendor: "Lancope", Product: "StealthWatch", ProductVersion: "1.0",
+			EventClassID: "41",
+			Extension:    []CEFExtension{{Key: "src", Value: "10.0.1.8"}, {Key: "dst", Value: "10.0.0.5"}},
+		},
+	}
+)
+
+func TestParseCEF(t *testing.T) {
+	for data, expected := range cefSamples {
+		var (
+			msg *CEFMessage
+			err error
+		)
+
+		if expected.Format == "CEF" {
+			msg, err = ParseCEF(data)
+		} else {
+			msg, err = ParseLEEF(data)
+		}
+
+		assert.NoError(t, true, err, data)
+
+		// The offsets are of the escaped values in the message
+		header := []string{msg.Version, msg.Vendor, msg.Product, msg.ProductVersion, msg.EventClassID, msg.Name, msg.Severity}
+		for i, o := range msg.HeaderOffsets {
+			assert.Equal(t, true, header[i], cefUnescape(data[o[0]:o[1]]), data)
+		}
+
+		for i, ext := range msg.Extension {
+			assert.Equal(t, true, ext.Key, data[ext.KeyStart:ext.KeyStart+len(ext.Key)], data)
+			assert.Equal(t, true, "=", data[ext.Start-1:ext.Start], data)
+			assert.Equal(t, true, ext.Value, cefUnescape(data[ext.Start:ext.End]), data)
+			msg.Extension[i].KeyStart, msg.Extension[i].Start, msg.Extension[i].End = 0, 0, 0
+		}
+
+		msg.HeaderOffsets = nil
+		assert.Equal(t, true, expected, *msg, data)
+	}
+
+	for _, data := range []string{"CEF:0|Vendor|Product|1|id|name", "Jan 12 06:49:42 irc sshd[7034]: x"} {
+		_, err := ParseCEF(data)
+		assert.Equal(t, true, ErrInvalidCEF, err, data)
+	}
+
+	_, err := ParseLEEF("LEEF:1.0|Vendor|Product")
+	assert.Equal(t, true, ErrInvalidLEEF, err)
+}
+
+func TestCEFSequence(t *testing.T) {
+	data := `CEF:0|Security|ThreatManager|1.0|100|worm stopped|10|src=10.0.0.1 dst=2001:db8::1 spt=1232 dpt=22 suser=JDoe rt=1697040000000 cs1=x`
+
+	msg, err := ParseCEF(data)
+	assert.NoError(t, true, err)
+
+	seq := msg.Sequence(nil)
+	assert.Equal(t, true, "devicevendor", seq[0].Value)
+	assert.Equal(t, true, true, seq[0].IsKey)
+	assert.Equal(t, true, "=", seq[1].Value)
+	assert.Equal(t, true, "security", seq[2].Value)
+	assert.Equal(t, true, "Security", seq[2].Original)
+	assert.Equal(t, true, true, seq[2].IsValue)
+
+	// Each token is where it is in the message, and the header keys are empty at the
+	// start of their values
+	assert.Equal(t, true, "Security", data[seq[2].Start:seq[2].End])
+	assert.Equal(t, true, seq[2].Start, seq[0].Start)
+	assert.Equal(t, true, seq[2].Start, seq[1].End)
+
+	for _, token := range seq[18:] {
+		assert.Equal(t, true, token.Original, data[token.Start:token.End])
+	}
+
+	rec := seq.Original().Extract()
+	assert.Equal(t, true, "ThreatManager", rec.Get(FieldAppType))
+	assert.Equal(t, true, int64(100), rec.Get(FieldMsgType))
+	assert.Equal(t, true, int64(10), rec.Get(FieldSeverity))
+	assert.Equal(t, true, net.ParseIP("10.0.0.1"), rec.Get(FieldSrcIPv4))
+	assert.Equal(t, true, net.ParseIP("2001:db8::1"), rec.Get(FieldDstIPv6))
+	assert.Nil(t, true, rec.Get(FieldDstIPv4))
+	assert.Equal(t, true, int64(1232), rec.Get(FieldSrcPort))
+	assert.Equal(t, true, int64(22), rec.Get(FieldDstPort))
+	assert.Equal(t, true, "JDoe", rec.Get(FieldSrcUser))
+	assert.Equal(t, true, time.Date(2023, time.October, 11, 16, 0, 0, 0, time.UTC), rec.Get(FieldRecvTime))
+
+	// The severity of LEEF messages is only in the extension
+	msg, err = ParseLEEF("LEEF:1.0|Microsoft|MSExchange|4.0 SP1|15345|sev=5\tdevTime=Oct 11 2023 22:14:15")
+	assert.NoError(t, true, err)
+
+	leef, err := NewScannerWithOptions(ScannerOptions{TimeFormats: CEFTimeFormats})
+	assert.NoError(t, true, err)
+
+	seq = msg.Sequence(nil)
+	assert.Equal(t, true, TokenTime, seq[len(seq)-1].Type)
+
+	rec = leef.Extract(seq)
+	assert.Equal(t, true, 1, len(rec[FieldSeverity]))
+	assert.Equal(t, true, 22, rec.Get(FieldCreateTime).(time.Time).Hour())
+
+	// The CEF time formats are only recognized in CEF and LEEF messages
+	seq, err = NewScanner().Scan("Oct 11 2023 22:14:15 host")
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, "oct %integer% %integer% %integer% : %integer% : %integer% host", seq.String())
+
+	// The values are typed by the scanner supplied, using its time formats, epoch
+	// window and location
+	est := time.FixedZone("EST", -5*3600)
+
+	scanner, err := NewScannerWithOptions(ScannerOptions{
+		TimeFormats: []string{"02-Jan-2006 15:04:05.000"},
+		Location:    est,
+		EpochTimes:  true,
+		EpochStart:  time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+	})
+	assert.NoError(t, true, err)
+
+	msg, err = ParseCEF(`CEF:0|Acme|Fire|2.1|deny|Blocked|3|start=11-Oct-2023 22:14:15.123 rt=1697040000000 end=1717200000`)
+	assert.NoError(t, true, err)
+
+	seq = msg.Sequence(scanner)
+	assert.Equal(t, true, TokenTime, seq[20].Type)
+	assert.Equal(t, true, TokenInteger, seq[23].Type)
+
+	rec = scanner.Extract(seq)
+	assert.Equal(t, true, time.Date(2023, time.October, 11, 22, 14, 15, 123e6, est), rec.Get(FieldCreateTime))
+	assert.Equal(t, true, int64(1697040000000), rec.Get(FieldRecvTime))
+}
@@ -0,0 +1,172 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"time"
+)
+
+// followTail is the number of bytes at the end of what has been read that the
+// follower keeps, to tell if the file has been truncated and then refilled.
+const followTail = 64
+
+// follower is an io.Reader that tails a file, similar to tail -F. It starts reading
+// at the end of the file, and when it reaches the end of the file, it waits for more
+// data to be appended. If the file is renamed or removed and then recreated, e.g.,
+// by logrotate, it finishes reading the old file and then reopens the file by name.
+// If the file is truncated, it starts reading from the beginning of the file again.
+// A file that's truncated and then refilled past where it was read is also read from
+// the beginning, since the bytes that were read last are no longer where they were.
+type follower struct {
+	fname    string
+	file     *os.File
+	offset   int64
+	modTime  time.Time
+	tail     []byte
+	interval time.Duration
+}
+
+func newFollower(fname string, interval time.Duration) (*follower, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	tail, err := readTail(f, offset)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return &follower{
+		fname:    fname,
+		file:     f,
+		offset:   offset,
+		modTime:  fi.ModTime(),
+		tail:     tail,
+		interval: interval,
+	}, nil
+}
+
+// Read reads from the file being followed. It blocks until there's data to read.
+func (this *follower) Read(p []byte) (int, error) {
+	for {
+		n, err := this.file.Read(p)
+		this.offset += int64(n)
+
+		if n > 0 {
+			this.tail = append(this.tail, p[:n]...)
+			if len(this.tail) > followTail {
+				this.tail = append(this.tail[:0], this.tail[len(this.tail)-followTail:]...)
+			}
+
+			return n, nil
+		}
+
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		// We are at the end of the file, so wait for more data, and check to see if
+		// the file has been rotated or truncated before reading it.
+		time.Sleep(this.interval)
+		this.reopen()
+	}
+}
+
+func (this *follower) Close() error {
+	return this.file.Close()
+}
+
+// reopen checks to see if the file has been rotated or truncated, and if so, reopens
+// or rewinds it, so the next read starts at the beginning of the new data.
+func (this *follower) reopen() {
+	cur, err := this.file.Stat()
+	if err != nil {
+		return
+	}
+
+	modified := !cur.ModTime().Equal(this.modTime)
+	this.modTime = cur.ModTime()
+
+	if cur.Size() < this.offset || ((modified || cur.Size() > this.offset) && this.rewritten()) {
+		// The file has been truncated, so start from the beginning again.
+		if _, err := this.file.Seek(0, io.SeekStart); err == nil {
+			this.offset, this.tail = 0, this.tail[:0]
+		}
+
+		return
+	}
+
+	if cur.Size() > this.offset {
+		// There's more data to read, even if the file has been rotated.
+		return
+	}
+
+	fi, err := os.Stat(this.fname)
+	if err != nil || os.SameFile(fi, cur) {
+		// The file has been removed and not yet recreated, or it's still the same
+		// file, keep waiting.
+		return
+	}
+
+	// The file has been rotated, and since we have read the old file till the end,
+	// we can now switch to the new file and read it from the beginning.
+	f, err := os.Open(this.fname)
+	if err != nil {
+		return
+	}
+
+	this.file.Close()
+	this.file = f
+	this.offset, this.modTime, this.tail = 0, fi.ModTime(), this.tail[:0]
+}
+
+// rewritten returns true if the bytes that were read last are no longer at the end of
+// what has been read, i.e., the file has been truncated and then written again.
+func (this *follower) rewritten() bool {
+	tail, err := readTail(this.file, this.offset)
+	return err == nil && !bytes.Equal(tail, this.tail)
+}
+
+// readTail returns the bytes of the file before offset, up to followTail bytes.
+func readTail(f *os.File, offset int64) ([]byte, error) {
+	n := offset
+	if n > followTail {
+		n = followTail
+	}
+
+	tail := make([]byte, n)
+	if _, err := f.ReadAt(tail, offset-n); err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return tail, nil
+}
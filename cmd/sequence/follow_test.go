@@ -0,0 +1,147 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dataence/assert"
+)
+
+// followTest is a file being followed, and the data read from it by a goroutine,
+// since Read blocks until there's data to read.
+type followTest struct {
+	t     *testing.T
+	fname string
+	data  chan string
+}
+
+func newFollowTest(t *testing.T, initial string) (*followTest, func()) {
+	dir, err := ioutil.TempDir("", "sequence")
+	assert.NoError(t, true, err)
+
+	fname := filepath.Join(dir, "follow.log")
+	assert.NoError(t, true, ioutil.WriteFile(fname, []byte(initial), 0644))
+
+	f, err := newFollower(fname, 10*time.Millisecond)
+	assert.NoError(t, true, err)
+
+	data := make(chan string, 100)
+
+	go func() {
+		buf := make([]byte, 1024)
+
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				return
+			}
+
+			data <- string(buf[:n])
+		}
+	}()
+
+	return &followTest{t, fname, data}, func() {
+		f.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+// write writes data to the file, and truncates it first if trunc is true.
+func (this *followTest) write(data string, trunc bool) {
+	flags := os.O_WRONLY | os.O_APPEND
+	if trunc {
+		flags |= os.O_TRUNC
+	}
+
+	f, err := os.OpenFile(this.fname, flags, 0644)
+	assert.NoError(this.t, true, err)
+
+	_, err = f.WriteString(data)
+	assert.NoError(this.t, true, err)
+	assert.NoError(this.t, true, f.Close())
+}
+
+// read returns the next len(expected) bytes read by the follower.
+func (this *followTest) read(expected string) {
+	var got string
+
+	for len(got) < len(expected) {
+		select {
+		case d := <-this.data:
+			got += d
+
+		case <-time.After(5 * time.Second):
+			this.t.Fatalf("Timeout waiting for %q, got %q", expected, got)
+		}
+	}
+
+	assert.Equal(this.t, true, expected, got)
+}
+
+func TestFollowerAppend(t *testing.T) {
+	ft, done := newFollowTest(t, "old line\n")
+	defer done()
+
+	// The follower starts at the end of the file
+	ft.write("first line\n", false)
+	ft.read("first line\n")
+
+	ft.write("second line\n", false)
+	ft.read("second line\n")
+}
+
+func TestFollowerRename(t *testing.T) {
+	ft, done := newFollowTest(t, "")
+	defer done()
+
+	ft.write("before rotation\n", false)
+	ft.read("before rotation\n")
+
+	// The rest of the old file is read before the new file
+	ft.write("end of old file\n", false)
+	assert.NoError(t, true, os.Rename(ft.fname, ft.fname+".1"))
+	assert.NoError(t, true, ioutil.WriteFile(ft.fname, []byte("start of new file\n"), 0644))
+
+	ft.read("end of old file\nstart of new file\n")
+
+	ft.write("after rotation\n", false)
+	ft.read("after rotation\n")
+}
+
+func TestFollowerTruncate(t *testing.T) {
+	ft, done := newFollowTest(t, "")
+	defer done()
+
+	ft.write("a line before truncation\n", false)
+	ft.read("a line before truncation\n")
+
+	// Truncated to a shorter file
+	ft.write("short\n", true)
+	ft.read("short\n")
+
+	// Truncated and refilled past where the file was read, so only the size is not
+	// enough to tell it was truncated
+	ft.write("a much longer line, written after truncation\n", true)
+	ft.read("a much longer line, written after truncation\n")
+
+	// Truncated and refilled to the same size
+	ft.write("a much longer line, WRITTEN after truncation\n", true)
+	ft.read("a much longer line, WRITTEN after truncation\n")
+}
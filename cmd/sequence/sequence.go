@@ -30,6 +30,10 @@
 //      analyze                   analyze will analyze a log file and output a list of patterns that will match all the log messages
 //      parse                     parse will parse a log file and output a list of parsed tokens for each of the log messages
 //      bench                     benchmark the parsing of a log file, no output is provided
+//      test                      test will check that the example messages in the pattern files parse to their own patterns
+//      lint                      lint will find patterns that are duplicates of, or conflict with, other patterns
+//      compile                   compile will build the parser from the pattern files and save it, so it can be loaded quickly
+//      serve-syslog              serve-syslog will receive syslog messages over the network and output the parsed messages
 //      help [command]            Help about any command
 //
 // ### Scan
@@ -74,11 +78,17 @@
 //     sequence analyze [flags]
 //
 //    Available Flags:
+//     -b, --begin="": regular expression that matches the first line of each message, other lines are joined to it
+//     -c, --confidence=0.5: minimum confidence of the inferred field types, between 0 and 1
 //     -h, --help=false: help for analyze
-//     -i, --infile="": input file, required
+//     -n, --infer=false: annotate the new patterns with inferred field types
+//     -i, --infile="": input file, if empty or -, from stdin
+//     -j, --join="": join continuation lines to their messages, comma separated list of indent (indented lines) and time (lines without a time stamp)
+//     -l, --load="": comma separated list of saved analyzers to merge before analyzing
 //     -o, --outfile="": output file, if empty, to stdout
 //     -d, --patdir="": pattern directory,, all files in directory will be used, optional
 //     -p, --patfile="": initial pattern file, optional
+//     -s, --save="": file to save the analyzer to after analyzing, so it can be merged later
 //
 // The following command analyzes a set of sshd log messages, and output the
 // patterns to the sshd.pat file. In this example, `sequence` analyzed over 200K
@@ -106,14 +116,42 @@
 //   %createtime% %apphost% %appname% [ %sessionid% ] : %string% ( sshd : %string% ) : %object% %action% for user %dstuser% by ( uid = %integer% )
 //   # Jan 15 19:39:26 jlz sshd[7778]: pam_unix(sshd:session): session opened for user jlz by (uid=0)
 //
+// The analyzer can also be saved after analyzing, and merged into a later run, so the
+// patterns can be discovered incrementally, e.g., by a nightly job, or across several
+// hosts. The following commands save the analysis of each day, and find the patterns
+// for the messages of the last day, based on all three days.
+//
+//   $ ./sequence analyze -i mon.log -s mon.seqa -o mon.pat
+//   $ ./sequence analyze -i tue.log -s tue.seqa -o tue.pat
+//   $ ./sequence analyze -i wed.log -l mon.seqa,tue.seqa -s week.seqa -o week.pat
+//
+// The analyzer only knows the token types of the new patterns, so the patterns have
+// to be annotated with field types by hand before they are useful for parsing. With
+// -n, the analyzer infers the field types from the neighbouring keywords, such as
+// "from %ipv4% port %integer%" or "src=%ipv4%", and uses the ones with at least the
+// confidence given by -c. Each annotated pattern is preceded by a comment listing the
+// inferred field types, so they can be reviewed.
+//
+//   $ ./sequence analyze -i ../../data/sshd.all -n -c 0.6 -o sshd.pat
+//
+// And the output file has entries such as:
+//
+//   # inferred: %createtime% 0.90 (syslog header), %apphost% 0.80 (syslog header), %appname% 0.80 (syslog header), %sessionid% 0.80 (syslog header), %dstuser% 0.60 (for %string% from), %srcipv4% 0.80 (from %ipv4%), %srcport% 0.80 (port after %srcipv4%)
+//   %createtime% %apphost% %appname% [ %sessionid% ] : failed password for %dstuser% from %srcipv4% port %srcport% ssh2
+//   # Jan 12 06:49:29 host2 sshd[7029]: Failed password for dave from 10.0.2.29 port 4029 ssh2
+//
 // ### Parse
 //
 //   Usage:
 //     sequence parse [flags]
 //
 //    Available Flags:
+//     -b, --begin="": regular expression that matches the first line of each message, other lines are joined to it
+//     -F, --follow=false: follow the input file as it grows, across renames and truncation
+//     -f, --format="text": output format, one of text, json or ndjson
 //     -h, --help=false: help for parse
-//     -i, --infile="": input file, required
+//     -i, --infile="": input file, if empty or -, from stdin
+//     -j, --join="": join continuation lines to their messages, comma separated list of indent (indented lines) and time (lines without a time stamp)
 //     -o, --outfile="": output file, if empty, to stdout
 //     -d, --patdir="": pattern directory,, all files in directory will be used
 //     -p, --patfile="": initial pattern file, required
@@ -154,15 +192,34 @@
 //   #  23: { Field="%funknown%", Type="%integer%", Value="0" }
 //   #  24: { Field="%funknown%", Type="%literal%", Value=")" }
 //
+// With -f ndjson, each parsed message is written as a single line JSON object that
+// contains the original message, the matched pattern, and the extracted fields keyed
+// by the field names without the percent signs. If a field appears more than once in
+// the message, its value is a list. With -f json, the objects are written as a single
+// JSON array.
+//
+//   $ ./sequence parse -d ../../patterns -i ../../data/sshd.all -f ndjson
+//   {"message":"Jan 15 19:39:26 jlz sshd[7778]: pam_unix(sshd:session): session opened for user jlz by (uid=0)","pattern":{"id":"ded4d4801a377137","pattern":"%createtime% %apphost% %appname% [ %sessionid% ] : %string% ( sshd : %string% ) : %object% %action% for user %dstuser% by ( uid = %integer% )"},"fields":{"action":"opened","apphost":"jlz","appname":"sshd","createtime":"2026-01-15T19:39:26Z","dstuser":"jlz","object":"session","sessionid":7778}}
+//
+// The input is read from stdin if -i is not supplied or is -. To run sequence parse
+// as a long-lived process, use -F to follow a log file as it grows. Like tail -F, it
+// starts at the end of the file, and keeps following the file when it's renamed and
+// recreated (e.g., by logrotate) or truncated.
+//
+//   $ tail -F /var/log/auth.log | ./sequence parse -d ../../patterns -f ndjson
+//   $ ./sequence parse -d ../../patterns -i /var/log/auth.log -F -f ndjson
+//
 // ### Benchmark
 //
 //   Usage:
 //     sequence bench [flags]
 //
 //    Available Flags:
+//     -b, --begin="": regular expression that matches the first line of each message, other lines are joined to it
 //     -c, --cpuprofile="": CPU profile filename
 //     -h, --help=false: help for bench
-//     -i, --infile="": input file, required
+//     -i, --infile="": input file, if empty or -, from stdin
+//     -j, --join="": join continuation lines to their messages, comma separated list of indent (indented lines) and time (lines without a time stamp)
 //     -d, --patdir="": pattern directory,, all files in directory will be used
 //     -p, --patfile="": pattern file, required
 //     -w, --workers=1: number of parsing workers
@@ -184,19 +241,131 @@
 //
 //   $ GOMAXPROCS=2 ./sequence bench -p ../../patterns/asa.txt -i ../../data/allasa.log -w 2
 //   Parsed 234815 messages in 2.51 secs, ~ 93614.09 msgs/sec
+//
+// ### Test
+//
+//   Usage:
+//     sequence test [flags]
+//
+//    Available Flags:
+//     -h, --help=false: help for test
+//     -d, --patdir="": pattern directory,, all files in directory will be tested
+//     -p, --patfile="": pattern file to test
+//
+// The following command checks the examples in a pattern file, which are the comments
+// that immediately follow each pattern. Each example that does not parse to its own
+// pattern is reported, along with a word diff between the expected pattern and the
+// pattern that was matched instead. The command exits with a non-zero status if any
+// of the examples failed.
+//
+//   $ ./sequence test -p sshd.txt
+//   --- FAIL: sshd.txt
+//       example: Jan 12 06:49:45 irc sshd[7037]: Connection closed by 10.1.1.2
+//       expected: %createtime% %apphost% %appname% [ %sessionid% ] : connection closed by %srchost% (sshd-closed-host)
+//       matched: %createtime% %apphost% %appname% [ %sessionid% ] : connection closed by %srcipv4% (c1f4d29f72253096)
+//       diff: %createtime% %apphost% %appname% [ %sessionid% ] : connection closed by [-%srchost%-] {+%srcipv4%+}
+//
+//   2014/12/29 10:21:45 Tested 2 examples of 2 patterns, 1 failed.
+//
+// ### Lint
+//
+//   Usage:
+//     sequence lint [flags]
+//
+//    Available Flags:
+//     -h, --help=false: help for lint
+//     -d, --patdir="": pattern directory,, all files in directory will be linted together
+//     -p, --patfile="": pattern file to lint
+//
+// The following command checks the patterns for problems. The parser returns the best
+// scoring pattern when a message matches more than one, so patterns that overlap may
+// not match the messages they were written for. The lint command reports patterns
+// that are duplicates, differ only by punctuation, match the same messages with the
+// same score, can never win against another pattern, or have a %string% that always
+// loses to a literal in another pattern. It also reports patterns, in any of the
+// files, that have the same ID as a different pattern, which the parser rejects. The
+// command exits with a non-zero status if any issues are found.
+//
+//   $ ./sequence lint -d ../../patterns
+//   --- ../../patterns/sshd.txt
+//   near-duplicate: pattern differs from another pattern only by punctuation
+//       %createtime% %apphost% %appname% [ %sessionid% ] : failed password for invalid user %dstuser% from %srcipv4% port %srcport% ssh2 (aecad880f4be0074)
+//       %createtime% %apphost% %appname% [ %sessionid% ] : failed password for invalid user %dstuser% , from %srcipv4% port %srcport% ssh2 (93906e66d51f4948)
+//
+//   2014/12/29 10:21:45 Linted 84 patterns, found 4 issues.
+//
+// ### Compile
+//
+//   Usage:
+//     sequence compile [flags]
+//
+//    Available Flags:
+//     -h, --help=false: help for compile
+//     -o, --outfile="": output file, if empty, to stdout
+//     -d, --patdir="": pattern directory,, all files in directory will be compiled
+//     -p, --patfile="": pattern file to compile
+//
+// The following command builds the parser from the pattern files, and saves the parse
+// tree, including the pattern information, to a compiled parser file. Loading the
+// compiled parser is much faster than scanning all the patterns again, and the file
+// can be distributed instead of the pattern files. The compiled parser can be used
+// anywhere a pattern file is accepted using --patfile. Any patterns in --patdir are
+// added to the compiled parser after it's loaded.
+//
+//   $ ./sequence compile -d ../../patterns -o patterns.seqp
+//   2014/12/29 10:21:45 Compiled parser is 91735 bytes.
+//
+//   $ ./sequence parse -p patterns.seqp -i ../../data/sshd.all -o parsed.sshd
+//
+// ### Serve Syslog
+//
+//    Usage:
+//      sequence serve-syslog [flags]
+//
+//    Available Flags:
+//     -f, --format="ndjson": output format, one of text or ndjson
+//     -h, --help=false: help for serve-syslog
+//     -o, --outfile="": output file, if empty, to stdout
+//     -d, --patdir="": pattern directory,, all files in directory will be used
+//     -p, --patfile="": initial pattern file, required
+//     -r, --reload=false: reload the patterns when the pattern files change
+//     -t, --tcp="": TCP address to listen on, e.g., :514
+//     -u, --udp="": UDP address to listen on, e.g., :514
+//     -x, --unix="": unix domain socket to listen on, e.g., /dev/log
+//
+// The serve-syslog command receives RFC 3164 and RFC 5424 syslog messages over UDP,
+// TCP or a unix domain socket, and parses the message body of each using the
+// patterns. The syslog header fields, e.g., %apphost% and %appname%, are added to the
+// parsed fields, so the patterns should only describe the message body. TCP streams
+// may use either newline or octet-counting framing. The command runs until it's
+// interrupted.
+//
+// With -r, the pattern file and directory are checked for changes every second, and
+// the patterns are reloaded in the background when they change. Messages are never
+// held up by the reload. If any of the pattern files is invalid, the error is logged
+// and the current patterns are kept.
+//
+//   $ ./sequence serve-syslog -u :5514 -t :5514 -p patterns.txt
+//   {"message":"Accepted password for gonner from 10.0.0.1 port 22 ssh2","pattern":{...},"fields":{"apphost":"testserver","appname":"sshd",...}}
 package main
 
 import (
 	"bufio"
 	"compress/gzip"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"net"
 	"os"
 	"os/signal"
+	"regexp"
 	"runtime/pprof"
 	"strings"
+	"sync"
 	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/dataence/glog"
@@ -204,6 +373,10 @@ import (
 	"github.com/surge/sequence"
 )
 
+// maxLineSize is the longest line the commands read. A longer line ends the input
+// with an error, since bufio.Scanner can't skip it.
+const maxLineSize = 1024 * 1024
+
 var (
 	sequenceCmd = &cobra.Command{
 		Use:   "sequence",
@@ -230,6 +403,26 @@ var (
 		Short: "benchmark the parsing of a log file, no output is provided",
 	}
 
+	testCmd = &cobra.Command{
+		Use:   "test",
+		Short: "test will check that the example messages in the pattern files parse to their own patterns",
+	}
+
+	compileCmd = &cobra.Command{
+		Use:   "compile",
+		Short: "compile will build the parser from the pattern files and save it, so it can be loaded quickly",
+	}
+
+	lintCmd = &cobra.Command{
+		Use:   "lint",
+		Short: "lint will find patterns that are duplicates of, or conflict with, other patterns",
+	}
+
+	serveSyslogCmd = &cobra.Command{
+		Use:   "serve-syslog",
+		Short: "serve-syslog will receive syslog messages over the network and output the parsed messages",
+	}
+
 	inmsg      string
 	infile     string
 	outfile    string
@@ -237,6 +430,18 @@ var (
 	patdir     string
 	cpuprofile string
 	workers    int
+	format     string
+	follow     bool
+	udpaddr    string
+	savefile   string
+	infer      bool
+	confidence float64
+	loadfiles  string
+	tcpaddr    string
+	unixaddr   string
+	join       string
+	begin      string
+	reload     bool
 
 	quit chan struct{}
 	done chan struct{}
@@ -249,29 +454,68 @@ func init() {
 	scanCmd.Flags().StringVarP(&inmsg, "msg", "m", "", "message to tokenize")
 	scanCmd.Run = scan
 
-	analyzeCmd.Flags().StringVarP(&infile, "infile", "i", "", "input file, required")
+	analyzeCmd.Flags().StringVarP(&infile, "infile", "i", "", "input file, if empty or -, from stdin")
 	analyzeCmd.Flags().StringVarP(&patfile, "patfile", "p", "", "initial pattern file, optional")
 	analyzeCmd.Flags().StringVarP(&patdir, "patdir", "d", "", "pattern directory,, all files in directory will be used, optional")
 	analyzeCmd.Flags().StringVarP(&outfile, "outfile", "o", "", "output file, if empty, to stdout")
+	analyzeCmd.Flags().StringVarP(&savefile, "save", "s", "", "file to save the analyzer to after analyzing, so it can be merged later")
+	analyzeCmd.Flags().StringVarP(&loadfiles, "load", "l", "", "comma separated list of saved analyzers to merge before analyzing")
+	analyzeCmd.Flags().BoolVarP(&infer, "infer", "n", false, "annotate the new patterns with inferred field types")
+	analyzeCmd.Flags().Float64VarP(&confidence, "confidence", "c", 0.5, "minimum confidence of the inferred field types, between 0 and 1")
+	analyzeCmd.Flags().StringVarP(&begin, "begin", "b", "", "regular expression that matches the first line of each message, other lines are joined to it")
+	analyzeCmd.Flags().StringVarP(&join, "join", "j", "", "join continuation lines to their messages, comma separated list of indent (indented lines) and time (lines without a time stamp)")
 	analyzeCmd.Run = analyze
 
-	parseCmd.Flags().StringVarP(&infile, "infile", "i", "", "input file, required ")
+	parseCmd.Flags().StringVarP(&infile, "infile", "i", "", "input file, if empty or -, from stdin")
 	parseCmd.Flags().StringVarP(&patfile, "patfile", "p", "", "initial pattern file, required")
 	parseCmd.Flags().StringVarP(&patdir, "patdir", "d", "", "pattern directory,, all files in directory will be used")
 	parseCmd.Flags().StringVarP(&outfile, "outfile", "o", "", "output file, if empty, to stdout")
+	parseCmd.Flags().StringVarP(&format, "format", "f", "text", "output format, one of text, json or ndjson")
+	parseCmd.Flags().BoolVarP(&follow, "follow", "F", false, "follow the input file as it grows, across renames and truncation")
+	parseCmd.Flags().StringVarP(&begin, "begin", "b", "", "regular expression that matches the first line of each message, other lines are joined to it")
+	parseCmd.Flags().StringVarP(&join, "join", "j", "", "join continuation lines to their messages, comma separated list of indent (indented lines) and time (lines without a time stamp)")
 	parseCmd.Run = parse
 
-	benchCmd.Flags().StringVarP(&infile, "infile", "i", "", "input file, required ")
+	benchCmd.Flags().StringVarP(&infile, "infile", "i", "", "input file, if empty or -, from stdin")
 	benchCmd.Flags().StringVarP(&patfile, "patfile", "p", "", "pattern file, required")
 	benchCmd.Flags().StringVarP(&patdir, "patdir", "d", "", "pattern directory,, all files in directory will be used")
 	benchCmd.Flags().StringVarP(&cpuprofile, "cpuprofile", "c", "", "CPU profile filename")
 	benchCmd.Flags().IntVarP(&workers, "workers", "w", 1, "number of parsing workers")
+	benchCmd.Flags().StringVarP(&begin, "begin", "b", "", "regular expression that matches the first line of each message, other lines are joined to it")
+	benchCmd.Flags().StringVarP(&join, "join", "j", "", "join continuation lines to their messages, comma separated list of indent (indented lines) and time (lines without a time stamp)")
 	benchCmd.Run = bench
 
+	testCmd.Flags().StringVarP(&patfile, "patfile", "p", "", "pattern file to test")
+	testCmd.Flags().StringVarP(&patdir, "patdir", "d", "", "pattern directory,, all files in directory will be tested")
+	testCmd.Run = test
+
+	compileCmd.Flags().StringVarP(&patfile, "patfile", "p", "", "pattern file to compile")
+	compileCmd.Flags().StringVarP(&patdir, "patdir", "d", "", "pattern directory,, all files in directory will be compiled")
+	compileCmd.Flags().StringVarP(&outfile, "outfile", "o", "", "output file, if empty, to stdout")
+	compileCmd.Run = compile
+
+	lintCmd.Flags().StringVarP(&patfile, "patfile", "p", "", "pattern file to lint")
+	lintCmd.Flags().StringVarP(&patdir, "patdir", "d", "", "pattern directory,, all files in directory will be linted together")
+	lintCmd.Run = lint
+
+	serveSyslogCmd.Flags().StringVarP(&udpaddr, "udp", "u", "", "UDP address to listen on, e.g., :514")
+	serveSyslogCmd.Flags().StringVarP(&tcpaddr, "tcp", "t", "", "TCP address to listen on, e.g., :514")
+	serveSyslogCmd.Flags().StringVarP(&unixaddr, "unix", "x", "", "unix domain socket to listen on, e.g., /dev/log")
+	serveSyslogCmd.Flags().StringVarP(&patfile, "patfile", "p", "", "initial pattern file, required")
+	serveSyslogCmd.Flags().StringVarP(&patdir, "patdir", "d", "", "pattern directory,, all files in directory will be used")
+	serveSyslogCmd.Flags().StringVarP(&outfile, "outfile", "o", "", "output file, if empty, to stdout")
+	serveSyslogCmd.Flags().BoolVarP(&reload, "reload", "r", false, "reload the patterns when the pattern files change")
+	serveSyslogCmd.Flags().StringVarP(&format, "format", "f", "ndjson", "output format, one of text or ndjson")
+	serveSyslogCmd.Run = serveSyslog
+
 	sequenceCmd.AddCommand(scanCmd)
 	sequenceCmd.AddCommand(analyzeCmd)
 	sequenceCmd.AddCommand(parseCmd)
 	sequenceCmd.AddCommand(benchCmd)
+	sequenceCmd.AddCommand(testCmd)
+	sequenceCmd.AddCommand(lintCmd)
+	sequenceCmd.AddCommand(compileCmd)
+	sequenceCmd.AddCommand(serveSyslogCmd)
 }
 
 func profile() {
@@ -321,21 +565,21 @@ func scan(cmd *cobra.Command, args []string) {
 }
 
 func analyze(cmd *cobra.Command, args []string) {
-	if infile == "" {
-		log.Fatal("Invalid input file")
-	}
-
 	profile()
 
 	parser := buildParser()
 	analyzer := sequence.NewAnalyzer()
 
 	// Open input file
-	iscan, ifile := openFile(infile)
+	iscan, ifile := openInput(infile)
 	defer ifile.Close()
 
 	s := sequence.NewScanner()
 
+	// We need to go through the messages twice, and since stdin can only be read
+	// once, we have to keep the messages in memory.
+	var lines []string
+
 	// For all the log messages, if we can't parse it, then let's add it to the
 	// analyzer for pattern analysis
 	for iscan.Scan() {
@@ -344,6 +588,10 @@ func analyze(cmd *cobra.Command, args []string) {
 			continue
 		}
 
+		if isStdin(infile) {
+			lines = append(lines, line)
+		}
+
 		seq, err := s.Scan(line)
 		if err != nil {
 			log.Println(err)
@@ -355,14 +603,33 @@ func analyze(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	checkInput(iscan)
 	ifile.Close()
+
+	if loadfiles != "" {
+		for _, fname := range strings.Split(loadfiles, ",") {
+			if err := analyzer.Merge(loadAnalyzer(fname)); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
 	analyzer.Finalize()
 
-	iscan, ifile = openFile(infile)
-	defer ifile.Close()
+	if savefile != "" {
+		saveAnalyzer(analyzer, savefile)
+	}
+
+	if isStdin(infile) {
+		iscan = frameLines(newLineScanner(strings.NewReader(strings.Join(lines, "\n"))))
+	} else {
+		iscan, ifile = openInput(infile)
+		defer ifile.Close()
+	}
 
 	pmap := make(map[string]map[string]string)
 	amap := make(map[string]map[string]string)
+	ainfo := make(map[string]string)
 	n := 0
 
 	// Now that we have built the analyzer, let's go through each log message again
@@ -376,12 +643,15 @@ func analyze(cmd *cobra.Command, args []string) {
 
 		seq, err := s.Scan(line)
 		if err != nil {
-			log.Fatal(err)
+			log.Println(err)
+			continue
 		}
 
 		pseq, err := parser.Parse(seq)
 		if err == nil {
-			pat := pseq.String()
+			// The pattern is escaped, since the literals from the message could be
+			// read as optional tokens or alternatives
+			pat := pseq.Escape().String()
 			sig := pseq.Signature()
 			if _, ok := pmap[pat]; !ok {
 				pmap[pat] = make(map[string]string)
@@ -392,7 +662,11 @@ func analyze(cmd *cobra.Command, args []string) {
 			if err != nil {
 				log.Printf("Error parsing: %s", line)
 			} else {
-				pat := aseq.String()
+				if infer {
+					aseq = inferFields(aseq, ainfo)
+				}
+
+				pat := aseq.Escape().String()
 				sig := aseq.Signature()
 				if _, ok := amap[pat]; !ok {
 					amap[pat] = make(map[string]string)
@@ -402,21 +676,27 @@ func analyze(cmd *cobra.Command, args []string) {
 		}
 	}
 
+	checkInput(iscan)
+
 	ofile := openOutputFile(outfile)
 	defer ofile.Close()
 
 	for pat, lines := range pmap {
 		fmt.Fprintf(ofile, "%s\n", pat)
 		for _, line := range lines {
-			fmt.Fprintf(ofile, "# %s\n", line)
+			fmt.Fprintf(ofile, "# %s\n", firstLine(line))
 		}
 		fmt.Fprintln(ofile)
 	}
 
 	for pat, lines := range amap {
+		if info, ok := ainfo[pat]; ok {
+			fmt.Fprintf(ofile, "# inferred: %s\n", info)
+		}
+
 		fmt.Fprintf(ofile, "%s\n", pat)
 		for _, line := range lines {
-			fmt.Fprintf(ofile, "# %s\n", line)
+			fmt.Fprintf(ofile, "# %s\n", firstLine(line))
 		}
 		fmt.Fprintln(ofile)
 	}
@@ -425,23 +705,28 @@ func analyze(cmd *cobra.Command, args []string) {
 }
 
 func parse(cmd *cobra.Command, args []string) {
-	if infile == "" {
-		log.Fatal("Invalid input file")
+	if format != "text" && format != "json" && format != "ndjson" {
+		log.Fatalf("Invalid output format %q", format)
 	}
 
 	profile()
 
 	parser := buildParser()
 
-	iscan, ifile := openFile(infile)
+	iscan, ifile := openInput(infile)
 	defer ifile.Close()
 
 	ofile := openOutputFile(outfile)
 	defer ofile.Close()
 
 	s := sequence.NewScanner()
-	n := 0
+	n, matched := 0, 0
 	now := time.Now()
+	enc := json.NewEncoder(ofile)
+
+	if format == "json" {
+		fmt.Fprint(ofile, "[")
+	}
 
 	for iscan.Scan() {
 		line := iscan.Text()
@@ -452,17 +737,40 @@ func parse(cmd *cobra.Command, args []string) {
 
 		seq, err := s.Scan(line)
 		if err != nil {
-			log.Fatal(err)
+			log.Printf("Error scanning: %s: %v", line, err)
+			continue
 		}
 
-		pseq, err := parser.Parse(seq)
+		pseq, pat, err := parser.MatchData(nil, seq, line)
 		if err != nil {
 			log.Printf("Error parsing: %s", line)
-		} else {
+			continue
+		}
+		matched++
+
+		switch format {
+		case "json":
+			if matched > 1 {
+				fmt.Fprint(ofile, ",")
+			}
+			fallthrough
+
+		case "ndjson":
+			if err := enc.Encode(newParsedMessage(line, pseq, pat)); err != nil {
+				log.Fatal(err)
+			}
+
+		default:
 			fmt.Fprintf(ofile, "%s\n%s\n\n", line, pseq.LongString())
 		}
 	}
 
+	checkInput(iscan)
+
+	if format == "json" {
+		fmt.Fprintln(ofile, "]")
+	}
+
 	since := time.Since(now)
 	log.Printf("Parsed %d messages in %.2f secs, ~ %.2f msgs/sec", n, float64(since)/float64(time.Second), float64(n)/(float64(since)/float64(time.Second)))
 	close(quit)
@@ -470,13 +778,9 @@ func parse(cmd *cobra.Command, args []string) {
 }
 
 func bench(cmd *cobra.Command, args []string) {
-	if infile == "" {
-		log.Fatal("Invalid input file")
-	}
-
 	parser := buildParser()
 
-	iscan, ifile := openFile(infile)
+	iscan, ifile := openInput(infile)
 	defer ifile.Close()
 
 	var lines []string
@@ -492,6 +796,8 @@ func bench(cmd *cobra.Command, args []string) {
 		lines = append(lines, line)
 	}
 
+	checkInput(iscan)
+
 	profile()
 
 	s := sequence.NewScanner()
@@ -540,10 +846,364 @@ func bench(cmd *cobra.Command, args []string) {
 	<-done
 }
 
+func serveSyslog(cmd *cobra.Command, args []string) {
+	if udpaddr == "" && tcpaddr == "" && unixaddr == "" {
+		log.Fatal("At least one of --udp, --tcp or --unix is required")
+	}
+
+	if format != "text" && format != "ndjson" {
+		log.Fatalf("Invalid output format %q", format)
+	}
+
+	var parser *sequence.Parser
+
+	if reload {
+		// The reloader reads the pattern files, so they can't be compiled parsers
+		var paths []string
+
+		if patdir != "" {
+			paths = append(paths, patdir)
+		}
+
+		if patfile != "" {
+			paths = append(paths, patfile)
+		}
+
+		parser = sequence.NewParser()
+		reloader := sequence.NewReloader(parser, func(files []string, err error) {
+			if err != nil {
+				log.Printf("Error reloading patterns, keeping the current ones: %v", err)
+			} else {
+				log.Printf("Reloaded patterns from %d files", len(files))
+			}
+		}, paths...)
+
+		if err := reloader.Reload(); err != nil {
+			log.Fatal(err)
+		}
+
+		reloader.Watch(time.Second)
+		defer reloader.Close()
+	} else {
+		parser = buildParser()
+	}
+
+	ofile := openOutputFile(outfile)
+	defer ofile.Close()
+
+	var mu sync.Mutex
+
+	s := sequence.NewScanner()
+	enc := json.NewEncoder(ofile)
+
+	server := sequence.NewSyslogServer(func(msg *sequence.SyslogMessage, err error) {
+		if err != nil {
+			log.Printf("Error decoding: %s: %v", msg.Message, err)
+			return
+		}
+
+		// The header is always part of the output, even if the body doesn't match
+		// any of the patterns.
+		seq := msg.Header()
+
+		var pat *sequence.Pattern
+
+		if bseq, err := s.Scan(msg.Message); err == nil {
+			var pseq sequence.Sequence
+
+			if pseq, pat, err = parser.MatchData(nil, bseq, msg.Message); err == nil {
+				seq = append(seq, pseq...)
+			} else {
+				log.Printf("Error parsing: %s", msg.Message)
+			}
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		if format == "ndjson" {
+			if err := enc.Encode(newParsedMessage(msg.Message, seq, pat)); err != nil {
+				log.Fatal(err)
+			}
+		} else {
+			fmt.Fprintf(ofile, "%s\n%s\n\n", msg.Message, seq.LongString())
+		}
+	})
+
+	for _, l := range []struct{ network, addr string }{
+		{"udp", udpaddr},
+		{"tcp", tcpaddr},
+		{"unix", unixaddr},
+	} {
+		if l.addr == "" {
+			continue
+		}
+
+		addr, err := server.Listen(l.network, l.addr)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		log.Printf("Listening on %s %s", l.network, addr)
+	}
+
+	sigchan := make(chan os.Signal, 1)
+	signal.Notify(sigchan, os.Interrupt, syscall.SIGTERM)
+
+	sig := <-sigchan
+	log.Printf("Exiting due to trapped signal; %v", sig)
+
+	server.Close()
+}
+
+func test(cmd *cobra.Command, args []string) {
+	files := patternFiles()
+	if len(files) == 0 {
+		log.Fatal("At least one of --patfile or --patdir is required")
+	}
+
+	parser := sequence.NewParser()
+	fpats := make([][]*sequence.Pattern, len(files))
+
+	// All the patterns need to be in the parser before checking any of the
+	// examples, otherwise we won't know if an example matches a different pattern.
+	for i, file := range files {
+		fpats[i] = readPatternFile(file)
+
+		if err := parser.AddPatterns(fpats[i]); err != nil {
+			log.Fatalf("%s: %v", file, err)
+		}
+	}
+
+	var npats, nexamples, nfailed int
+
+	for i, file := range files {
+		for _, pat := range fpats[i] {
+			npats++
+			nexamples += len(pat.Examples)
+		}
+
+		for _, f := range sequence.CheckExamples(parser, fpats[i]) {
+			nfailed++
+			fmt.Printf("--- FAIL: %s\n    %s\n\n", file, strings.Replace(f.String(), "\n", "\n    ", -1))
+		}
+	}
+
+	log.Printf("Tested %d examples of %d patterns, %d failed.", nexamples, npats, nfailed)
+
+	if nfailed > 0 {
+		os.Exit(1)
+	}
+}
+
+func compile(cmd *cobra.Command, args []string) {
+	if len(patternFiles()) == 0 {
+		log.Fatal("At least one of --patfile or --patdir is required")
+	}
+
+	parser := buildParser()
+
+	data, err := parser.MarshalBinary()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ofile := openOutputFile(outfile)
+	defer ofile.Close()
+
+	if _, err := ofile.Write(data); err != nil {
+		log.Fatal(err)
+	}
+
+	log.Printf("Compiled parser is %d bytes.", len(data))
+}
+
+func lint(cmd *cobra.Command, args []string) {
+	files := patternFiles()
+	if len(files) == 0 {
+		log.Fatal("At least one of --patfile or --patdir is required")
+	}
+
+	var patterns []*sequence.Pattern
+	pfiles := make(map[*sequence.Pattern]string)
+
+	for _, file := range files {
+		for _, pat := range readPatternFile(file) {
+			patterns = append(patterns, pat)
+			pfiles[pat] = file
+		}
+	}
+
+	issues := sequence.Lint(patterns)
+
+	for _, issue := range issues {
+		fmt.Printf("--- %s\n%s\n\n", pfiles[issue.Pattern], issue)
+	}
+
+	log.Printf("Linted %d patterns, found %d issues.", len(patterns), len(issues))
+
+	if len(issues) > 0 {
+		os.Exit(1)
+	}
+}
+
+// parsedMessage is the JSON representation of a parsed message, used by the json
+// and ndjson output formats.
+type parsedMessage struct {
+	Message string                 `json:"message"`
+	Pattern *parsedPattern         `json:"pattern,omitempty"`
+	Fields  map[string]interface{} `json:"fields"`
+}
+
+type parsedPattern struct {
+	ID       string   `json:"id"`
+	Name     string   `json:"name,omitempty"`
+	MsgClass string   `json:"msgclass,omitempty"`
+	MsgType  string   `json:"msgtype,omitempty"`
+	Vendor   string   `json:"vendor,omitempty"`
+	Product  string   `json:"product,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Pattern  string   `json:"pattern"`
+}
+
+// newParsedMessage builds the JSON representation of a parsed message. The fields
+// are keyed by the field names without the percent signs, e.g., srcipv4. If a field
+// appears more than once in the message, its value is a list. If pat is nil, the
+// pattern is left out.
+func newParsedMessage(line string, pseq sequence.Sequence, pat *sequence.Pattern) *parsedMessage {
+	pm := &parsedMessage{
+		Message: line,
+		Fields:  make(map[string]interface{}),
+	}
+
+	if pat != nil {
+		pm.Pattern = &parsedPattern{
+			ID:       pat.ID,
+			Name:     pat.Name,
+			MsgClass: pat.MsgClass,
+			MsgType:  pat.MsgType,
+			Vendor:   pat.Vendor,
+			Product:  pat.Product,
+			Tags:     pat.Tags,
+			Pattern:  pat.Sequence.String(),
+		}
+	}
+
+	for f, values := range pseq.Extract() {
+		for i, v := range values {
+			// net.HardwareAddr would otherwise be encoded as a base64 byte slice
+			if mac, ok := v.(net.HardwareAddr); ok {
+				values[i] = mac.String()
+			}
+		}
+
+		name := strings.Trim(f.String(), "%")
+
+		if len(values) == 1 {
+			pm.Fields[name] = values[0]
+		} else {
+			pm.Fields[name] = values
+		}
+	}
+
+	return pm
+}
+
 func buildParser() *sequence.Parser {
 	parser := sequence.NewParser()
-	s := sequence.NewScanner()
+	files := patternFiles()
+
+	// The pattern file could be a compiled parser, which has to be loaded before
+	// adding the patterns from the pattern directory.
+	if patfile != "" && loadCompiledParser(parser, patfile) {
+		files = files[:len(files)-1]
+	}
+
+	for _, file := range files {
+		if err := parser.AddPatterns(readPatternFile(file)); err != nil {
+			log.Fatalf("%s: %v", file, err)
+		}
+	}
+
+	return parser
+}
+
+// loadCompiledParser loads the compiled parser in fname into parser. It returns
+// false if fname is not a compiled parser.
+func loadCompiledParser(parser *sequence.Parser, fname string) bool {
+	preader, pfile := openReader(fname)
+	defer pfile.Close()
+
+	data, err := ioutil.ReadAll(preader)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := parser.UnmarshalBinary(data); err != nil {
+		if err == sequence.ErrNotCompiled {
+			return false
+		}
+
+		log.Fatalf("%s: %v", fname, err)
+	}
+
+	return true
+}
 
+// inferFields annotates the pattern sequence with the inferred field types that have
+// enough confidence. The inferred field types are kept in info, keyed by the
+// annotated pattern, so they can be added to the output as a comment.
+func inferFields(aseq sequence.Sequence, info map[string]string) sequence.Sequence {
+	var applied []string
+
+	proposals := sequence.InferFields(aseq)
+	for _, p := range proposals {
+		if p.Confidence >= confidence {
+			applied = append(applied, p.String())
+		}
+	}
+
+	aseq = sequence.ApplyFields(aseq, proposals, confidence)
+
+	if len(applied) > 0 {
+		info[aseq.Escape().String()] = strings.Join(applied, ", ")
+	}
+
+	return aseq
+}
+
+func loadAnalyzer(fname string) *sequence.Analyzer {
+	areader, afile := openReader(fname)
+	defer afile.Close()
+
+	data, err := ioutil.ReadAll(areader)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	analyzer := sequence.NewAnalyzer()
+
+	if err := analyzer.UnmarshalBinary(data); err != nil {
+		log.Fatalf("%s: %v", fname, err)
+	}
+
+	return analyzer
+}
+
+func saveAnalyzer(analyzer *sequence.Analyzer, fname string) {
+	data, err := analyzer.MarshalBinary()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(fname, data, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// patternFiles returns the list of pattern files specified by --patdir and
+// --patfile.
+func patternFiles() []string {
 	var files []string
 
 	if patdir != "" {
@@ -554,36 +1214,136 @@ func buildParser() *sequence.Parser {
 		files = append(files, patfile)
 	}
 
-	for _, file := range files {
-		// Open pattern file
-		pscan, pfile := openFile(file)
+	return files
+}
 
-		for pscan.Scan() {
-			line := pscan.Text()
-			if len(line) == 0 || line[0] == '#' {
-				continue
-			}
+func readPatternFile(file string) []*sequence.Pattern {
+	// Open pattern file
+	preader, pfile := openReader(file)
+	defer pfile.Close()
 
-			seq, err := s.Scan(line)
-			if err != nil {
-				log.Fatal(err)
-			}
+	patterns, err := sequence.ReadPatterns(preader)
+	if err != nil {
+		log.Fatalf("%s: %v", file, err)
+	}
 
-			err = parser.Add(seq)
-			if err != nil {
-				log.Fatal(err)
-			}
+	return patterns
+}
+
+// lineScanner is the part of bufio.Scanner the commands use to read the messages,
+// which sequence.Framer also has.
+type lineScanner interface {
+	Scan() bool
+	Text() string
+	Err() error
+}
+
+// checkInput exits if the input could not be read to the end, e.g., if it has a
+// line longer than maxLineSize.
+func checkInput(iscan lineScanner) {
+	if err := iscan.Err(); err != nil {
+		log.Fatalf("Error reading input: %v", err)
+	}
+}
+
+// openInput opens the input for the commands, and assembles the lines into messages
+// if --join or --begin is set.
+func openInput(fname string) (lineScanner, io.Closer) {
+	lines, f := openLines(fname)
+	return frameLines(lines), f
+}
+
+// frameLines returns a Framer that joins the continuation lines to the messages they
+// belong to, based on --join and --begin, or lines itself if neither is set.
+func frameLines(lines *bufio.Scanner) lineScanner {
+	if join == "" && begin == "" {
+		return lines
+	}
+
+	var opts sequence.FramerOptions
+
+	for _, rule := range strings.Split(join, ",") {
+		switch strings.TrimSpace(rule) {
+		case "":
+
+		case "indent":
+			opts.Indented = true
+
+		case "time":
+			opts.Timestamped = true
+
+		default:
+			log.Fatalf("Invalid join rule %q, must be indent or time", rule)
+		}
+	}
+
+	if begin != "" {
+		re, err := regexp.Compile(begin)
+		if err != nil {
+			log.Fatalf("Invalid --begin regular expression: %v", err)
 		}
 
-		pfile.Close()
+		opts.Start = re
 	}
 
-	return parser
+	return sequence.NewFramer(lines, opts)
+}
+
+// firstLine returns the first line of a message, which is all of it unless the
+// message was assembled from several lines.
+func firstLine(msg string) string {
+	if i := strings.IndexByte(msg, '\n'); i >= 0 {
+		return msg[:i]
+	}
+
+	return msg
+}
+
+// openLines opens the input for the commands. If fname is empty or -, the input is
+// read from stdin. If --follow is set, the file is followed as it grows.
+func openLines(fname string) (*bufio.Scanner, io.Closer) {
+	switch {
+	case isStdin(fname):
+		if follow {
+			log.Fatal("Cannot follow stdin")
+		}
+
+		return newLineScanner(os.Stdin), ioutil.NopCloser(os.Stdin)
+
+	case follow:
+		if strings.HasSuffix(fname, ".gz") {
+			log.Fatal("Cannot follow a gzip file")
+		}
+
+		f, err := newFollower(fname, time.Second)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return newLineScanner(f), f
+	}
+
+	return openFile(fname)
+}
+
+// newLineScanner returns a Scanner that reads the lines of r, which can be up to
+// maxLineSize bytes long.
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	lines := bufio.NewScanner(r)
+	lines.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxLineSize)
+	return lines
+}
+
+func isStdin(fname string) bool {
+	return fname == "" || fname == "-"
 }
 
 func openFile(fname string) (*bufio.Scanner, *os.File) {
-	var s *bufio.Scanner
+	r, f := openReader(fname)
+	return newLineScanner(r), f
+}
 
+func openReader(fname string) (io.Reader, *os.File) {
 	f, err := os.Open(fname)
 	if err != nil {
 		log.Fatal(err)
@@ -595,12 +1355,10 @@ func openFile(fname string) (*bufio.Scanner, *os.File) {
 			log.Fatal(err)
 		}
 
-		s = bufio.NewScanner(gunzip)
-	} else {
-		s = bufio.NewScanner(f)
+		return gunzip, f
 	}
 
-	return s, f
+	return f, f
 }
 
 func getDirOfFiles(path string) []string {
@@ -625,7 +1383,7 @@ func openOutputFile(fname string) *os.File {
 	)
 
 	if fname == "" {
-		ofile = os.Stdin
+		ofile = os.Stdout
 	} else {
 		// Open output file
 		ofile, err = os.OpenFile(fname, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
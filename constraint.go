@@ -0,0 +1,178 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// constraint limits the values a field or type token in a pattern matches. It is
+// written after a colon in the token, e.g.,
+//
+//   %srcport:0-65535%              a numeric range
+//   %action:{built,teardown}%      a set of values
+//   %dstuser:len=1-32%             a range of lengths
+//   %srcipv4:10.0.0.0/8%           a CIDR network
+//   %srcipv4:{10.0.0.0/8,1.2.3.4}% a set of networks and addresses
+//
+// A range can also be a single number, e.g., %integer:0% or %string:len=8%.
+type constraint struct {
+	min, max float64
+	ranged   bool
+	length   bool
+	values   map[string]bool
+	nets     []*net.IPNet
+}
+
+// tokenConstraint returns the constraint of a field or type token in a pattern, or
+// "" if it doesn't have one.
+func tokenConstraint(token Token) string {
+	v := token.Value
+
+	if token.Type == TokenLiteral || len(v) < 3 || v[0] != '%' || v[len(v)-1] != '%' {
+		return ""
+	}
+
+	if i := strings.IndexByte(v, ':'); i > 0 {
+		return v[i+1 : len(v)-1]
+	}
+
+	return ""
+}
+
+// parseConstraint parses the constraint of a field or type token.
+func parseConstraint(s string) (*constraint, error) {
+	c := &constraint{}
+
+	switch {
+	case strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}"):
+		c.values = make(map[string]bool)
+
+		for _, v := range strings.Split(s[1:len(s)-1], ",") {
+			if v == "" {
+				return nil, ErrInvalidConstraint
+			}
+
+			if n := parseNet(v); n != nil {
+				c.nets = append(c.nets, n)
+			} else {
+				c.values[strings.ToLower(v)] = true
+			}
+		}
+
+	case strings.HasPrefix(s, "len="):
+		c.length = true
+		if !c.parseRange(s[4:]) || c.min < 0 {
+			return nil, ErrInvalidConstraint
+		}
+
+	case strings.IndexByte(s, '/') > 0:
+		n := parseNet(s)
+		if n == nil {
+			return nil, ErrInvalidConstraint
+		}
+
+		c.nets = append(c.nets, n)
+
+	default:
+		if !c.parseRange(s) {
+			return nil, ErrInvalidConstraint
+		}
+	}
+
+	return c, nil
+}
+
+// parseRange parses a range of numbers, N-M, or a single number, N. The first number
+// can be negative.
+func (this *constraint) parseRange(s string) bool {
+	var err error
+
+	if s == "" {
+		return false
+	}
+
+	lo, hi := s, s
+	if i := strings.IndexByte(s[1:], '-'); i >= 0 {
+		lo, hi = s[:i+1], s[i+2:]
+	}
+
+	if this.min, err = strconv.ParseFloat(lo, 64); err != nil {
+		return false
+	}
+
+	if this.max, err = strconv.ParseFloat(hi, 64); err != nil {
+		return false
+	}
+
+	this.ranged = true
+	return this.min <= this.max
+}
+
+// parseNet parses a CIDR network or a single IP address, or returns nil if s is
+// neither.
+func parseNet(s string) *net.IPNet {
+	if _, n, err := net.ParseCIDR(s); err == nil {
+		return n
+	}
+
+	if ip := net.ParseIP(s); ip != nil {
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	}
+
+	return nil
+}
+
+// match returns true if the value of the message token satisfies the constraint.
+func (this *constraint) match(value string) bool {
+	switch {
+	case this.length:
+		n := float64(utf8.RuneCountInString(value))
+		return n >= this.min && n <= this.max
+
+	case this.ranged:
+		f, err := strconv.ParseFloat(value, 64)
+		return err == nil && f >= this.min && f <= this.max
+	}
+
+	if this.values[strings.ToLower(value)] {
+		return true
+	}
+
+	if len(this.nets) > 0 {
+		// remove the zone index, e.g., fe80::1%eth0
+		if i := strings.IndexByte(value, '%'); i > 0 {
+			value = value[:i]
+		}
+
+		if ip := net.ParseIP(value); ip != nil {
+			for _, n := range this.nets {
+				if n.Contains(ip) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
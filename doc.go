@@ -71,16 +71,23 @@
 //
 // - A _Token_ is a piece of information extracted from the original log message.
 // It is a struct that contains fields for _TokenType_, _FieldType_, _Value_,
-// and indicators of whether it's a key or value in the key=value pair.
+// and indicators of whether it's a key or value in the key=value pair. It also
+// records the byte offsets of the token in the original message, and the token as it
+// appears there, before it's lowercased, so fields can be highlighted or redacted,
+// and Sequence.Original returns the values in their original case.
 //
 // - A _TokenType_ indicates whether the token is a literal string (one that does
 // not change), a variable string (one that could have different values), an IPv4
 // or IPv6 address, a MAC address, an integer, a floating point number, or a
-// timestamp.
+// timestamp. Applications can add their own token types, e.g., %uuid% or %email%,
+// using RegisterTokenType with a TokenRecognizer. The package comes with
+// recognizers for UUIDs, hashes, email addresses, host names, file paths, hex
+// numbers and durations, which are not registered by default.
 //
 // - A _FieldType_ indicates the semantic meaning of the token. For example, a token
 // could be a source IP address (%srcipv4%), or a user (%srcuser% or %dstuser%),
-// an action (%action%) or a status (%status%).
+// an action (%action%) or a status (%status%). Applications can add their own field
+// types, e.g., %url_path% or %http_status%, using RegisterField.
 //
 // - A _Sequence_ is a list of Tokens. It is returned by the _Scanner_, the _Analyzer_,
 // and the _Parser_.
@@ -88,17 +95,67 @@
 // - A _Scanner_ is a sequential lexical analyzer that breaks a log message into a
 // sequence of tokens. It is sequential because it goes through log message sequentially
 // tokentizing each part of the message, without the use of regular expressions.
-// The scanner currently recognizes time stamps, IPv4 addresses, URLs, MAC addresses,
-// integers and floating point numbers. It also recgonizes key=value or key="value"
-// or key='value' or key=<value> pairs.
+// The scanner currently recognizes time stamps, IPv4 and IPv6 addresses, URLs, MAC
+// addresses, integers and floating point numbers. It also recgonizes key=value or
+// key="value" or key='value' or key=<value> pairs. Scanners created using
+// NewScannerWithOptions can recognize additional time formats, and ParseTime
+// converts the time stamps a Scanner returns to time.Time, inferring the year when
+// the format has none, and using a default time zone when the time stamp has none.
+// Scanner.Extract uses the same conversion for the fields of a parsed message.
+// With the EpochTimes option, the Scanner also recognizes Unix epoch times in
+// seconds, milliseconds, microseconds or nanoseconds, e.g., 1697040000 or
+// 1697040000.123, that fall within a configurable date window. Messages that are
+// JSON objects are flattened into key = value tokens, where the keys of nested
+// objects are joined with dots, e.g., src.ip. The Separators, Quotes and Escape
+// options add other key/value syntaxes, such as key: value, key=>value,
+// 'key'='value' and escaped quotes in values, e.g., "say \"hi\"".
 //
 // - A _Analyzer_ builds an analysis tree that represents all the Sequences from messages.
 // It can be used to determine all of the unique patterns for a large body of messages.
+// Analyzers can be saved and merged, so the messages don't have to be analyzed at once.
+// InferFields proposes field types for the tokens of an analyzed Sequence, based on
+// the keywords around them.
 //
 // - A _Parser_ is a tree-based parsing engine for log messages. It builds a parsing
 // tree based on pattern sequence supplied, and for each message sequence, returns
 // the matching pattern sequence. Each of the message tokens will be marked with the
-// semantic field types.
+// semantic field types. A %field*% or %field+% token in a pattern consumes a variable
+// number of message tokens, e.g., the rest of the message. A token can also constrain
+// the values it matches, e.g., %srcport:0-1023% or %action:{built,teardown}%. For
+// high volumes of messages, Scanner.ScanInto and Parser.ParseInto reuse the caller's
+// Sequence and pool their state, so messages can be scanned and parsed without
+// allocating. Parsing never waits for patterns being added, since new patterns are
+// added to a copy of the tree that is then swapped in. A _Reloader_ uses this to
+// reload the pattern files in the background when they change.
+//
+// - A _Pattern_ is a pattern sequence along with its identity and information, such
+// as a stable ID, a name, a msgclass/msgtype, a vendor/product and free-form tags.
+// These are set using "#! key: value" directives in the pattern files. The Parser
+// reports which Pattern matched each message. Optional tokens, [ , ]?, and
+// alternatives, ( accepted | failed ), let one Pattern cover several variants.
+//
+// - A _Record_ is the set of semantic fields extracted from a parsed Sequence, keyed
+// by FieldType. The values are converted to Go types, e.g., net.IP for IPv4 and IPv6
+// addresses, int64 for ports and byte counts, and time.Time for time stamps.
+//
+// - The _Lint_ function compares each pair of patterns and finds the ones that are
+// duplicates, that shadow each other, or that can never win against another pattern.
+//
+// - A _SyslogMessage_ is a decoded RFC 3164 or RFC 5424 syslog message. Its header
+// fields are available as a Sequence of semantic fields, and its message body can be
+// scanned and parsed like any other log message. A _SyslogServer_ receives syslog
+// messages over UDP, TCP or unix domain sockets.
+//
+// - A _CEFMessage_ is a decoded ArcSight CEF or IBM LEEF message. Its header and
+// extension are available as a Sequence of key = value tokens, where the product,
+// the event class ID and the severity are marked as %apptype%, %msgtype% and
+// %severity%, and the extension keys such as src, dst, spt, dpt and suser are marked
+// with their field types, e.g., %srcipv4% or %srcuser%.
+//
+// - A _Framer_ joins the lines of multi-line messages, such as stack traces, into
+// single messages, based on indentation, time stamps or a regular expression. The
+// Scanner keeps the lines after the first one as a %trailer% token, which the Parser
+// adds back to the parsed Sequence and the Analyzer ignores.
 //
 // ### Workflow
 //
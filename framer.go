@@ -0,0 +1,174 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"bufio"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// FramerOptions are the rules a Framer uses to tell the first line of a message from
+// its continuation lines. A line is a continuation line if any of the rules says so.
+// If none of the rules are set, every line is a message.
+type FramerOptions struct {
+	// Indented makes the lines that start with a space or a tab continuation lines,
+	// e.g., the "at ..." lines of a Java stack trace.
+	Indented bool
+
+	// Timestamped makes the lines that don't start with a time stamp continuation
+	// lines, e.g., all the lines of a Python traceback after the first one.
+	Timestamped bool
+
+	// Start makes the lines that don't match it continuation lines. It should match
+	// the start of the first line of each message, e.g., ^\d{4}-\d{2}-\d{2} .
+	Start *regexp.Regexp
+
+	// Scanner is used to recognize the time stamps for Timestamped. If nil, the
+	// builtin TimeFormats are used.
+	Scanner *Scanner
+
+	// MaxLines is the maximum number of lines in a message. Once a message has
+	// MaxLines lines, the next line starts a new message. If 0, there is no limit.
+	MaxLines int
+}
+
+// Framer assembles the lines read by a bufio.Scanner into messages, by joining the
+// continuation lines of a message, e.g., the lines of a stack trace, to the line
+// that starts the message. The lines of a message are separated by \n. The Scanner
+// scans the first line of the message, and keeps the rest as a single %trailer%
+// token, which the Analyzer ignores, and the Parser adds to the end of the pattern
+// sequence. Framer has the same methods as bufio.Scanner, so it can be used in its
+// place:
+//
+//   framer := sequence.NewFramer(bufio.NewScanner(f), sequence.FramerOptions{Indented: true})
+//
+//   for framer.Scan() {
+//   	seq, err := scanner.Scan(framer.Text())
+//   	...
+//   }
+//
+// A message is only complete once the line after it is read, so when following a
+// file as it grows, the last message is returned when the next one starts.
+type Framer struct {
+	lines   *bufio.Scanner
+	opts    FramerOptions
+	timeFsm *timeNode
+
+	// msg is the message being assembled, with n lines
+	msg []string
+	n   int
+
+	// next is the line that was read but belongs to the next message
+	next    string
+	hasNext bool
+
+	text string
+}
+
+// NewFramer returns a Framer that reads the lines from lines, and assembles them
+// into messages using the rules in opts.
+func NewFramer(lines *bufio.Scanner, opts FramerOptions) *Framer {
+	framer := &Framer{
+		lines:   lines,
+		opts:    opts,
+		timeFsm: timeFsmRoot,
+	}
+
+	if opts.Scanner != nil && opts.Scanner.timeFsm != nil {
+		framer.timeFsm = opts.Scanner.timeFsm
+	}
+
+	return framer
+}
+
+// Scan advances the Framer to the next message, which is then available through
+// Text. It returns false when there are no more messages, either because the end
+// of the input is reached, or because of an error, which is returned by Err.
+func (this *Framer) Scan() bool {
+	this.msg, this.n, this.text = this.msg[:0], 0, ""
+
+	for {
+		var line string
+
+		switch {
+		case this.hasNext:
+			line, this.hasNext = this.next, false
+
+		case this.lines.Scan():
+			line = this.lines.Text()
+
+		default:
+			return this.flush()
+		}
+
+		if this.n > 0 && this.continues(line) {
+			this.msg = append(this.msg, line)
+			this.n++
+			continue
+		}
+
+		if this.n > 0 {
+			this.next, this.hasNext = line, true
+			return this.flush()
+		}
+
+		this.msg = append(this.msg, line)
+		this.n++
+	}
+}
+
+// Text returns the most recent message assembled by Scan.
+func (this *Framer) Text() string {
+	return this.text
+}
+
+// Err returns the first error encountered reading the lines, if any.
+func (this *Framer) Err() error {
+	return this.lines.Err()
+}
+
+// flush makes the message assembled so far the current message, and returns false
+// if there is none.
+func (this *Framer) flush() bool {
+	if this.n == 0 {
+		return false
+	}
+
+	this.text = strings.Join(this.msg, "\n")
+	return true
+}
+
+// continues returns true if line is a continuation line of the message being
+// assembled.
+func (this *Framer) continues(line string) bool {
+	if this.opts.MaxLines > 0 && this.n >= this.opts.MaxLines {
+		return false
+	}
+
+	switch {
+	case this.opts.Indented && len(line) > 0 && (line[0] == ' ' || line[0] == '\t'):
+		return true
+
+	case this.opts.Timestamped && timePrefixLen(this.timeFsm, strings.ToLower(strings.TrimLeftFunc(line, unicode.IsSpace))) == 0:
+		return true
+
+	case this.opts.Start != nil && !this.opts.Start.MatchString(line):
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,139 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"bufio"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/dataence/assert"
+)
+
+var framerInput = `Jan 12 06:49:42 app01 java[811]: Exception in thread "main" java.lang.NullPointerException
+	at com.example.Server.handle(Server.java:42)
+	at com.example.Server.main(Server.java:12)
+Jan 12 06:49:43 app01 java[811]: server restarted
+Jan 12 06:49:44 app01 python[900]: request failed
+Traceback (most recent call last):
+  File "app.py", line 10, in <module>
+ValueError: invalid literal for int() with base 10: 'abc'
+Jan 12 06:49:45 app01 python[900]: request done`
+
+func frame(opts FramerOptions) []string {
+	var msgs []string
+
+	framer := NewFramer(bufio.NewScanner(strings.NewReader(framerInput)), opts)
+	for framer.Scan() {
+		msgs = append(msgs, framer.Text())
+	}
+
+	return msgs
+}
+
+func TestFramer(t *testing.T) {
+	lines := strings.Split(framerInput, "\n")
+
+	// No rules, every line is a message
+	assert.Equal(t, true, lines, frame(FramerOptions{}))
+
+	assert.Equal(t, true, []string{
+		strings.Join(lines[0:3], "\n"),
+		lines[3],
+		lines[4],
+		strings.Join(lines[5:7], "\n"),
+		lines[7],
+		lines[8],
+	}, frame(FramerOptions{Indented: true}))
+
+	expected := []string{
+		strings.Join(lines[0:3], "\n"),
+		lines[3],
+		strings.Join(lines[4:8], "\n"),
+		lines[8],
+	}
+
+	assert.Equal(t, true, expected, frame(FramerOptions{Timestamped: true}))
+	assert.Equal(t, true, expected, frame(FramerOptions{Start: regexp.MustCompile(`^[A-Z][a-z]{2} \d+ `)}))
+
+	assert.Equal(t, true, []string{
+		strings.Join(lines[0:2], "\n"),
+		lines[2],
+		lines[3],
+		strings.Join(lines[4:6], "\n"),
+		strings.Join(lines[6:8], "\n"),
+		lines[8],
+	}, frame(FramerOptions{Timestamped: true, MaxLines: 2}))
+}
+
+func TestFramerTrailer(t *testing.T) {
+	msgs := frame(FramerOptions{Timestamped: true})
+
+	seq, err := NewScanner().Scan(msgs[2])
+	assert.NoError(t, true, err)
+
+	trailer := seq[len(seq)-1]
+	assert.Equal(t, true, FieldTrailer, trailer.Field)
+	assert.Equal(t, true, msgs[2][strings.IndexByte(msgs[2], '\n')+1:], trailer.Value)
+	assert.Equal(t, true, trailer.Value, msgs[2][trailer.Start:trailer.End])
+	assert.Equal(t, true, "failed", seq[len(seq)-2].Value)
+
+	// The Parser matches the first line, and adds the trailer to the result
+	pat, err := NewScanner().Scan("%createtime% %apphost% %appname% [ %sessionid% ] : request %status%")
+	assert.NoError(t, true, err)
+
+	parser := NewParser()
+	assert.NoError(t, true, parser.Add(pat))
+
+	pseq, err := parser.Parse(seq)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, len(pat)+1, len(pseq))
+	assert.Equal(t, true, trailer, pseq[len(pseq)-1])
+
+	rec := pseq.Extract()
+	assert.Equal(t, true, "failed", rec.Get(FieldStatus))
+	assert.Equal(t, true, trailer.Value, rec.Get(FieldTrailer))
+
+	// The Analyzer ignores the trailer
+	analyzer := NewAnalyzer()
+
+	for _, msg := range msgs {
+		seq, err := NewScanner().Scan(msg)
+		assert.NoError(t, true, err)
+		assert.NoError(t, true, analyzer.Add(seq))
+	}
+
+	analyzer.Finalize()
+
+	aseq, err := analyzer.Analyze(seq)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, len(seq)-1, len(aseq))
+
+	// Blank lines before the first line are skipped, rather than taken as the first
+	// line of the message
+	for _, data := range []string{
+		"\nJan 12 06:49:42 irc sshd[1]: request failed",
+		"\n  \r\nJan 12 06:49:42 irc sshd[1]: request failed\n\tat main",
+	} {
+		seq, err := NewScanner().Scan(data)
+		assert.NoError(t, true, err, data)
+
+		pseq, err := parser.Parse(seq)
+		assert.NoError(t, true, err, data)
+		assert.Equal(t, true, "failed", pseq.Extract().Get(FieldStatus))
+		assert.Equal(t, true, "Jan", data[seq[0].Start:seq[0].Start+3])
+	}
+}
@@ -0,0 +1,339 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// FieldProposal is a semantic field type that InferFields proposes for one of the
+// tokens in a pattern sequence.
+type FieldProposal struct {
+	// Index is the index of the token in the sequence.
+	Index int
+
+	// Field is the proposed field type.
+	Field FieldType
+
+	// Confidence is how likely the proposal is to be correct, between 0 and 1.
+	Confidence float64
+
+	// Reason is the context the proposal is based on, e.g., "from %ipv4%".
+	Reason string
+}
+
+func (this *FieldProposal) String() string {
+	return fmt.Sprintf("%s %.2f (%s)", this.Field, this.Confidence, this.Reason)
+}
+
+// keyFields are the field types proposed for the value of each key in key=value
+// pairs. The first field type that matches the type of the value is proposed.
+var keyFields = map[string][]FieldType{
+	"src":         {FieldSrcIPv4, FieldSrcIPv6, FieldSrcHost},
+	"srcip":       {FieldSrcIPv4, FieldSrcIPv6},
+	"src_ip":      {FieldSrcIPv4, FieldSrcIPv6},
+	"sip":         {FieldSrcIPv4, FieldSrcIPv6},
+	"saddr":       {FieldSrcIPv4, FieldSrcIPv6},
+	"source":      {FieldSrcIPv4, FieldSrcIPv6, FieldSrcHost},
+	"rhost":       {FieldSrcIPv4, FieldSrcIPv6, FieldSrcHost},
+	"dst":         {FieldDstIPv4, FieldDstIPv6, FieldDstHost},
+	"dstip":       {FieldDstIPv4, FieldDstIPv6},
+	"dst_ip":      {FieldDstIPv4, FieldDstIPv6},
+	"dip":         {FieldDstIPv4, FieldDstIPv6},
+	"daddr":       {FieldDstIPv4, FieldDstIPv6},
+	"destination": {FieldDstIPv4, FieldDstIPv6, FieldDstHost},
+	"sport":       {FieldSrcPort},
+	"spt":         {FieldSrcPort},
+	"srcport":     {FieldSrcPort},
+	"src_port":    {FieldSrcPort},
+	"dport":       {FieldDstPort},
+	"dpt":         {FieldDstPort},
+	"dstport":     {FieldDstPort},
+	"dst_port":    {FieldDstPort},
+	"smac":        {FieldSrcMac},
+	"srcmac":      {FieldSrcMac},
+	"dmac":        {FieldDstMac},
+	"dstmac":      {FieldDstMac},
+	"user":        {FieldDstUser},
+	"duser":       {FieldDstUser},
+	"dstuser":     {FieldDstUser},
+	"username":    {FieldDstUser},
+	"ruser":       {FieldSrcUser},
+	"suser":       {FieldSrcUser},
+	"srcuser":     {FieldSrcUser},
+	"logname":     {FieldSrcUser},
+	"proto":       {FieldProtocol},
+	"protocol":    {FieldProtocol},
+	"policy":      {FieldPolicyID},
+	"policyid":    {FieldPolicyID},
+	"policy_id":   {FieldPolicyID},
+	"rule":        {FieldPolicyID},
+	"action":      {FieldAction},
+	"status":      {FieldStatus},
+	"reason":      {FieldReason},
+	"sent":        {FieldBytesSent},
+	"bytes_sent":  {FieldBytesSent},
+	"rcvd":        {FieldBytesRecv},
+	"bytes_recv":  {FieldBytesRecv},
+	"inpkt":       {FieldPktsRecv},
+	"outpkt":      {FieldPktsSent},
+	"duration":    {FieldDuration},
+	"pid":         {FieldSessionID},
+	"host":        {FieldAppHost},
+	"hostname":    {FieldAppHost},
+}
+
+// InferFields proposes semantic field types for the tokens in a pattern sequence,
+// such as the ones returned by Analyzer.Analyze, based on the context of each token.
+// It looks at
+//
+//   - the syslog header, e.g., %time% %string% sshd [ %integer% ] :, which is
+//     proposed as %createtime% %apphost% %appname% [ %sessionid% ] :
+//   - key names in key=value pairs, e.g., src=, dport= and user=
+//   - the literals around a token, e.g., from %ipv4% port %integer%, which is
+//     proposed as from %srcipv4% port %srcport%
+//
+// There is at most one proposal for each token, which is the one with the highest
+// confidence. The proposals are sorted by the index of the token. Tokens that
+// already have a field type are left alone.
+func InferFields(seq Sequence) []*FieldProposal {
+	props := make(map[int]*FieldProposal)
+
+	propose := func(i int, field FieldType, confidence float64, reason string) {
+		if i < 0 || i >= len(seq) || seq[i].Field != FieldUnknown {
+			return
+		}
+
+		if p, ok := props[i]; !ok || p.Confidence < confidence {
+			props[i] = &FieldProposal{Index: i, Field: field, Confidence: confidence, Reason: reason}
+		}
+	}
+
+	inferHeader(seq, propose)
+
+	// The direction and field of the last IP address seen, so the port after it can
+	// be proposed in the same direction, with the same confidence
+	var (
+		ipdir   string
+		ipfield FieldType
+		ipconf  float64
+		ipidx   int = -1
+		nips    int
+		prevIs  = func(i int, values ...string) bool {
+			if i < 1 || seq[i-1].Type != TokenLiteral {
+				return false
+			}
+
+			for _, v := range values {
+				if seq[i-1].Value == v {
+					return true
+				}
+			}
+
+			return false
+		}
+	)
+
+	for i, token := range seq {
+		if token.Type == TokenLiteral || token.Field != FieldUnknown {
+			continue
+		}
+
+		// key=value pairs, where the key is well known
+		if i >= 2 && prevIs(i, "=") && seq[i-2].Type == TokenLiteral {
+			key := strings.ToLower(seq[i-2].Value)
+			for _, field := range keyFields[key] {
+				if fieldMatchesToken(field, token) {
+					propose(i, field, 0.9, key+"=")
+					break
+				}
+			}
+		}
+
+		switch token.Type {
+		case TokenIPv4, TokenIPv6:
+			src, dst := FieldSrcIPv4, FieldDstIPv4
+			if token.Type == TokenIPv6 {
+				src, dst = FieldSrcIPv6, FieldDstIPv6
+			}
+
+			nips++
+
+			switch {
+			case prevIs(i, "from"):
+				propose(i, src, 0.8, "from "+token.Type.String())
+				ipdir = "src"
+
+			case prevIs(i, "by"):
+				propose(i, src, 0.6, "by "+token.Type.String())
+				ipdir = "src"
+
+			case prevIs(i, "to"):
+				propose(i, dst, 0.7, "to "+token.Type.String())
+				ipdir = "dst"
+
+			case i >= 3 && seq[i-1].Value == ":" && seq[i-3].Type == TokenLiteral && seq[i-3].Value == "to":
+				// to inside:1.2.3.4
+				propose(i, dst, 0.6, "to %string% : "+token.Type.String())
+				ipdir = "dst"
+
+			case nips == 1:
+				propose(i, src, 0.5, "first "+token.Type.String())
+				ipdir = "src"
+
+			case nips == 2:
+				propose(i, dst, 0.5, "second "+token.Type.String())
+				ipdir = "dst"
+
+			default:
+				ipdir = ""
+			}
+
+			ipfield = FieldUnknown
+
+			if p, ok := props[i]; ok {
+				// The key=value proposals decide the direction if there's one
+				if p.Field == FieldSrcIPv4 || p.Field == FieldSrcIPv6 {
+					ipdir = "src"
+				} else if p.Field == FieldDstIPv4 || p.Field == FieldDstIPv6 {
+					ipdir = "dst"
+				}
+
+				ipconf, ipfield = p.Confidence, p.Field
+			}
+
+			ipidx = i
+
+		case TokenInteger:
+			switch {
+			case prevIs(i, "port") && ipidx >= 0 && i-ipidx <= 2:
+				if ipdir == "dst" {
+					propose(i, FieldDstPort, ipconf, "port after "+ipfield.String())
+				} else if ipdir == "src" {
+					propose(i, FieldSrcPort, ipconf, "port after "+ipfield.String())
+				}
+
+			case prevIs(i, "/") && ipidx == i-2:
+				if ipdir == "dst" {
+					propose(i, FieldDstPort, ipconf, ipfield.String()+" / %integer%")
+				} else if ipdir == "src" {
+					propose(i, FieldSrcPort, ipconf, ipfield.String()+" / %integer%")
+				}
+			}
+
+		case TokenString:
+			switch {
+			case prevIs(i, "user"):
+				propose(i, FieldDstUser, 0.6, "user %string%")
+
+			case prevIs(i, "for") && i+1 < len(seq) && seq[i+1].Type == TokenLiteral && seq[i+1].Value == "from":
+				propose(i, FieldDstUser, 0.6, "for %string% from")
+
+			case prevIs(i, "from"):
+				propose(i, FieldSrcHost, 0.5, "from %string%")
+
+			case prevIs(i, "to"):
+				propose(i, FieldDstHost, 0.4, "to %string%")
+
+			case prevIs(i, "proto", "protocol"):
+				propose(i, FieldProtocol, 0.7, seq[i-1].Value+" %string%")
+			}
+		}
+	}
+
+	proposals := make([]*FieldProposal, 0, len(props))
+	for _, p := range props {
+		proposals = append(proposals, p)
+	}
+
+	sort.Sort(fieldProposals(proposals))
+
+	return proposals
+}
+
+// inferHeader proposes the field types of a syslog header at the beginning of the
+// sequence, i.e., %time% host app: or %time% host app[pid]:. The host and app are
+// proposed even if they are literals, since they are usually different for other
+// messages of the same type.
+func inferHeader(seq Sequence, propose func(int, FieldType, float64, string)) {
+	if len(seq) == 0 || seq[0].Type != TokenTime {
+		return
+	}
+
+	isWord := func(i int) bool {
+		return i < len(seq) && (seq[i].Type == TokenString ||
+			(seq[i].Type == TokenLiteral && len(seq[i].Value) > 1))
+	}
+
+	isLiteral := func(i int, v string) bool {
+		return i < len(seq) && seq[i].Type == TokenLiteral && seq[i].Value == v
+	}
+
+	switch {
+	case isWord(1) && isWord(2) && isLiteral(3, "[") && len(seq) > 4 && seq[4].Type == TokenInteger &&
+		isLiteral(5, "]") && isLiteral(6, ":"):
+
+		propose(0, FieldCreateTime, 0.9, "syslog header")
+		propose(1, FieldAppHost, 0.8, "syslog header")
+		propose(2, FieldAppName, 0.8, "syslog header")
+		propose(4, FieldSessionID, 0.8, "syslog header")
+
+	case isWord(1) && isWord(2) && isLiteral(3, ":"):
+		propose(0, FieldCreateTime, 0.9, "syslog header")
+		propose(1, FieldAppHost, 0.8, "syslog header")
+		propose(2, FieldAppName, 0.8, "syslog header")
+
+	default:
+		propose(0, FieldCreateTime, 0.7, "leading %time%")
+	}
+}
+
+// fieldMatchesToken returns true if the value of the token can be of the field type.
+func fieldMatchesToken(field FieldType, token Token) bool {
+	ftype := field.TokenType()
+
+	return ftype == token.Type || (ftype == TokenString && token.Type == TokenLiteral)
+}
+
+// ApplyFields returns a copy of the sequence, where the tokens have the field types
+// proposed, for the proposals with at least the confidence supplied.
+func ApplyFields(seq Sequence, proposals []*FieldProposal, confidence float64) Sequence {
+	seq2 := append(Sequence(nil), seq...)
+
+	for _, p := range proposals {
+		if p.Confidence < confidence || p.Index >= len(seq2) {
+			continue
+		}
+
+		token := &seq2[p.Index]
+		token.Field = p.Field
+
+		// A literal in the syslog header becomes a variable, e.g., sshd becomes
+		// %appname%, so other messages from the same host or app will match
+		if token.Type == TokenLiteral {
+			token.Type = p.Field.TokenType()
+		}
+	}
+
+	return seq2
+}
+
+type fieldProposals []*FieldProposal
+
+func (this fieldProposals) Len() int           { return len(this) }
+func (this fieldProposals) Less(i, j int) bool { return this[i].Index < this[j].Index }
+func (this fieldProposals) Swap(i, j int)      { this[i], this[j] = this[j], this[i] }
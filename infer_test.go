@@ -0,0 +1,84 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"testing"
+
+	"github.com/dataence/assert"
+)
+
+var (
+	inferSamples = map[string]string{
+		"%time% %string% sshd [ %integer% ] : %string% %string% for %string% from %ipv4% port %integer% ssh2":           "%createtime% %apphost% %appname% [ %sessionid% ] : %string% %string% for %dstuser% from %srcipv4% port %srcport% ssh2",
+		"%time% %string% sudo : %string% : tty = %string% ; pwd = %string% ; user = %string% ; command = %string%":      "%createtime% %apphost% %appname% : %string% : tty = %string% ; pwd = %string% ; user = %dstuser% ; command = %string%",
+		"id = %string% proto = %string% src = %ipv4% sport = %integer% dst = %ipv4% dport = %integer% sent = %integer%": "id = %string% proto = %protocol% src = %srcipv4% sport = %srcport% dst = %dstipv4% dport = %dstport% sent = %bytessent%",
+		"%time% connection closed by %ipv6%": "%createtime% connection closed by %srcipv6%",
+		"teardown udp connection %integer% for %string% : %ipv4% / %integer% to %string% : %ipv4% / %integer%": "teardown udp connection %integer% for %string% : %srcipv4% / %srcport% to %string% : %dstipv4% / %dstport%",
+		"%string% = %ipv4%": "%string% = %srcipv4%",
+		"action = %string% rule = %integer% src = %ipv4%": "action = %action% rule = %policyid% src = %srcipv4%",
+	}
+)
+
+func TestInferFields(t *testing.T) {
+	s := NewScanner()
+
+	for pat, annotated := range inferSamples {
+		seq, err := s.Scan(pat)
+		assert.NoError(t, true, err)
+
+		seq2 := ApplyFields(seq, InferFields(seq), 0.5)
+		assert.Equal(t, true, annotated, seq2.String())
+	}
+}
+
+func TestInferFieldsConfidence(t *testing.T) {
+	seq, err := NewScanner().Scan("%time% %string% sshd [ %integer% ] : connection from %ipv4% to %ipv4% port %integer%")
+	assert.NoError(t, true, err)
+
+	proposals := InferFields(seq)
+	assert.Equal(t, true, 7, len(proposals))
+
+	for i := 1; i < len(proposals); i++ {
+		assert.True(t, true, proposals[i-1].Index < proposals[i].Index)
+	}
+
+	p := proposals[4]
+	assert.Equal(t, true, 9, p.Index)
+	assert.Equal(t, true, FieldSrcIPv4, p.Field)
+	assert.Equal(t, true, 0.8, p.Confidence)
+	assert.Equal(t, true, "from %ipv4%", p.Reason)
+
+	// The port follows the direction of the IP address before it
+	p = proposals[6]
+	assert.Equal(t, true, FieldDstPort, p.Field)
+	assert.Equal(t, true, 0.7, p.Confidence)
+
+	// Only the proposals with enough confidence are applied
+	assert.Equal(t, true, "%createtime% %apphost% %appname% [ %sessionid% ] : connection from %srcipv4% to %ipv4% port %integer%",
+		ApplyFields(seq, proposals, 0.75).String())
+
+	// The original sequence is not modified
+	assert.Equal(t, true, FieldUnknown, seq[0].Field)
+
+	// The reasons name the field of the IP address the port follows
+	seq, err = NewScanner().Scan("connection from %ipv6% port %integer% to %ipv6% / %integer%")
+	assert.NoError(t, true, err)
+
+	proposals = InferFields(seq)
+	assert.Equal(t, true, 4, len(proposals))
+	assert.Equal(t, true, "port after %srcipv6%", proposals[1].Reason)
+	assert.Equal(t, true, "%dstipv6% / %integer%", proposals[3].Reason)
+}
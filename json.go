@@ -0,0 +1,185 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// jsonSpace is the whitespace allowed between JSON tokens. Other Unicode spaces are
+// not whitespace in JSON, so they are not skipped either.
+const jsonSpace = " \t\r\n"
+
+// isJSONObject returns true if data, without the surrounding JSON whitespace, is a
+// valid JSON object.
+func isJSONObject(data string) bool {
+	data = strings.Trim(data, jsonSpace)
+	if len(data) < 2 || data[0] != '{' || data[len(data)-1] != '}' {
+		return false
+	}
+
+	return json.Valid([]byte(data))
+}
+
+// tokenizeJSON scans the message, which must be a valid JSON object, into key = value
+// tokens, the same tokens a key=value message is scanned into. Nested objects are
+// flattened into key paths, e.g., {"src":{"ip":"10.1.1.1"}} is scanned into the
+// tokens src.ip, = and 10.1.1.1, where src.ip is a key and 10.1.1.1 is a value.
+func (this *message) tokenizeJSON() {
+	this.state.start = this.jsonSkipSpace(0)
+	this.jsonObject("", "")
+}
+
+// jsonObject scans the object at the cursor, and appends the tokens of its members,
+// with the keys prefixed by path. orig is the path in its original case.
+func (this *message) jsonObject(path, orig string) {
+	// Skip the {
+	this.state.start = this.jsonSkipSpace(this.state.start + 1)
+
+	for this.state.start < len(this.data) && this.data[this.state.start] != '}' {
+		kstart := this.state.start + 1
+		key := this.jsonString()
+		kend := this.state.start - 1
+
+		colon := this.jsonSkipSpace(this.state.start)
+		this.state.start = this.jsonSkipSpace(colon + 1)
+
+		name := Token{
+			Type:     TokenLiteral,
+			Field:    FieldUnknown,
+			Value:    strings.ToLower(path + key),
+			IsKey:    true,
+			Start:    kstart,
+			End:      kend,
+			Original: orig + key,
+		}
+
+		eq := Token{Type: TokenLiteral, Field: FieldUnknown, Value: "=", Start: colon, End: colon + 1, Original: ":"}
+
+		start := this.state.start
+
+		switch this.data[start] {
+		case '{':
+			this.jsonObject(name.Value+".", name.Original+".")
+
+		case '"':
+			v := this.jsonString()
+			this.tokens = append(this.tokens, name, eq, this.valueToken(v, start+1, this.state.start-1))
+
+		case '[':
+			this.jsonSkipValue()
+			v := this.data[start:this.state.start]
+			value := Token{Type: TokenString, Field: FieldUnknown, Value: strings.ToLower(v), IsValue: true,
+				Start: start, End: this.state.start, Original: v}
+			this.tokens = append(this.tokens, name, eq, value)
+
+		default:
+			// Numbers, true, false and null
+			this.jsonSkipValue()
+			v := this.data[start:this.state.start]
+			value := this.valueToken(v, start, this.state.start)
+
+			if value.Type == TokenString && v != "true" && v != "false" && v != "null" {
+				if strings.ContainsAny(v, ".eE") {
+					value.Type = TokenFloat
+				} else {
+					value.Type = TokenInteger
+				}
+			}
+
+			this.tokens = append(this.tokens, name, eq, value)
+		}
+
+		this.state.start = this.jsonSkipSpace(this.state.start)
+		if this.data[this.state.start] == ',' {
+			this.state.start = this.jsonSkipSpace(this.state.start + 1)
+		}
+	}
+
+	// Skip the }
+	this.state.start++
+}
+
+// jsonString returns the string at the cursor, unescaped, and moves the cursor past
+// its closing quote.
+func (this *message) jsonString() string {
+	start, escaped := this.state.start, false
+
+	i := start + 1
+	for ; this.data[i] != '"'; i++ {
+		if this.data[i] == '\\' {
+			escaped = true
+			i++
+		}
+	}
+
+	this.state.start = i + 1
+
+	if !escaped {
+		return this.data[start+1 : i]
+	}
+
+	var s string
+	json.Unmarshal([]byte(this.data[start:i+1]), &s)
+
+	return s
+}
+
+// jsonSkipValue moves the cursor past the value at the cursor.
+func (this *message) jsonSkipValue() {
+	depth := 0
+
+	for this.state.start < len(this.data) {
+		switch c := this.data[this.state.start]; {
+		case c == '"':
+			this.jsonString()
+			if depth == 0 {
+				return
+			}
+			continue
+
+		case c == '[' || c == '{':
+			depth++
+
+		case c == ']' || c == '}':
+			if depth == 0 {
+				return
+			}
+
+			if depth--; depth == 0 {
+				this.state.start++
+				return
+			}
+
+		case c == ',' || strings.IndexByte(jsonSpace, c) >= 0:
+			if depth == 0 {
+				return
+			}
+		}
+
+		this.state.start++
+	}
+}
+
+// jsonSkipSpace returns the index of the first character at or after i that is not
+// JSON whitespace.
+func (this *message) jsonSkipSpace(i int) int {
+	for i < len(this.data) && strings.IndexByte(jsonSpace, this.data[i]) >= 0 {
+		i++
+	}
+
+	return i
+}
@@ -0,0 +1,426 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"fmt"
+	"unicode"
+)
+
+// LintKind is the kind of problem Lint found between two patterns.
+type LintKind int
+
+const (
+	LintDuplicate     LintKind = iota // The patterns are exactly the same, only the first one is used
+	LintNearDuplicate                 // The patterns differ only by punctuation
+	LintShadowed                      // The patterns match the same messages with the same score
+	LintNeverWins                     // The pattern never scores higher than the other pattern
+	LintCollision                     // A %string% in the pattern collides with a literal in the other pattern
+	LintDuplicateID                   // The patterns have the same ID but different sequences
+)
+
+func (this LintKind) String() string {
+	switch this {
+	case LintDuplicate:
+		return "duplicate"
+	case LintNearDuplicate:
+		return "near-duplicate"
+	case LintShadowed:
+		return "shadowed"
+	case LintNeverWins:
+		return "never-wins"
+	case LintCollision:
+		return "collision"
+	case LintDuplicateID:
+		return "duplicate-id"
+	}
+
+	return "unknown"
+}
+
+// LintIssue is a problem found between two patterns.
+type LintIssue struct {
+	// Kind is the kind of problem found.
+	Kind LintKind
+
+	// Pattern is the pattern that has the problem.
+	Pattern *Pattern
+
+	// Other is the pattern that causes the problem.
+	Other *Pattern
+
+	// Index is the index of the %string% token in Pattern that collides with a
+	// literal in Other. It is only used for LintCollision.
+	Index int
+}
+
+func (this *LintIssue) String() string {
+	var desc string
+
+	switch this.Kind {
+	case LintDuplicate:
+		desc = "pattern is a duplicate of another pattern, and will never be used, nor will its ID and directives"
+
+	case LintDuplicateID:
+		desc = "pattern has the same ID as a different pattern, so the parser rejects it"
+
+	case LintNearDuplicate:
+		desc = "pattern differs from another pattern only by punctuation"
+
+	case LintShadowed:
+		desc = "patterns match the same messages with the same score, either one may be returned"
+
+	case LintNeverWins:
+		desc = "pattern never wins, every message it matches is matched at least as well by another pattern"
+
+	case LintCollision:
+		token := this.Pattern.Sequence[this.Index]
+
+		name := token.Type.String()
+		if token.Field != FieldUnknown {
+			name = token.Field.String()
+		}
+
+		desc = fmt.Sprintf("%s at token %d collides with the literal %q in another pattern, which always wins",
+			name, this.Index, this.Other.Sequence[this.Index].Value)
+	}
+
+	return fmt.Sprintf("%s: %s\n    %s (%s)\n    %s (%s)", this.Kind, desc,
+		this.Pattern.Sequence, this.Pattern.ID, this.Other.Sequence, this.Other.ID)
+}
+
+// Lint compares each pair of patterns and returns the problems found. Parser picks
+// the best scoring pattern when a message matches several of them, so patterns that
+// overlap may not match the messages they were written for. Lint finds:
+//
+//   - patterns that are exact duplicates of an earlier pattern
+//   - patterns that differ only by punctuation, which are likely to be mistakes
+//   - patterns that shadow each other, i.e., they match the same messages with the
+//     same score, so which one is returned is undefined
+//   - patterns that can never win, because every message they match is matched at
+//     least as well by another pattern
+//   - %string% tokens that collide with a literal at the same position in another
+//     pattern that is otherwise the same, so messages with that literal always
+//     match the other pattern
+//   - patterns that have the same ID as an earlier pattern with a different
+//     sequence, which Parser.AddPatterns rejects
+//
+// The patterns are compared in pairs, so a pattern that can only be beaten by a
+// combination of other patterns is not reported. Patterns with %field*% or %field+%
+// spans, or with constraints, are only checked for duplicates.
+func Lint(patterns []*Pattern) []*LintIssue {
+	var issues []*LintIssue
+
+	alts := make([][][]lintSlot, len(patterns))
+	for i, pat := range patterns {
+		variants, err := pat.Variants()
+		if err != nil {
+			variants = []Sequence{pat.Sequence}
+		}
+
+		for _, seq := range variants {
+			alts[i] = append(alts[i], lintAlternatives(seq)...)
+		}
+	}
+
+	seqs := make(map[string]*Pattern)
+	near := make(map[string]*Pattern)
+	ids := make(map[string]*Pattern)
+	dups := make(map[*Pattern]bool)
+
+	for _, pat := range patterns {
+		str := pat.Sequence.String()
+		if other, ok := seqs[str]; ok {
+			issues = append(issues, &LintIssue{Kind: LintDuplicate, Pattern: pat, Other: other})
+			dups[pat] = true
+			continue
+		}
+		seqs[str] = pat
+
+		if other, ok := ids[pat.ID]; ok {
+			issues = append(issues, &LintIssue{Kind: LintDuplicateID, Pattern: pat, Other: other})
+		} else {
+			ids[pat.ID] = pat
+		}
+
+		key := withoutPunct(pat.Sequence).String()
+		if other, ok := near[key]; ok {
+			issues = append(issues, &LintIssue{Kind: LintNearDuplicate, Pattern: pat, Other: other})
+		} else {
+			near[key] = pat
+		}
+	}
+
+	for j, b := range patterns {
+		if dups[b] {
+			continue
+		}
+
+		for i, a := range patterns[:j] {
+			if dups[a] || lintOpaque(a.Sequence) || lintOpaque(b.Sequence) {
+				continue
+			}
+
+			ab, ba := lintCovers(alts[i], alts[j]), lintCovers(alts[j], alts[i])
+
+			switch {
+			case ab && ba:
+				issues = append(issues, &LintIssue{Kind: LintShadowed, Pattern: b, Other: a})
+
+			case ab:
+				issues = append(issues, &LintIssue{Kind: LintNeverWins, Pattern: b, Other: a})
+
+			case ba:
+				issues = append(issues, &LintIssue{Kind: LintNeverWins, Pattern: a, Other: b})
+
+			default:
+				for _, k := range lintCollisions(a.Sequence, b.Sequence) {
+					issues = append(issues, &LintIssue{Kind: LintCollision, Pattern: a, Other: b, Index: k})
+				}
+
+				for _, k := range lintCollisions(b.Sequence, a.Sequence) {
+					issues = append(issues, &LintIssue{Kind: LintCollision, Pattern: b, Other: a, Index: k})
+				}
+			}
+		}
+	}
+
+	return issues
+}
+
+// lintSlot is a single message token position of a pattern. A token with a range
+// consumes several message tokens, so it takes up several slots, where all but the
+// first are rest slots.
+type lintSlot struct {
+	Token
+	rest bool
+}
+
+// accept returns the score of the message token in this slot, and whether the slot
+// accepts the message token at all. It follows what Parser does when matching a
+// message.
+func (this lintSlot) accept(token Token) (int, bool) {
+	switch {
+	case this.rest:
+		// The rest of the tokens consumed by a range are not checked or scored
+		return 0, true
+
+	case this.Range > 1:
+		// The parser only visits the node if the first token could match, and then
+		// matches the tokens in the range as a single string
+		if this.Type != TokenString || (token.Type != TokenLiteral && token.Type != TokenString) {
+			return 0, false
+		}
+
+		return fullMatchWeight, true
+	}
+
+	return matchScore(this.Token, token)
+}
+
+// lintAlternatives returns the different slot sequences a pattern variant can
+// take. A range at the end of the pattern can consume fewer tokens than its range,
+// so the pattern has an alternative for each of the number of tokens it consumes.
+// All other ranges consume exactly their range.
+func lintAlternatives(seq Sequence) [][]lintSlot {
+	var slots []lintSlot
+
+	for i, token := range seq {
+		if token.Range <= 1 {
+			slots = append(slots, lintSlot{Token: token})
+			continue
+		}
+
+		if i < len(seq)-1 {
+			slots = append(slots, lintSlot{Token: token})
+			for k := 1; k < token.Range; k++ {
+				slots = append(slots, lintSlot{rest: true})
+			}
+			continue
+		}
+
+		alts := make([][]lintSlot, 0, token.Range)
+		alt := append(slots, lintSlot{Token: token})
+
+		for k := 0; k < token.Range; k++ {
+			alts = append(alts, append([]lintSlot(nil), alt...))
+			alt = append(alt, lintSlot{rest: true})
+		}
+
+		return alts
+	}
+
+	return [][]lintSlot{slots}
+}
+
+// lintCovers returns true if every message matched by one of the alternatives in
+// b is also matched by one of the alternatives in a, with at least the same score.
+func lintCovers(a, b [][]lintSlot) bool {
+	for _, balt := range b {
+		covered := false
+
+		for _, aalt := range a {
+			if len(aalt) == len(balt) && slotsCover(aalt, balt) {
+				covered = true
+				break
+			}
+		}
+
+		if !covered {
+			return false
+		}
+	}
+
+	return true
+}
+
+// slotsCover returns true if every message matched by b is also matched by a, with
+// at least the same score. The slots are independent of each other, so the lowest
+// score difference of a message is the sum of the lowest differences of each slot.
+func slotsCover(a, b []lintSlot) bool {
+	diff := 0
+
+	for i := range b {
+		min, ok := slotCovers(a[i], b[i])
+		if !ok {
+			return false
+		}
+
+		diff += min
+	}
+
+	return diff >= 0
+}
+
+// slotCovers returns whether every message token accepted by b is also accepted
+// by a, and the lowest score difference between a and b for those tokens. Instead
+// of all possible message tokens, it checks one token of each of the kinds the two
+// slots can tell apart.
+func slotCovers(a, b lintSlot) (int, bool) {
+	var (
+		min   int
+		found bool
+	)
+
+	for _, token := range lintTokens(a, b) {
+		bscore, ok := b.accept(token)
+		if !ok {
+			continue
+		}
+
+		ascore, ok := a.accept(token)
+		if !ok {
+			return 0, false
+		}
+
+		if d := ascore - bscore; !found || d < min {
+			min, found = d, true
+		}
+	}
+
+	return min, true
+}
+
+// lintTokens returns the message tokens that are representative of all the message
+// tokens, as far as the two slots are concerned. The literals are not valid field
+// or literal values, so they stand for any other literal.
+func lintTokens(a, b lintSlot) []Token {
+	tokens := []Token{
+		Token{Type: TokenLiteral, Value: "\x00\x00"},
+		Token{Type: TokenLiteral, Value: "\x00"},
+		Token{Type: TokenString},
+		Token{Type: TokenUnknown},
+	}
+
+	for _, s := range []lintSlot{a, b} {
+		if s.rest {
+			continue
+		}
+
+		if s.Type == TokenLiteral {
+			tokens = append(tokens, Token{Type: TokenLiteral, Value: s.Value})
+		} else {
+			tokens = append(tokens, Token{Type: s.Type})
+		}
+	}
+
+	return tokens
+}
+
+// lintCollisions returns the indexes of the %string% tokens in a that collide with
+// a literal in b. It only returns them if every other token in a and b match the
+// same message tokens, because that's when all the messages with the literal are
+// taken by b.
+func lintCollisions(a, b Sequence) []int {
+	if len(a) != len(b) {
+		return nil
+	}
+
+	var idx []int
+
+	for i := range a {
+		if a[i].Range > 1 || b[i].Range > 1 {
+			return nil
+		}
+
+		sa, sb := lintSlot{Token: a[i]}, lintSlot{Token: b[i]}
+
+		if a[i].Type == TokenString && b[i].Type == TokenLiteral {
+			if _, ok := sa.accept(b[i]); ok {
+				idx = append(idx, i)
+				continue
+			}
+		}
+
+		if _, ok := slotCovers(sa, sb); !ok {
+			return nil
+		}
+
+		if _, ok := slotCovers(sb, sa); !ok {
+			return nil
+		}
+	}
+
+	return idx
+}
+
+// lintOpaque returns true if the sequence has tokens the slots can't represent,
+// i.e., tokens with a variable range or a constraint.
+func lintOpaque(seq Sequence) bool {
+	for _, token := range seq {
+		if token.Range == RangeRest || token.Range == RangeSpan || tokenConstraint(token) != "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// withoutPunct returns the sequence without the literals that are a single
+// punctuation character.
+func withoutPunct(seq Sequence) Sequence {
+	var seq2 Sequence
+
+	for _, token := range seq {
+		if token.Type == TokenLiteral && len(token.Value) == 1 && !unicode.IsLetter(rune(token.Value[0])) &&
+			!unicode.IsDigit(rune(token.Value[0])) {
+			continue
+		}
+
+		seq2 = append(seq2, token)
+	}
+
+	return seq2
+}
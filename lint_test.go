@@ -0,0 +1,94 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/dataence/assert"
+)
+
+var (
+	lintSamples = []struct {
+		patterns string
+		issues   []string
+	}{
+		{
+			"connection closed by %srcipv4%\nconnection closed by %srcipv4%",
+			[]string{"duplicate 1 0"},
+		},
+		{
+			"connection closed by %srcipv4%\nconnection closed , by %srcipv4%",
+			[]string{"near-duplicate 1 0"},
+		},
+		{
+			"connection closed by %srcipv4%\nconnection closed by %dstipv4%",
+			[]string{"shadowed 1 0"},
+		},
+		{
+			"connection closed by %string%\nconnection closed by %reason-2%",
+			[]string{"never-wins 0 1"},
+		},
+		{
+			"%string% closed by %srcipv4%\nconnection closed by %srcipv4%",
+			[]string{"collision 0 1 0"},
+		},
+		{
+			"connection closed by %srcipv4%\nconnection closed by %srchost%\nconnection %method-3%",
+			[]string{},
+		},
+		{
+			"#! id: conn\nconnection closed by %srcipv4%\n#! id: conn\nconnection opened by %srcipv4%",
+			[]string{"duplicate-id 1 0"},
+		},
+	}
+)
+
+func TestLint(t *testing.T) {
+	for _, s := range lintSamples {
+		patterns, err := ReadPatterns(strings.NewReader(s.patterns))
+		assert.NoError(t, true, err)
+
+		idx := make(map[*Pattern]int)
+		for i, pat := range patterns {
+			idx[pat] = i
+		}
+
+		issues := Lint(patterns)
+		assert.Equal(t, true, len(s.issues), len(issues))
+
+		for i, issue := range issues {
+			str := fmt.Sprintf("%s %d %d", issue.Kind, idx[issue.Pattern], idx[issue.Other])
+			if issue.Kind == LintCollision {
+				str += fmt.Sprintf(" %d", issue.Index)
+			}
+
+			assert.Equal(t, true, s.issues[i], str)
+		}
+	}
+}
+
+func TestLintAlternatives(t *testing.T) {
+	seq, err := NewScanner().Scan("a %method-3% b %reason-2%")
+	assert.NoError(t, true, err)
+
+	alts := lintAlternatives(seq)
+	assert.Equal(t, true, 2, len(alts))
+	assert.Equal(t, true, 6, len(alts[0]))
+	assert.Equal(t, true, 7, len(alts[1]))
+	assert.Equal(t, true, true, alts[1][6].rest)
+}
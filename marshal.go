@@ -0,0 +1,561 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+
+	"github.com/willf/bitset"
+)
+
+// The compiled parser format starts with parserMagic, followed by the format version
+// as an uvarint. Version 2 is laid out as follows, where all integers are uvarints,
+// and strings are the length followed by the bytes:
+//
+//   height
+//   number of patterns, followed by each pattern:
+//     id, name, msgclass, msgtype, vendor, product
+//     number of tags, followed by each tag
+//     sequence
+//     number of examples, followed by each example
+//   root node, where each node is:
+//     token
+//     leaf flag, 1 if leaf, 0 otherwise
+//     index of the pattern plus 1, 0 if there's no pattern
+//     number of children, followed by the key and node of each child
+//
+// A sequence is the number of tokens, followed by each of the tokens. A token is its
+// type and field names, value, flags (1 if key, 2 if value, 4 if the range is
+// RangeRest, 8 if it is RangeSpan) and range. The names of
+// the types and fields are used so the format does not depend on the order they are
+// declared in.
+//
+// Version 1 is the same, except that it has no spans or constraints, so it can still
+// be read. Version 1 readers can't read version 2, since they would silently ignore
+// the spans and constraints.
+const (
+	parserMagic   = "SEQP"
+	parserVersion = 2
+)
+
+// The saved analyzer format starts with analyzerMagic, followed by the format version
+// as an uvarint. Version 1 is laid out as follows, using the same encoding as the
+// compiled parser format:
+//
+//   number of fixed nodes in each level, i.e., the builtin field and token type nodes
+//   children of the root node
+//   number of levels, followed by each level:
+//     number of nodes, followed by each node:
+//       0 if there's no node, or 1 followed by the node
+//
+// A node is its token, flags (1 if key, 2 if value, 4 if leaf), parents and
+// children. The parents and children are bitsets, encoded as the number of bits set,
+// followed by the difference between each set bit and the previous one. The 0th
+// node of each level is the leaf node, which is never saved.
+const (
+	analyzerMagic   = "SEQA"
+	analyzerVersion = 1
+)
+
+// MarshalBinary encodes the parser tree, including the patterns, into the compiled
+// parser format. The result can be loaded using UnmarshalBinary, which is much
+// faster than scanning and adding the patterns again.
+func (this *Parser) MarshalBinary() ([]byte, error) {
+	tree := this.snapshot()
+
+	w := &binaryWriter{}
+	w.WriteString(parserMagic)
+	w.uvarint(parserVersion)
+	w.uvarint(uint64(tree.height))
+
+	// Number the patterns in the order they are found in the tree, so the nodes can
+	// refer to them by index.
+	pidx := make(map[*Pattern]int)
+	var patterns []*Pattern
+
+	tree.root.walk(func(node *parseNode) {
+		if node.pattern != nil {
+			if _, ok := pidx[node.pattern]; !ok {
+				pidx[node.pattern] = len(patterns)
+				patterns = append(patterns, node.pattern)
+			}
+		}
+	})
+
+	w.uvarint(uint64(len(patterns)))
+	for _, pat := range patterns {
+		w.pattern(pat)
+	}
+
+	w.node(tree.root, pidx)
+
+	return w.Bytes(), nil
+}
+
+// UnmarshalBinary replaces the parser tree with the one encoded in data, which is
+// produced by MarshalBinary. It returns ErrNotCompiled if data is not a compiled
+// parser, and ErrCompiledVersion if it's from an unsupported version of the format.
+func (this *Parser) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, []byte(parserMagic)) {
+		return ErrNotCompiled
+	}
+
+	r := &binaryReader{data: data[len(parserMagic):], corrupt: ErrCompiledCorrupt}
+
+	if r.version = r.uvarint(); r.version != 1 && r.version != parserVersion {
+		if r.err != nil {
+			return r.err
+		}
+
+		return ErrCompiledVersion
+	}
+
+	height := int(r.uvarint())
+
+	n := r.count()
+	patterns := make([]*Pattern, 0, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		patterns = append(patterns, r.pattern())
+	}
+
+	root := r.node(patterns)
+
+	if r.err != nil {
+		return r.err
+	}
+
+	if len(r.data) != 0 {
+		return ErrCompiledCorrupt
+	}
+
+	ids := make(map[string]*Pattern, len(patterns))
+	for _, pat := range patterns {
+		if _, ok := ids[pat.ID]; !ok {
+			ids[pat.ID] = pat
+		}
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.tree.Store(&parseTree{root: root, height: height, ids: ids})
+
+	return nil
+}
+
+// MarshalBinary encodes the analysis tree into the saved analyzer format. It can be
+// called before or after Finalize. The result can be loaded using UnmarshalBinary,
+// and merged with other analyzers using Merge.
+func (this *Analyzer) MarshalBinary() ([]byte, error) {
+	this.mu.RLock()
+	defer this.mu.RUnlock()
+
+	w := &binaryWriter{}
+	w.WriteString(analyzerMagic)
+	w.uvarint(analyzerVersion)
+	w.uvarint(uint64(minFixedChildren))
+	w.bitset(this.root.children)
+	w.uvarint(uint64(len(this.levels)))
+
+	for _, level := range this.levels {
+		w.uvarint(uint64(len(level)))
+
+		for j, node := range level {
+			if j == 0 || node == nil {
+				w.uvarint(0)
+				continue
+			}
+
+			w.uvarint(1)
+			w.token(node.Token)
+
+			var flags uint64
+			if node.isKey {
+				flags |= 1
+			}
+			if node.isValue {
+				flags |= 2
+			}
+			if node.leafNode {
+				flags |= 4
+			}
+
+			w.uvarint(flags)
+			w.bitset(node.parents)
+			w.bitset(node.children)
+		}
+	}
+
+	return w.Bytes(), nil
+}
+
+// UnmarshalBinary replaces the analysis tree with the one encoded in data, which is
+// produced by MarshalBinary. It returns ErrNotAnalyzer if data is not a saved
+// analyzer, and ErrAnalyzerVersion if it's from an unsupported version of the format.
+func (this *Analyzer) UnmarshalBinary(data []byte) error {
+	if !bytes.HasPrefix(data, []byte(analyzerMagic)) {
+		return ErrNotAnalyzer
+	}
+
+	r := &binaryReader{data: data[len(analyzerMagic):], corrupt: ErrAnalyzerCorrupt}
+
+	if r.uvarint() != analyzerVersion {
+		if r.err != nil {
+			return r.err
+		}
+
+		return ErrAnalyzerVersion
+	}
+
+	// The saved levels are read as is, and then merged into an empty analyzer, which
+	// puts the field and token type nodes where they belong in this version.
+	saved := NewAnalyzer()
+	fixed := r.count()
+	saved.root.children = r.bitset()
+
+	n := r.count()
+	for i := 0; i < n && r.err == nil; i++ {
+		level := make([]*analyzerNode, r.count())
+
+		for j := range level {
+			if r.uvarint() == 0 || r.err != nil {
+				continue
+			}
+
+			node := newAnalyzerNode()
+			node.Token = r.token()
+
+			flags := r.uvarint()
+			node.isKey, node.isValue, node.leafNode = flags&1 != 0, flags&2 != 0, flags&4 != 0
+			node.parents, node.children = r.bitset(), r.bitset()
+			node.level, node.index = i, j
+
+			level[j] = node
+		}
+
+		saved.levels = append(saved.levels, level)
+	}
+
+	if r.err != nil {
+		return r.err
+	}
+
+	if len(r.data) != 0 {
+		return ErrAnalyzerCorrupt
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.root, this.leaf = newAnalyzerNode(), newAnalyzerNode()
+	this.root.level = -1
+	this.levels, this.litmaps, this.typmaps, this.nodeCount = nil, nil, nil, nil
+
+	this.mergeFrom(saved, fixed)
+
+	return nil
+}
+
+// walk calls fn for this node and all of its descendants.
+func (this *parseNode) walk(fn func(*parseNode)) {
+	fn(this)
+
+	for _, key := range this.sortedKeys() {
+		this.children[key].walk(fn)
+	}
+}
+
+// sortedKeys returns the keys of the children in sorted order, so the compiled
+// parser is the same every time.
+func (this *parseNode) sortedKeys() []string {
+	keys := make([]string, 0, len(this.children))
+	for key := range this.children {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+type binaryWriter struct {
+	bytes.Buffer
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (this *binaryWriter) uvarint(v uint64) {
+	n := binary.PutUvarint(this.buf[:], v)
+	this.Write(this.buf[:n])
+}
+
+func (this *binaryWriter) string(s string) {
+	this.uvarint(uint64(len(s)))
+	this.WriteString(s)
+}
+
+func (this *binaryWriter) strings(ss []string) {
+	this.uvarint(uint64(len(ss)))
+	for _, s := range ss {
+		this.string(s)
+	}
+}
+
+func (this *binaryWriter) bitset(b *bitset.BitSet) {
+	this.uvarint(uint64(b.Count()))
+
+	var prev uint
+	for i, e := b.NextSet(0); e; i, e = b.NextSet(i + 1) {
+		this.uvarint(uint64(i - prev))
+		prev = i
+	}
+}
+
+func (this *binaryWriter) token(token Token) {
+	this.string(token.Type.String())
+	this.string(token.Field.String())
+	this.string(token.Value)
+
+	var flags uint64
+	if token.IsKey {
+		flags |= 1
+	}
+	if token.IsValue {
+		flags |= 2
+	}
+
+	r := token.Range
+	switch r {
+	case RangeRest:
+		flags, r = flags|4, 0
+	case RangeSpan:
+		flags, r = flags|8, 0
+	}
+
+	this.uvarint(flags)
+	this.uvarint(uint64(r))
+}
+
+func (this *binaryWriter) pattern(pat *Pattern) {
+	this.string(pat.ID)
+	this.string(pat.Name)
+	this.string(pat.MsgClass)
+	this.string(pat.MsgType)
+	this.string(pat.Vendor)
+	this.string(pat.Product)
+	this.strings(pat.Tags)
+
+	this.uvarint(uint64(len(pat.Sequence)))
+	for _, token := range pat.Sequence {
+		this.token(token)
+	}
+
+	this.strings(pat.Examples)
+}
+
+func (this *binaryWriter) node(node *parseNode, pidx map[*Pattern]int) {
+	this.token(node.Token)
+
+	if node.leaf {
+		this.uvarint(1)
+	} else {
+		this.uvarint(0)
+	}
+
+	if i, ok := pidx[node.pattern]; ok {
+		this.uvarint(uint64(i) + 1)
+	} else {
+		this.uvarint(0)
+	}
+
+	keys := node.sortedKeys()
+	this.uvarint(uint64(len(keys)))
+
+	for _, key := range keys {
+		this.string(key)
+		this.node(node.children[key], pidx)
+	}
+}
+
+// binaryReader reads the compiled parser and saved analyzer formats. Once an error
+// is encountered, it is kept in err, and all further reads return zero values.
+type binaryReader struct {
+	data    []byte
+	err     error
+	corrupt error  // the error returned for corrupted data
+	version uint64 // the version of the compiled parser format, 0 for the analyzer
+}
+
+func (this *binaryReader) uvarint() uint64 {
+	if this.err != nil {
+		return 0
+	}
+
+	v, n := binary.Uvarint(this.data)
+	if n <= 0 {
+		this.err = this.corrupt
+		return 0
+	}
+
+	this.data = this.data[n:]
+
+	return v
+}
+
+// count reads a number of items, which can't be more than the bytes left since each
+// item takes at least one byte.
+func (this *binaryReader) count() int {
+	n := this.uvarint()
+	if n > uint64(len(this.data)) {
+		this.err = this.corrupt
+		return 0
+	}
+
+	return int(n)
+}
+
+func (this *binaryReader) string() string {
+	n := this.count()
+	if this.err != nil {
+		return ""
+	}
+
+	s := string(this.data[:n])
+	this.data = this.data[n:]
+
+	return s
+}
+
+func (this *binaryReader) strings() []string {
+	n := this.count()
+	if n == 0 {
+		return nil
+	}
+
+	ss := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		ss = append(ss, this.string())
+	}
+
+	return ss
+}
+
+// maxBitsetBit is the highest bit a saved bitset can have, which is far more than
+// the number of nodes in any level, so corrupted data can't allocate huge bitsets.
+const maxBitsetBit = 1 << 24
+
+func (this *binaryReader) bitset() *bitset.BitSet {
+	b := bitset.New(1)
+
+	n := this.count()
+	var bit uint64
+
+	for i := 0; i < n && this.err == nil; i++ {
+		if bit += this.uvarint(); bit > maxBitsetBit {
+			this.err = this.corrupt
+			break
+		}
+
+		b.Set(uint(bit))
+	}
+
+	return b
+}
+
+func (this *binaryReader) token() Token {
+	var token Token
+
+	tname, fname := this.string(), this.string()
+	if this.err != nil {
+		return token
+	}
+
+	token.Type, token.Field = name2TokenType(tname), field2Token(fname).Field
+	if (token.Type == TokenUnknown && tname != TokenUnknown.String()) ||
+		(token.Field == FieldUnknown && fname != FieldUnknown.String()) {
+
+		this.err = this.corrupt
+		return token
+	}
+
+	token.Value = this.string()
+
+	flags := this.uvarint()
+	if flags&(4|8) != 0 && this.version == 1 {
+		this.err = this.corrupt
+		return token
+	}
+
+	token.IsKey, token.IsValue = flags&1 != 0, flags&2 != 0
+	token.Range = int(this.uvarint())
+
+	switch {
+	case flags&4 != 0:
+		token.Range = RangeRest
+	case flags&8 != 0:
+		token.Range = RangeSpan
+	}
+
+	return token
+}
+
+func (this *binaryReader) pattern() *Pattern {
+	pat := &Pattern{
+		ID:       this.string(),
+		Name:     this.string(),
+		MsgClass: this.string(),
+		MsgType:  this.string(),
+		Vendor:   this.string(),
+		Product:  this.string(),
+		Tags:     this.strings(),
+	}
+
+	n := this.count()
+	for i := 0; i < n && this.err == nil; i++ {
+		pat.Sequence = append(pat.Sequence, this.token())
+	}
+
+	pat.Examples = this.strings()
+
+	return pat
+}
+
+func (this *binaryReader) node(patterns []*Pattern) *parseNode {
+	node := newParseNode()
+	node.Token = this.token()
+	node.leaf = this.uvarint() == 1
+
+	if c := tokenConstraint(node.Token); c != "" {
+		var err error
+		if node.constraint, err = parseConstraint(c); err != nil || this.version == 1 {
+			this.err = this.corrupt
+		}
+	}
+
+	if i := this.uvarint(); i > uint64(len(patterns)) {
+		this.err = this.corrupt
+	} else if i > 0 {
+		node.pattern = patterns[i-1]
+	}
+
+	n := this.count()
+	for i := 0; i < n && this.err == nil; i++ {
+		key := this.string()
+		node.children[key] = this.node(patterns)
+	}
+
+	return node
+}
@@ -16,7 +16,9 @@ package sequence
 
 import (
 	"fmt"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"unicode"
 )
 
@@ -24,17 +26,46 @@ import (
 // based on pattern sequence supplied, and for each message sequence, returns the
 // matching pattern sequence. Each of the message tokens will be marked with the
 // semantic field types.
+//
+// A Parser is safe for concurrent use. Parsing never blocks, even while patterns are
+// being added. The parser tree is never changed once it's built. Instead, adding
+// patterns builds a new tree that shares the unchanged nodes with the current one,
+// and then atomically swaps it in. Each message is parsed using the tree that was
+// current when parsing started, so it never sees a partially built tree.
 type Parser struct {
+	// tree is the current *parseTree
+	tree atomic.Value
+
+	// mu serializes the changes to the tree
+	mu sync.Mutex
+}
+
+// parseTree is a snapshot of the parser tree. Once it's stored in a Parser, neither
+// the tree nor any of its nodes are changed again.
+type parseTree struct {
 	root   *parseNode
 	height int
-	mu     sync.RWMutex
+
+	// ids has the patterns in the tree by their IDs
+	ids map[string]*Pattern
+
+	// gen is the generation of the tree while it's being built. Only the nodes of
+	// the same generation belong to the tree being built and can be changed. The
+	// other nodes are shared with other trees, so they are copied first.
+	gen uint64
 }
 
+// parseTreeGen is the last generation used to build a parser tree.
+var parseTreeGen uint64
+
 type parseNode struct {
 	Token
 
-	leaf     bool
-	children map[string]*parseNode
+	gen        uint64
+	leaf       bool
+	pattern    *Pattern
+	constraint *constraint
+	children   map[string]*parseNode
 }
 
 type stackParseNode struct {
@@ -42,17 +73,35 @@ type stackParseNode struct {
 	level int // current level of the node
 	score int // the score of the path traversed
 	next  int // the next token of the sequence to consume
+	span  int // the number of tokens consumed, if the node is a span
 }
 
 func (this stackParseNode) String() string {
-	return fmt.Sprintf("level=%d, score=%d, next=%d, %s", this.level, this.score, this.next, this.node)
+	return fmt.Sprintf("level=%d, score=%d, next=%d, span=%d, %s", this.level, this.score, this.next, this.span, this.node)
 }
 
 func NewParser() *Parser {
-	return &Parser{
-		root:   newParseNode(),
-		height: 0,
-	}
+	parser := &Parser{}
+	parser.tree.Store(&parseTree{root: newParseNode()})
+	return parser
+}
+
+// snapshot returns the current parser tree.
+func (this *Parser) snapshot() *parseTree {
+	return this.tree.Load().(*parseTree)
+}
+
+// Replace atomically replaces all the patterns in the parser with the ones in other.
+// It's used to swap in a new set of patterns, built using a separate Parser, while
+// messages are being parsed. Both parsers can still be used afterwards, and patterns
+// added to one of them are not added to the other.
+func (this *Parser) Replace(other *Parser) {
+	tree := other.snapshot()
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	this.tree.Store(tree)
 }
 
 func newParseNode() *parseNode {
@@ -66,22 +115,134 @@ func (this *parseNode) String() string {
 }
 
 // Add will add a single pattern sequence to the parser tree. This effectively
-// builds the parser tree so it can be used for parsing later.
+// builds the parser tree so it can be used for parsing later. The ID of the
+// pattern is derived from the pattern sequence.
 func (this *Parser) Add(seq Sequence) error {
+	return this.AddPattern(NewPattern(seq))
+}
+
+// AddPattern will add a single pattern to the parser tree. When a message matches
+// the pattern, Match will return it so the caller knows which pattern matched. If
+// the same pattern sequence has been added before, the first pattern is kept. A
+// pattern with optional tokens or alternatives adds each of its variants to the
+// tree.
+//
+// Each call swaps in a new tree, which copies the nodes along the pattern's path,
+// including their lists of children. So adding a pattern takes time in proportion to
+// the size of the tree, not the pattern. Use AddPatterns to add many patterns, e.g.,
+// a pattern file, which copies each node at most once.
+func (this *Parser) AddPattern(pat *Pattern) error {
+	return this.AddPatterns([]*Pattern{pat})
+}
+
+// AddPatterns is the same as calling AddPattern for each of the patterns, except that
+// all of them become visible to Parse at once. If any of the patterns is invalid, none
+// of them are added. Adding many patterns at once is also much faster, since the new
+// tree is only built and swapped in once.
+//
+// A pattern with the same ID as a pattern with a different sequence, either in the
+// parser or in patterns, is invalid, and ErrDuplicateID is returned. A pattern with
+// the same sequence as a pattern in the parser is a duplicate, so it's ignored,
+// including its ID and the rest of its information. Lint reports both.
+func (this *Parser) AddPatterns(patterns []*Pattern) error {
+	variants := make([][]Sequence, len(patterns))
+
+	for i, pat := range patterns {
+		var err error
+
+		if variants[i], err = pat.Variants(); err != nil {
+			return err
+		}
+
+		for _, token := range pat.Sequence {
+			if isTypeSpan(token) {
+				return ErrInvalidSpan
+			}
+
+			if c := tokenConstraint(token); c != "" {
+				if _, err := parseConstraint(c); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
 	this.mu.Lock()
 	defer this.mu.Unlock()
 
+	cur := this.snapshot()
+	tree := &parseTree{
+		root:   cur.root,
+		height: cur.height,
+		ids:    make(map[string]*Pattern, len(cur.ids)+len(patterns)),
+		gen:    atomic.AddUint64(&parseTreeGen, 1),
+	}
+
+	for id, pat := range cur.ids {
+		tree.ids[id] = pat
+	}
+
+	for _, pat := range patterns {
+		if other, ok := tree.ids[pat.ID]; ok && other.Sequence.String() != pat.Sequence.String() {
+			return ErrDuplicateID
+		}
+
+		if _, ok := tree.ids[pat.ID]; !ok {
+			tree.ids[pat.ID] = pat
+		}
+	}
+
+	for i, pat := range patterns {
+		for _, seq := range variants[i] {
+			tree.addSequence(seq, pat)
+		}
+	}
+
+	this.tree.Store(tree)
+
+	return nil
+}
+
+// isTypeSpan returns true if the token is a span of a token type other than
+// %string%, e.g., %integer+%. The tokens a span consumes are joined into a single
+// string, so they can't be of any other type. A span of a field type, e.g.,
+// %srcport+%, is a string whatever the type of the field is.
+func isTypeSpan(token Token) bool {
+	return (token.Range == RangeRest || token.Range == RangeSpan) &&
+		token.Field == FieldUnknown && token.Type != TokenString
+}
+
+// own returns node if it belongs to the tree being built, otherwise it returns a
+// copy of node that does, so it can be changed.
+func (this *parseTree) own(node *parseNode) *parseNode {
+	if node.gen == this.gen {
+		return node
+	}
+
+	n := *node
+	n.gen = this.gen
+	n.children = make(map[string]*parseNode, len(node.children)+1)
+	for key, child := range node.children {
+		n.children[key] = child
+	}
+
+	return &n
+}
+
+// addSequence adds the pattern sequence to the tree. Each node along the path is
+// copied, unless it already belongs to the tree, since its children change.
+func (this *parseTree) addSequence(seq Sequence, pat *Pattern) {
+	this.root = this.own(this.root)
 	cur := this.root
 
 	for _, token := range seq {
 		var key string
 
-		switch {
-		case token.Field != FieldUnknown:
-			key = token.Field.String()
+		token.Start, token.End, token.Original = 0, 0, ""
 
-		case token.Type != TokenUnknown && token.Type != TokenLiteral:
-			key = token.Type.String()
+		switch {
+		case token.Field != FieldUnknown || (token.Type != TokenUnknown && token.Type != TokenLiteral):
+			key = tokenName(token)
 
 		case token.Type == TokenLiteral:
 			key = token.Value
@@ -90,67 +251,155 @@ func (this *Parser) Add(seq Sequence) error {
 		found, ok := cur.children[key]
 		if !ok {
 			found = newParseNode()
+			found.gen = this.gen
 			found.Token = token
-			cur.children[key] = found
+			if c := tokenConstraint(token); c != "" {
+				found.constraint, _ = parseConstraint(c)
+			}
+		} else {
+			found = this.own(found)
 		}
 
+		cur.children[key] = found
 		cur = found
 	}
 
 	cur.leaf = true
 
+	if cur.pattern == nil {
+		cur.pattern = pat
+	}
+
 	//fmt.Printf("parser.go/AddPattern(): count = %d, height = %d\n", msg.Count(), this.height)
 	if len(seq)+1 > this.height {
 		this.height = len(seq) + 1
 	}
-
-	return nil
 }
 
 // Parse will take the message sequence supplied and go through the parser tree to
 // find the matching pattern sequence. If found, the pattern sequence is returned.
+// Its tokens have the values, offsets and original values of the message tokens they
+// matched, so Original can be used to get the values in their original case.
 func (this *Parser) Parse(seq Sequence) (Sequence, error) {
-	this.mu.RLock()
-	defer this.mu.RUnlock()
+	seq2, _, err := this.Match(seq)
+	return seq2, err
+}
+
+// Match is the same as Parse, but it also returns the Pattern that matched the
+// message sequence.
+func (this *Parser) Match(seq Sequence) (Sequence, *Pattern, error) {
+	return this.MatchInto(nil, seq)
+}
+
+// ParseInto is the same as Parse, but it appends the pattern sequence to dst[:0],
+// so the caller can reuse the same Sequence for each message. Together with
+// Scanner.ScanInto, messages can be parsed without allocating, unless the pattern
+// has a range or a span, whose tokens are joined into a single value.
+func (this *Parser) ParseInto(dst, seq Sequence) (Sequence, error) {
+	dst, _, err := this.MatchInto(dst, seq)
+	return dst, err
+}
+
+// MatchInto is the same as ParseInto, but it also returns the Pattern that matched
+// the message sequence.
+func (this *Parser) MatchInto(dst, seq Sequence) (Sequence, *Pattern, error) {
+	return this.MatchData(dst, seq, "")
+}
 
-	path, err := this.parseMessage(seq)
+// MatchData is the same as MatchInto, but it also takes the message the sequence
+// was scanned from, so the Original of a token that spans several message tokens
+// is the message text from the start of the first token to the end of the last
+// one, spaces included. Without the message, the Originals are joined with a space.
+func (this *Parser) MatchData(dst, seq Sequence, data string) (Sequence, *Pattern, error) {
+	state := parseStatePool.Get().(*parseState)
+	state.data = data
+
+	defer func() {
+		state.data = ""
+		parseStatePool.Put(state)
+	}()
+
+	// The trailer of a multi-line message is not part of the patterns, so the
+	// message is matched without it, and it's added back to the pattern sequence
+	seq, trailer := seq.withoutTrailer()
+
+	path, pat, err := this.snapshot().parseMessage(seq, state)
 	if err != nil {
-		return nil, err
+		if dst != nil {
+			dst = dst[:0]
+		}
+
+		return dst, nil, err
 	}
 
-	seq2 := make(Sequence, 0, len(path))
+	if dst == nil {
+		dst = make(Sequence, 0, len(path))
+	}
+
+	dst = dst[:0]
+
+	for _, n := range path {
+		dst = append(dst, n.Token)
+	}
 
-	for i, n := range path {
-		n.Token.Value, n.Token.IsKey, n.Token.IsValue = seq[i].Value, seq[i].IsKey, seq[i].IsValue
-		seq2 = append(seq2, n.Token)
+	if trailer != nil {
+		dst = append(dst, *trailer)
 	}
 
-	return seq2, nil
+	return dst, pat, nil
 }
 
-func (this *Parser) parseMessage(seq Sequence) ([]parseNode, error) {
+// parseState is the state of parsing a single message. It's kept in parseStatePool
+// so that its buffers are reused by the next message.
+type parseState struct {
+	// path is the path walked so far, best is the best scoring path found so far
+	path, best []parseNode
+
+	// toVisit is the stack of nodes to visit
+	toVisit []stackParseNode
+
+	// data is the message the sequence was scanned from, if it's known
+	data string
+}
+
+var parseStatePool = sync.Pool{
+	New: func() interface{} {
+		return &parseState{}
+	},
+}
+
+// parseMessage returns the best scoring path for the message sequence, and the
+// pattern of the path. The path is only valid until the state is reused.
+func (this *parseTree) parseMessage(seq Sequence, state *parseState) ([]parseNode, *Pattern, error) {
 	var (
 		cur stackParseNode
 
-		// Keep track of the path we have walked
-		path []parseNode = make([]parseNode, len(seq)+1)
+		// Keep track of the path we have walked. A pattern can be longer than the
+		// message if it has spans that consume no tokens.
+		path []parseNode
 
-		// Keeps track of ALL paths of the matched patterns
-		paths [][]parseNode
+		// The pattern of the best path
+		bestPattern *Pattern
 
 		bestScore int
-		bestPath  int
+		found     bool
 	)
 
 	if len(seq) == 0 {
-		return nil, ErrNoMatch
+		return nil, nil, ErrNoMatch
+	}
+
+	if n := len(seq) + this.height + 1; cap(state.path) < n {
+		state.path = make([]parseNode, n)
 	}
 
+	path = state.path[:len(seq)+this.height+1]
+
 	//glog.Debugf("%s", seq.LongString())
 	// toVisit is a stack, children that need to be visited are appended to the end,
 	// and we take children from the end to visit
-	toVisit := make([]stackParseNode, 0, 10)
-	this.addNodesToVisit(&toVisit, stackParseNode{node: this.root}, seq[0])
+	toVisit := state.toVisit[:0]
+	this.addNodesToVisit(&toVisit, stackParseNode{node: this.root}, seq)
 
 	for len(toVisit) > 0 {
 		// pop the last element from the toVisit stack
@@ -161,77 +410,184 @@ func (this *Parser) parseMessage(seq Sequence) ([]parseNode, error) {
 		var token Token
 		var next int
 
-		if cur.node.Token.Range == 0 || cur.node.Token.Range == 1 {
+		switch cur.node.Token.Range {
+		case 0, 1:
 			token = seq[cur.next]
 			token.Range = 1
 			next = cur.next + 1
-		} else {
-			token.Field = cur.node.Token.Field
-			token.Type = TokenString
-			token.Range = 0
 
-			for next = cur.next; next < len(seq) && next < cur.next+cur.node.Token.Range; next++ {
-				token.Value += " " + seq[next].Value
-				token.Range++
+		case RangeRest, RangeSpan:
+			// The number of tokens a span consumes is decided when it's added to
+			// toVisit, and they are matched as a single string
+			token = spanToken(cur.node.Token, seq[cur.next:cur.next+cur.span], state.data)
+			next = cur.next + cur.span
+
+		default:
+			next = cur.next + cur.node.Token.Range
+			if next > len(seq) {
+				next = len(seq)
 			}
+
+			token = spanToken(cur.node.Token, seq[cur.next:next], state.data)
 		}
 
 		//glog.Debugf("token=%s", token)
 
-		switch {
-		case cur.node.Type == token.Type && token.Type != TokenLiteral:
-			cur.score += fullMatchWeight
-
-		case cur.node.Type == TokenString && token.Type == TokenLiteral &&
-			(len(token.Value) != 1 || (len(token.Value) == 1 && unicode.IsLetter(rune(token.Value[0])))):
-			cur.score += partialMatchWeight
+		score, ok := matchScore(cur.node.Token, token)
+		if !ok {
+			continue
+		}
 
-		case token.Type == TokenLiteral && token.Value == cur.node.Value:
-			cur.score += fullMatchWeight
+		// A constrained token rejects the values outside of the constraint, and is a
+		// better match than the same token without a constraint
+		if cur.node.constraint != nil {
+			if !cur.node.constraint.match(token.Value) {
+				continue
+			}
 
-		default:
-			continue
+			score += constraintMatchWeight
 		}
 
+		cur.score += score
+
 		path[cur.level].Token = cur.node.Token
 		path[cur.level].Token.Value = token.Value
-		path[cur.level].Token.Range = cur.node.Range
+		path[cur.level].Token.IsKey = token.IsKey
+		path[cur.level].Token.IsValue = token.IsValue
+		path[cur.level].Token.Start = token.Start
+		path[cur.level].Token.End = token.End
+		path[cur.level].Token.Original = token.Original
 		cur.next = next
 
-		if next >= len(seq) {
-			if cur.node.leaf {
-				//glog.Debugf("Found path")
-				newpath := append(make([]parseNode, 0, cur.level+1), path[1:cur.level+1]...)
-				paths = append(paths, newpath)
-
-				if cur.score > bestScore {
-					bestScore = cur.score
-					bestPath = len(paths) - 1
-				}
+		if next >= len(seq) && cur.node.leaf {
+			//glog.Debugf("Found path")
+			// The first path found is kept unless a later one scores higher
+			if !found || cur.score > bestScore {
+				state.best = append(state.best[:0], path[1:cur.level+1]...)
+				bestPattern = cur.node.pattern
+				bestScore = cur.score
+				found = true
 			}
-
-			continue
 		}
 
 		//toVisit = append(toVisit, this.nodesToVisit(cur, seq[next])...)
-		this.addNodesToVisit(&toVisit, cur, seq[next])
+		this.addNodesToVisit(&toVisit, cur, seq)
 	}
 
-	if len(paths) > bestPath {
-		return paths[bestPath], nil
+	// Keep the stack, which may have grown, for the next message
+	state.toVisit = toVisit
+
+	if found {
+		return state.best, bestPattern, nil
+	}
+
+	return nil, nil, ErrNoMatch
+}
+
+// matchScore returns the score of the message token matching the pattern token,
+// and whether it matches at all. Typed tokens and literals that match exactly are
+// full matches, while literals matching a %string% are partial matches.
+func matchScore(node, token Token) (int, bool) {
+	switch {
+	case node.Range == RangeRest || node.Range == RangeSpan:
+		// Spans match any number of tokens of any type, which are joined into a
+		// single string, so they are only partial matches
+		if token.Type == TokenString {
+			return partialMatchWeight, true
+		}
+
+	case node.Type == token.Type && token.Type != TokenLiteral:
+		return fullMatchWeight, true
+
+	case node.Type == TokenString && token.Type == TokenLiteral &&
+		(len(token.Value) != 1 || (len(token.Value) == 1 && unicode.IsLetter(rune(token.Value[0])))):
+		return partialMatchWeight, true
+
+	case token.Type == TokenLiteral && token.Value == node.Value:
+		return fullMatchWeight, true
 	}
 
-	return nil, ErrNoMatch
+	return 0, false
 }
 
-func (this *Parser) addNodesToVisit(toVisit *[]stackParseNode, cur stackParseNode, next Token) {
+// spanToken returns the message tokens consumed by a node with a range as a single
+// string token. Its Original is data[Start:End], so the spaces between the tokens
+// are kept as they are, or the Originals joined with a space if data is unknown.
+func spanToken(node Token, tokens Sequence, data string) Token {
+	token := Token{Field: node.Field, Type: TokenString, Range: len(tokens)}
+
+	if len(tokens) == 0 {
+		return token
+	}
+
+	values := make([]string, len(tokens))
+	for i, t := range tokens {
+		values[i] = t.Value
+	}
+
+	token.Value = strings.Join(values, " ")
+	token.IsValue = tokens[0].IsValue
+	token.Start, token.End = tokens[0].Start, tokens[len(tokens)-1].End
+
+	if data != "" && token.Start >= 0 && token.Start <= token.End && token.End <= len(data) {
+		token.Original = data[token.Start:token.End]
+	} else {
+		for i, t := range tokens {
+			values[i] = t.Original
+		}
+
+		token.Original = strings.Join(values, " ")
+	}
+
+	return token
+}
+
+// addNodesToVisit adds the children of cur that could match the message tokens
+// starting at cur.next. A span can consume a different number of tokens, so it's
+// added once for each number of tokens it can consume. They are added in the
+// reverse order they should be visited, since toVisit is a stack.
+func (this *parseTree) addNodesToVisit(toVisit *[]stackParseNode, cur stackParseNode, seq Sequence) {
+	remain := len(seq) - cur.next
+
 	for _, node := range cur.node.children {
-		if (node.Type == next.Type && next.Type != TokenLiteral) ||
-			(node.Type == TokenString && next.Type == TokenLiteral) ||
-			(next.Type == TokenLiteral && node.Value == next.Value) {
+		min, max := 1, remain
+		if len(node.children) == 0 {
+			// Nothing follows the span, so it must consume the rest of the message
+			min = max
+		}
+
+		switch node.Range {
+		case RangeRest:
+			if len(node.children) > 0 {
+				min = 0
+			}
+
+			// Visit the longest first, so ties go to the span consuming the most tokens
+			for n := min; n <= max; n++ {
+				*toVisit = append(*toVisit, stackParseNode{node, cur.level + 1, cur.score, cur.next, n})
+			}
 
-			//glog.Debugf("Adding: %s", node)
-			*toVisit = append(*toVisit, stackParseNode{node, cur.level + 1, cur.score, cur.next})
+		case RangeSpan:
+			// Visit the shortest first, so ties go to the span consuming the fewest
+			// tokens, i.e., it stops at the first token that matches the rest
+			for n := max; n >= min && n > 0; n-- {
+				*toVisit = append(*toVisit, stackParseNode{node, cur.level + 1, cur.score, cur.next, n})
+			}
+
+		default:
+			if remain == 0 {
+				continue
+			}
+
+			next := seq[cur.next]
+
+			if (node.Type == next.Type && next.Type != TokenLiteral) ||
+				(node.Type == TokenString && next.Type == TokenLiteral) ||
+				(next.Type == TokenLiteral && node.Value == next.Value) {
+
+				//glog.Debugf("Adding: %s", node)
+				*toVisit = append(*toVisit, stackParseNode{node, cur.level + 1, cur.score, cur.next, 0})
+			}
 		}
 	}
 }
@@ -15,7 +15,17 @@
 package sequence
 
 import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/dataence/assert"
 )
@@ -31,6 +41,7 @@ var (
 		"jan 14 10:15:56 testserver sudo:    gonner : tty=pts/3 ; pwd=/home/gonner ; user=root ; command=/bin/su - ustream":                                                                                                                                                                "%createtime% %apphost% %appname% : %srcuser% : tty = %string% ; pwd = %string% ; user = %dstuser% ; command = %method-10%",
 		"jan 15 19:15:55 jlz sshd[7106]: pam_unix(sshd:auth): authentication failure; logname= uid=0 euid=0 tty=ssh ruser= rhost=188.65.16.110":                                                                                                                                            "%createtime% %apphost% %appname% [ %sessionid% ] : %string% ( sshd : %string% ) : authentication %status% ; logname = %string% = %integer% euid = %integer% tty = %string% ruser = rhost = %srcipv4%",
 		"jan 15 19:25:56 jlz sshd[7774]: pam_unix(sshd:auth): authentication failure; logname= uid=0 euid=0 tty=ssh ruser= rhost=stat.atomsib.net":                                                                                                                                         "%createtime% %apphost% %appname% [ %sessionid% ] : %string% ( sshd : %string% ) : authentication %status% ; logname = %string% = %integer% euid = %integer% tty = %string% ruser = rhost = %srchost%",
+		"jan 15 19:31:02 jlz sshd[7120]: accepted password for root from 2001:db8::1 port 22 ssh2":                                                                                                                                                                                         "%createtime% %apphost% %appname% [ %sessionid% ] : accepted password for %dstuser% from %srcipv6% port %srcport% ssh2",
 	}
 )
 
@@ -55,3 +66,777 @@ func TestParserMatchPatterns(t *testing.T) {
 		assert.Equal(t, true, pat, seq.String())
 	}
 }
+
+func TestParserParseRecord(t *testing.T) {
+	parser := NewParser()
+	msg := &message{}
+
+	patterns := []string{
+		"%createtime% %apphost% %appname% [ %sessionid% ] : accepted password for %dstuser% from %srcipv6% port %srcport% ssh2",
+		"%createtime% %apphost% %appname% : %method% ( %string% : %action% ) : authentication %status% ; logname = %srcuser% uid = %integer% euid = %integer% tty = %string% ruser = %srcuser% rhost = user = %dstuser%",
+		"id = %appname% smac = %srcmac% src = %srcipv4% sent = %bytessent%",
+	}
+
+	for _, pat := range patterns {
+		msg.data = pat
+		err := msg.tokenize()
+		assert.NoError(t, true, err)
+		parser.Add(msg.tokens)
+	}
+
+	msg.data = "jan 15 19:31:02 jlz sshd[7120]: accepted password for root from 2001:db8::1 port 22 ssh2"
+	err := msg.tokenize()
+	assert.NoError(t, true, err)
+
+	rec, err := parser.ParseRecord(msg.tokens)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, int64(7120), rec.Get(FieldSessionID))
+	assert.Equal(t, true, int64(22), rec.Get(FieldSrcPort))
+	assert.Equal(t, true, "root", rec.Get(FieldDstUser))
+	assert.Equal(t, true, "jlz", rec.Get(FieldAppHost))
+	assert.Equal(t, true, net.ParseIP("2001:db8::1"), rec.Get(FieldSrcIPv6))
+	assert.Nil(t, true, rec.Get(FieldSrcIPv4))
+
+	ts, ok := rec.Get(FieldCreateTime).(time.Time)
+	assert.True(t, true, ok)
+	assert.Equal(t, true, time.January, ts.Month())
+	assert.Equal(t, true, 15, ts.Day())
+	assert.Equal(t, true, 19, ts.Hour())
+	assert.Equal(t, true, time.Now().Year(), ts.Year())
+
+	msg.data = "jan 15 14:07:04 testserver sudo: pam_unix(sudo:auth): authentication failure; logname=gonner uid=0 euid=0 tty=/dev/pts/3 ruser=ustream rhost= user=root"
+	err = msg.tokenize()
+	assert.NoError(t, true, err)
+
+	rec, err = parser.ParseRecord(msg.tokens)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, []interface{}{"gonner", "ustream"}, rec[FieldSrcUser])
+	assert.Equal(t, true, "root", rec.Get(FieldDstUser))
+
+	msg.data = "id=firewall smac=00:0b:5f:b2:1d:80 src=210.82.121.91 sent=1770"
+	err = msg.tokenize()
+	assert.NoError(t, true, err)
+
+	rec, err = parser.ParseRecord(msg.tokens)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, net.HardwareAddr{0x00, 0x0b, 0x5f, 0xb2, 0x1d, 0x80}, rec.Get(FieldSrcMac))
+	assert.Equal(t, true, net.ParseIP("210.82.121.91"), rec.Get(FieldSrcIPv4))
+	assert.Equal(t, true, int64(1770), rec.Get(FieldBytesSent))
+}
+
+func TestParserSpans(t *testing.T) {
+	parser := NewParser()
+	msg := &message{}
+
+	patterns := []string{
+		"%createtime% %apphost% %appname% : %srcuser% : tty = %string% ; pwd = %string% ; user = %dstuser% ; command = %method*%",
+		"session ended : %reason+% after %integer% seconds",
+		"session closed %string*%",
+	}
+
+	for _, pat := range patterns {
+		msg.data = pat
+		err := msg.tokenize()
+		assert.NoError(t, true, err)
+		assert.Equal(t, true, pat, msg.tokens.String())
+		parser.Add(msg.tokens)
+	}
+
+	spans := map[string]string{
+		// the rest of the message, no matter how long it is
+		"jan 14 10:15:56 testserver sudo:    gonner : tty=pts/3 ; pwd=/home/gonner ; user=root ; command=/usr/bin/find / -name core -type f -mtime +7 -exec rm -f {} ;": "/usr/bin/find / -name core -type f -mtime + 7 -exec rm -f { } ;",
+
+		// stops at the first "after"
+		"session ended : idle timeout after 300 seconds": "idle timeout",
+
+		// backtracks over an "after" that isn't followed by the rest of the pattern
+		"session ended : killed after restart after 300 seconds": "killed after restart",
+
+		// no tokens at all
+		"session closed":         "",
+		"session closed by peer": "by peer",
+	}
+
+	for data, value := range spans {
+		msg.data = data
+		err := msg.tokenize()
+		assert.NoError(t, true, err)
+
+		seq, err := parser.Parse(msg.tokens)
+		assert.NoError(t, true, err)
+
+		for _, token := range seq {
+			if token.Range == RangeRest || token.Range == RangeSpan {
+				assert.Equal(t, true, value, token.Value)
+			}
+		}
+	}
+
+	msg.data = "session ended : after 300 seconds"
+	assert.NoError(t, true, msg.tokenize())
+
+	_, err := parser.Parse(msg.tokens)
+	assert.Equal(t, true, ErrNoMatch, err)
+
+	data, err := parser.MarshalBinary()
+	assert.NoError(t, true, err)
+
+	parser2 := NewParser()
+	assert.NoError(t, true, parser2.UnmarshalBinary(data))
+
+	msg.data = "session ended : killed after restart after 300 seconds"
+	assert.NoError(t, true, msg.tokenize())
+
+	rec, err := parser2.ParseRecord(msg.tokens)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, "killed after restart", rec.Get(FieldReason))
+
+	// A span of a field whose type isn't a string still matches any tokens
+	seq, err := NewScanner().Scan("allowed ports %srcport+% for %dstuser%")
+	assert.NoError(t, true, err)
+	assert.NoError(t, true, parser.Add(seq))
+
+	msg.data = "allowed ports 22 80 https for root"
+	assert.NoError(t, true, msg.tokenize())
+
+	rec, err = parser.ParseRecord(msg.tokens)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, "22 80 https", rec.Get(FieldSrcPort))
+	assert.Equal(t, true, "root", rec.Get(FieldDstUser))
+
+	// But a span of a token type other than %string% is rejected
+	for _, pat := range []string{"allowed ports %integer+% for %dstuser%", "closed %ipv4*%"} {
+		seq, err := NewScanner().Scan(pat)
+		assert.NoError(t, true, err)
+		assert.Equal(t, true, ErrInvalidSpan, parser.Add(seq))
+	}
+}
+
+func TestParserOriginal(t *testing.T) {
+	parser := NewParser()
+
+	for _, pat := range []string{
+		"%createtime% %apphost% %appname% : accepted password for %dstuser% from %srcipv4%",
+		"%createtime% %apphost% %appname% : session closed %reason*%",
+	} {
+		seq, err := NewScanner().Scan(pat)
+		assert.NoError(t, true, err)
+		assert.NoError(t, true, parser.Add(seq))
+	}
+
+	data := "  Jan 12 06:49:42 WebHost sshd: Accepted password for JDoe from 10.0.0.1"
+
+	msg, err := NewScanner().Scan(data)
+	assert.NoError(t, true, err)
+
+	seq, err := parser.Parse(msg)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, "jdoe", seq[7].Value)
+	assert.Equal(t, true, "JDoe", seq[7].Original)
+	assert.Equal(t, true, "JDoe", data[seq[7].Start:seq[7].End])
+	assert.Equal(t, true, "Jan 12 06:49:42", data[seq[0].Start:seq[0].End])
+
+	rec := seq.Original().Extract()
+	assert.Equal(t, true, "JDoe", rec.Get(FieldDstUser))
+	assert.Equal(t, true, "WebHost", rec.Get(FieldAppHost))
+	assert.Equal(t, true, 6, rec.Get(FieldCreateTime).(time.Time).Hour())
+
+	// A span is the original text of the tokens, including the spaces between them,
+	// and its offsets cover all of them
+	data = "Jan 12 06:49:42 WebHost sshd: session closed by  Remote\tPeer"
+
+	msg, err = NewScanner().Scan(data)
+	assert.NoError(t, true, err)
+
+	seq, _, err = parser.MatchData(nil, msg, data)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, "by remote peer", seq[6].Value)
+	assert.Equal(t, true, "by  Remote\tPeer", seq[6].Original)
+	assert.Equal(t, true, "by  Remote\tPeer", data[seq[6].Start:seq[6].End])
+
+	// Without the message, the Originals of the tokens are joined with a space
+	seq, err = parser.Parse(msg)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, "by Remote Peer", seq[6].Original)
+	assert.Equal(t, true, "by  Remote\tPeer", data[seq[6].Start:seq[6].End])
+
+	msg = Sequence{
+		Token{Type: TokenLiteral, Value: "by", Start: 0, End: 2, Original: "By"},
+		Token{Type: TokenLiteral, Value: "peer", Start: 4, End: 8, Original: "Peer"},
+	}
+	assert.Equal(t, true, "By Peer", spanToken(Token{Range: RangeRest}, msg, "").Original)
+	assert.Equal(t, true, "By  Peer", spanToken(Token{Range: RangeRest}, msg, "By  Peer").Original)
+}
+
+func TestParserConstraints(t *testing.T) {
+	parser := NewParser()
+	msg := &message{}
+
+	patterns := []string{
+		"connection to %dstipv4% port %dstport%",
+		"connection to %dstipv4:10.0.0.0/8% port %dstport%",
+		"connection to %dstipv4% port %dstport:0-1023%",
+		"%action% connection %integer%",
+		"%action:{built,teardown}% connection %integer%",
+		"user %dstuser:len=1-8% logged in",
+	}
+
+	for _, pat := range patterns {
+		msg.data = pat
+		err := msg.tokenize()
+		assert.NoError(t, true, err)
+		assert.Equal(t, true, pat, msg.tokens.String())
+		parser.Add(msg.tokens)
+	}
+
+	matches := map[string]int{
+		"connection to 8.8.8.8 port 8080":      0,
+		"connection to 10.1.2.3 port 8080":     1,
+		"connection to 8.8.8.8 port 53":        2,
+		"closed connection 12":                 3,
+		"Built connection 12":                  4,
+		"teardown connection 12":               4,
+		"user root logged in":                  5,
+		"user averyveryverylongname logged in": -1,
+	}
+
+	for data, i := range matches {
+		msg.data = data
+		err := msg.tokenize()
+		assert.NoError(t, true, err)
+
+		_, pat, err := parser.Match(msg.tokens)
+		if i < 0 {
+			assert.Equal(t, true, ErrNoMatch, err)
+			continue
+		}
+
+		assert.NoError(t, true, err)
+		assert.Equal(t, true, patterns[i], pat.Sequence.String())
+	}
+
+	data, err := parser.MarshalBinary()
+	assert.NoError(t, true, err)
+
+	parser2 := NewParser()
+	assert.NoError(t, true, parser2.UnmarshalBinary(data))
+
+	msg.data = "connection to 10.1.2.3 port 8080"
+	assert.NoError(t, true, msg.tokenize())
+
+	_, pat, err := parser2.Match(msg.tokens)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, patterns[1], pat.Sequence.String())
+
+	for _, pat := range []string{"port %dstport:abc%", "port %dstport:10-1%", "user %dstuser:len=%", "to %dstipv4:{10.0.0.0/8,}%"} {
+		_, err := NewScanner().Scan(pat)
+		assert.Equal(t, true, ErrInvalidConstraint, err)
+	}
+}
+
+func TestRegisterField(t *testing.T) {
+	urlPath, err := RegisterField("url_path", TokenString)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, "%url_path%", urlPath.String())
+	assert.Equal(t, true, TokenString, urlPath.TokenType())
+
+	httpStatus, err := RegisterField("%http_status%", TokenInteger)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, TokenInteger, httpStatus.TokenType())
+
+	// Registering the same field again returns the same field type
+	f, err := RegisterField("url_path", TokenString)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, urlPath, f)
+
+	for _, name := range []string{"", "URL", "url-path", "url path"} {
+		_, err := RegisterField(name, TokenString)
+		assert.Equal(t, true, ErrInvalidField, err)
+	}
+
+	_, err = RegisterField("url_path", TokenInteger)
+	assert.Equal(t, true, ErrFieldExists, err)
+
+	_, err = RegisterField("srcport", TokenString)
+	assert.Equal(t, true, ErrFieldExists, err)
+
+	_, err = RegisterField("ipv4", TokenIPv4)
+	assert.Equal(t, true, ErrFieldExists, err)
+
+	_, err = RegisterField("hash", TokenLiteral)
+	assert.Equal(t, true, ErrInvalidField, err)
+
+	// The Scanner and the Parser
+	pat := "%createtime% %apphost% %appname% : get %url_path% %http_status% %bytessent%"
+
+	seq, err := NewScanner().Scan(pat)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, urlPath, seq[5].Field)
+	assert.Equal(t, true, httpStatus, seq[6].Field)
+	assert.Equal(t, true, pat, seq.String())
+
+	parser := NewParser()
+	assert.NoError(t, true, parser.Add(seq))
+
+	data, err := parser.MarshalBinary()
+	assert.NoError(t, true, err)
+
+	parser2 := NewParser()
+	assert.NoError(t, true, parser2.UnmarshalBinary(data))
+
+	msg, err := NewScanner().Scan("Jan 12 06:49:42 web httpd: GET /index.html 200 1234")
+	assert.NoError(t, true, err)
+
+	for _, p := range []*Parser{parser, parser2} {
+		rec, err := p.ParseRecord(msg)
+		assert.NoError(t, true, err)
+		assert.Equal(t, true, "/index.html", rec.Get(urlPath))
+		assert.Equal(t, true, int64(200), rec.Get(httpStatus))
+	}
+
+	// The Analyzer only has fixed nodes for the builtin types, so it adds the
+	// registered field types after them, once per level, and never merges them
+	analyzer := NewAnalyzer()
+	assert.NoError(t, true, analyzer.Add(seq))
+	assert.NoError(t, true, analyzer.Add(seq))
+	assert.True(t, true, int(urlPath) >= numFieldTypes)
+
+	for i, f := range map[int]FieldType{5: urlPath, 6: httpStatus} {
+		assert.Equal(t, true, minFixedChildren+1, len(analyzer.levels[i]))
+		assert.Equal(t, true, f, analyzer.levels[i][minFixedChildren].Field)
+	}
+
+	other := NewAnalyzer()
+	assert.NoError(t, true, other.Add(seq))
+	assert.NoError(t, true, analyzer.Merge(other))
+	assert.NoError(t, true, analyzer.Finalize())
+	assert.Equal(t, true, minFixedChildren+1, len(analyzer.levels[5]))
+
+	aseq, err := analyzer.Analyze(msg)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, pat, aseq.String())
+}
+
+func TestParserMarshalBinary(t *testing.T) {
+	parser := NewParser()
+	msg := &message{}
+
+	for _, pat := range samples {
+		msg.data = pat
+		err := msg.tokenize()
+		assert.NoError(t, true, err)
+		parser.Add(msg.tokens)
+	}
+
+	patterns, err := ReadPatterns(strings.NewReader(patternFile))
+	assert.NoError(t, true, err)
+
+	for _, pat := range patterns {
+		assert.NoError(t, true, parser.AddPattern(pat))
+	}
+
+	data, err := parser.MarshalBinary()
+	assert.NoError(t, true, err)
+
+	// The same tree always produces the same bytes
+	data2, err := parser.MarshalBinary()
+	assert.NoError(t, true, err)
+	assert.True(t, true, bytes.Equal(data, data2))
+
+	parser2 := NewParser()
+	assert.NoError(t, true, parser2.UnmarshalBinary(data))
+	assert.Equal(t, true, parser.snapshot().height, parser2.snapshot().height)
+
+	for data, pat := range samples {
+		msg.data = data
+		err := msg.tokenize()
+		assert.NoError(t, true, err)
+
+		seq, err := parser2.Parse(msg.tokens)
+		assert.NoError(t, true, err)
+		assert.Equal(t, true, pat, seq.String())
+	}
+
+	msg.data = "Jan 12 06:49:42 irc sshd[7034]: Failed password for root from 218.161.81.238 port 4228 ssh2"
+	assert.NoError(t, true, msg.tokenize())
+
+	_, pat, err := parser2.Match(msg.tokens)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, patterns[0].ID, pat.ID)
+	assert.Equal(t, true, patterns[0].Name, pat.Name)
+	assert.Equal(t, true, patterns[0].Tags, pat.Tags)
+	assert.Equal(t, true, patterns[0].Examples, pat.Examples)
+	assert.Equal(t, true, patterns[0].Sequence, pat.Sequence)
+
+	assert.Equal(t, true, ErrNotCompiled, parser2.UnmarshalBinary([]byte("%createtime% %apphost%")))
+
+	data2 = append([]byte(parserMagic), byte(parserVersion+1))
+	assert.Equal(t, true, ErrCompiledVersion, parser2.UnmarshalBinary(data2))
+
+	// Version 1 is the same without spans and constraints, so it can still be read
+	data2 = append([]byte{}, data...)
+	data2[len(parserMagic)] = 1
+	assert.NoError(t, true, parser2.UnmarshalBinary(data2))
+
+	seq, err := parser2.Parse(msg.tokens)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, patterns[0].Sequence.String(), seq.String())
+
+	// But a version 1 parser can't have spans
+	span, err := NewScanner().Scan("session closed %reason*%")
+	assert.NoError(t, true, err)
+	assert.NoError(t, true, parser.Add(span))
+
+	data2, err = parser.MarshalBinary()
+	assert.NoError(t, true, err)
+	data2[len(parserMagic)] = 1
+	assert.Equal(t, true, ErrCompiledCorrupt, parser2.UnmarshalBinary(data2))
+
+	assert.Equal(t, true, ErrCompiledCorrupt, parser2.UnmarshalBinary(data[:len(data)/2]))
+	assert.Equal(t, true, ErrCompiledCorrupt, parser2.UnmarshalBinary(append(data, 0)))
+
+	// A failed unmarshal leaves the parser as it was
+	_, pat, err = parser2.Match(msg.tokens)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, patterns[0].ID, pat.ID)
+}
+
+// raceEnabled is true if the tests are run with the race detector.
+var raceEnabled bool
+
+func TestParserParseIntoAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocations are not counted with the race detector")
+	}
+
+	parser := NewParser()
+	scanner := NewScanner()
+
+	pat, err := scanner.Scan("%createtime% %apphost% %appname% [ %sessionid% ] : failed password for %dstuser% from %srcipv4% port %srcport% ssh2")
+	assert.NoError(t, true, err)
+	assert.NoError(t, true, parser.Add(pat))
+
+	msg, err := scanner.Scan("jan 12 06:49:42 irc sshd[7034]: failed password for root from 218.161.81.238 port 4228 ssh2")
+	assert.NoError(t, true, err)
+
+	seq, err := parser.ParseInto(nil, msg)
+	assert.NoError(t, true, err)
+
+	expected, err := parser.Parse(msg)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, expected, seq)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		seq, err = parser.ParseInto(seq, msg)
+	})
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, 0.0, allocs)
+
+	msg, err = scanner.Scan("jan 12 06:49:42 irc sshd[7034]: accepted password for root from 218.161.81.238 port 4228 ssh2")
+	assert.NoError(t, true, err)
+
+	seq, err = parser.ParseInto(seq, msg)
+	assert.Equal(t, true, ErrNoMatch, err)
+	assert.Equal(t, true, 0, len(seq))
+}
+
+func benchmarkParser(b *testing.B, into bool) {
+	parser := NewParser()
+	msg := &message{}
+
+	for _, pat := range samples {
+		msg.data = pat
+		if err := msg.tokenize(); err != nil {
+			b.Fatal(err)
+		}
+
+		parser.Add(msg.tokens)
+	}
+
+	var seqs []Sequence
+
+	for data := range samples {
+		seq, err := NewScanner().Scan(data)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		seqs = append(seqs, seq)
+	}
+
+	var (
+		dst Sequence
+		err error
+	)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if into {
+			dst, err = parser.ParseInto(dst, seqs[i%len(seqs)])
+		} else {
+			_, err = parser.Parse(seqs[i%len(seqs)])
+		}
+
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParserParse(b *testing.B) {
+	benchmarkParser(b, false)
+}
+
+func BenchmarkParserParseInto(b *testing.B) {
+	benchmarkParser(b, true)
+}
+
+// benchmarkParserLoad builds a parser from patterns that each start with a different
+// literal, so the root of the tree has a child for each of them.
+func benchmarkParserLoad(b *testing.B, batch bool) {
+	patterns := make([]*Pattern, 2000)
+	for i := range patterns {
+		seq, err := NewScanner().Scan(fmt.Sprintf("event%d from %%srcipv4%% port %%srcport%%", i))
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		patterns[i] = NewPattern(seq)
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		parser := NewParser()
+
+		if batch {
+			if err := parser.AddPatterns(patterns); err != nil {
+				b.Fatal(err)
+			}
+
+			continue
+		}
+
+		for _, pat := range patterns {
+			if err := parser.AddPattern(pat); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func BenchmarkParserAddPattern(b *testing.B) {
+	benchmarkParserLoad(b, false)
+}
+
+func BenchmarkParserAddPatterns(b *testing.B) {
+	benchmarkParserLoad(b, true)
+}
+
+func TestParserJSON(t *testing.T) {
+	parser := NewParser()
+
+	for _, pat := range []string{
+		"%createtime% %apphost% %appname% : accepted password for %dstuser% from %srcipv4%",
+		"ts = %createtime% level = %string% src.ip = %srcipv4% msg = %string%",
+		`{"ts": "%createtime%", "event": "login", "user": {"name": "%dstuser%"}, "src": {"ip": "%srcipv4%", "port": "%srcport%"}}`,
+	} {
+		seq, err := NewScanner().Scan(pat)
+		assert.NoError(t, true, err)
+		assert.NoError(t, true, parser.Add(seq))
+	}
+
+	data := `{"ts": "2023-10-11T22:14:15Z", "event": "login", "user": {"name": "JDoe"}, "src": {"ip": "10.0.0.1", "port": 4228}}`
+
+	msg, err := NewScanner().Scan(data)
+	assert.NoError(t, true, err)
+
+	seq, err := parser.Parse(msg)
+	assert.NoError(t, true, err)
+
+	rec := seq.Original().Extract()
+	assert.Equal(t, true, "JDoe", rec.Get(FieldDstUser))
+	assert.Equal(t, true, int64(4228), rec.Get(FieldSrcPort))
+	assert.Equal(t, true, 22, rec.Get(FieldCreateTime).(time.Time).Hour())
+
+	// The pattern written as key = value pairs matches the JSON messages as well
+	msg, err = NewScanner().Scan(`{"ts": "2023-10-11T22:14:15Z", "level": "error", "src": {"ip": "10.0.0.2"}, "msg": "Disk full"}`)
+	assert.NoError(t, true, err)
+
+	seq, err = parser.Parse(msg)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, FieldSrcIPv4, seq[8].Field)
+	assert.Equal(t, true, "10.0.0.2", seq[8].Value)
+
+	// Text messages are still parsed by the same parser
+	msg, err = NewScanner().Scan("Jan 12 06:49:42 host sshd: Accepted password for jdoe from 10.0.0.1")
+	assert.NoError(t, true, err)
+
+	seq, err = parser.Parse(msg)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, "jdoe", seq.Extract().Get(FieldDstUser))
+}
+
+// eventPattern returns the i'th of a set of patterns that differ only in their
+// event, and a message that matches it.
+func eventPattern(t *testing.T, i int) (*Pattern, Sequence) {
+	seq, err := NewScanner().Scan(fmt.Sprintf("%%createtime%% %%apphost%% event%d from %%srcipv4%%", i))
+	assert.NoError(t, true, err)
+
+	msg, err := NewScanner().Scan(fmt.Sprintf("Jan 12 06:49:42 host event%d from 10.0.0.1", i))
+	assert.NoError(t, true, err)
+
+	return NewPattern(seq), msg
+}
+
+func TestParserConcurrent(t *testing.T) {
+	parser := NewParser()
+
+	pat, msg := eventPattern(t, 0)
+	assert.NoError(t, true, parser.AddPattern(pat))
+
+	old := parser.snapshot()
+
+	var (
+		failed int32
+		wg     sync.WaitGroup
+	)
+
+	done := make(chan struct{})
+
+	// The message keeps matching while patterns are being added
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var seq Sequence
+
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				var err error
+				if seq, err = parser.ParseInto(seq, msg); err != nil || seq[4].Value != "10.0.0.1" {
+					atomic.AddInt32(&failed, 1)
+				}
+			}
+		}()
+	}
+
+	for i := 1; i <= 50; i++ {
+		pat, msg := eventPattern(t, i)
+		assert.NoError(t, true, parser.AddPattern(pat))
+
+		_, err := parser.Parse(msg)
+		assert.NoError(t, true, err)
+	}
+
+	close(done)
+	wg.Wait()
+
+	assert.Equal(t, true, int32(0), failed)
+
+	// The tree before the patterns were added is unchanged
+	_, msg = eventPattern(t, 50)
+	_, _, err := old.parseMessage(msg, &parseState{})
+	assert.Equal(t, true, ErrNoMatch, err)
+
+	// None of the patterns are added if any of them is invalid
+	seq, err := NewScanner().Scan(strings.Repeat("( a | b ) ", 11))
+	assert.NoError(t, true, err)
+
+	pat, msg = eventPattern(t, 100)
+	assert.Equal(t, true, ErrTooManyVariants, parser.AddPatterns([]*Pattern{pat, NewPattern(seq)}))
+
+	_, err = parser.Parse(msg)
+	assert.Equal(t, true, ErrNoMatch, err)
+
+	// Replace swaps in all the patterns of the other parser
+	other := NewParser()
+	pat, msg = eventPattern(t, 200)
+	assert.NoError(t, true, other.AddPattern(pat))
+
+	parser.Replace(other)
+
+	_, err = parser.Parse(msg)
+	assert.NoError(t, true, err)
+
+	_, msg = eventPattern(t, 0)
+	_, err = parser.Parse(msg)
+	assert.Equal(t, true, ErrNoMatch, err)
+
+	// The parsers don't share the patterns added afterwards
+	pat, msg = eventPattern(t, 201)
+	assert.NoError(t, true, parser.AddPattern(pat))
+
+	_, err = other.Parse(msg)
+	assert.Equal(t, true, ErrNoMatch, err)
+}
+
+func TestReloader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sequence")
+	assert.NoError(t, true, err)
+	defer os.RemoveAll(dir)
+
+	write := func(name string, i int) {
+		pat, _ := eventPattern(t, i)
+		assert.NoError(t, true, ioutil.WriteFile(filepath.Join(dir, name), []byte(pat.Sequence.String()+"\n"), 0644))
+	}
+
+	parser := NewParser()
+
+	match := func(i int) error {
+		_, msg := eventPattern(t, i)
+		_, err := parser.Parse(msg)
+		return err
+	}
+
+	write("a.txt", 1)
+
+	reloaded := make(chan error, 10)
+	reloader := NewReloader(parser, func(files []string, err error) {
+		reloaded <- err
+	}, dir)
+	defer reloader.Close()
+
+	assert.NoError(t, true, reloader.Reload())
+	assert.NoError(t, true, match(1))
+
+	wait := func() error {
+		select {
+		case err := <-reloaded:
+			return err
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timeout waiting for reload")
+		}
+
+		return nil
+	}
+
+	reloader.Watch(10 * time.Millisecond)
+
+	write("b.txt", 2)
+	assert.NoError(t, true, wait())
+	assert.NoError(t, true, match(1))
+	assert.NoError(t, true, match(2))
+
+	// The patterns are kept if any of the files is invalid
+	assert.NoError(t, true, ioutil.WriteFile(filepath.Join(dir, "c.txt"), []byte("#! color: red\n"), 0644))
+	assert.NotNil(t, true, wait())
+	assert.NoError(t, true, match(1))
+	assert.NoError(t, true, match(2))
+
+	assert.NoError(t, true, os.Remove(filepath.Join(dir, "c.txt")))
+	assert.NoError(t, true, wait())
+
+	assert.NoError(t, true, os.Remove(filepath.Join(dir, "a.txt")))
+	assert.NoError(t, true, wait())
+	assert.Equal(t, true, ErrNoMatch, match(1))
+	assert.NoError(t, true, match(2))
+}
@@ -0,0 +1,605 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"strings"
+)
+
+// Pattern is a pattern sequence along with the information that identifies it. When
+// a message is parsed, the Parser reports the Pattern that matched, so that the
+// message can be routed or classified based on the pattern ID instead of comparing
+// the output of Sequence.String().
+type Pattern struct {
+	// ID is the stable identity of the pattern. If the pattern file does not supply
+	// one, the ID is derived from a hash of the pattern sequence.
+	ID string
+
+	// Name is a human readable name of the pattern.
+	Name string
+
+	// MsgClass and MsgType classify the type of message the pattern matches.
+	MsgClass string
+	MsgType  string
+
+	// Vendor and Product identify the source of the messages the pattern matches.
+	Vendor  string
+	Product string
+
+	// Tags are free-form labels attached to the pattern.
+	Tags []string
+
+	// Sequence is the pattern sequence itself.
+	Sequence Sequence
+
+	// Examples are the example messages listed in the comments right after the
+	// pattern. They are expected to parse to this pattern.
+	Examples []string
+}
+
+// NewPattern returns a Pattern for the sequence supplied, with the ID derived from
+// the pattern sequence. The offsets and original values of the tokens are dropped.
+func NewPattern(seq Sequence) *Pattern {
+	return &Pattern{
+		ID:       patternID(seq),
+		Sequence: seq.withoutOffsets(),
+	}
+}
+
+func (this *Pattern) String() string {
+	return fmt.Sprintf("{ ID=%q, Name=%q, MsgClass=%q, MsgType=%q, Vendor=%q, Product=%q, Tags=%q, Pattern=%q }",
+		this.ID, this.Name, this.MsgClass, this.MsgType, this.Vendor, this.Product, this.Tags, this.Sequence)
+}
+
+// ReadPatterns reads a pattern file and returns the list of patterns in it. Each line
+// in the file that is not empty and does not start with # is a pattern. Lines that
+// start with # are comments, except for the lines that start with #!, which are
+// directives that set the information for the pattern that immediately follows.
+// For example:
+//
+//   #! id: sshd-failed-password
+//   #! name: Failed password for user
+//   #! msgclass: authentication
+//   #! msgtype: failure
+//   #! vendor: openbsd
+//   #! product: openssh
+//   #! tags: auth, ssh
+//   %createtime% %apphost% %appname% [ %sessionid% ] : failed password for %dstuser% from %srcipv4% port %srcport% ssh2
+//
+// Patterns without directives are still valid, and their IDs are derived from the
+// pattern sequence.
+//
+// Comments that immediately follow a pattern, up to the next empty line, directive
+// or pattern, are examples of the messages the pattern should match. This is the
+// format the analyzer writes its patterns in:
+//
+//   %createtime% %apphost% %appname% [ %sessionid% ] : connection closed by %srcipv4%
+//   # Jan 12 06:49:42 irc sshd[7034]: Connection closed by 218.161.81.238
+//
+// The examples can be checked using CheckExamples.
+func ReadPatterns(r io.Reader) ([]*Pattern, error) {
+	var (
+		patterns []*Pattern
+		pat      *Pattern = &Pattern{}
+		last     *Pattern
+		lineno   int
+	)
+
+	s := NewScanner()
+	ls := bufio.NewScanner(r)
+
+	for ls.Scan() {
+		line := strings.TrimSpace(ls.Text())
+		lineno++
+
+		switch {
+		case len(line) == 0:
+			last = nil
+
+		case strings.HasPrefix(line, "#!"):
+			last = nil
+			if err := pat.setDirective(line[2:]); err != nil {
+				return nil, fmt.Errorf("sequence: line %d: %v", lineno, err)
+			}
+
+		case line[0] == '#':
+			if last != nil {
+				if ex := strings.TrimSpace(line[1:]); ex != "" {
+					last.Examples = append(last.Examples, ex)
+				}
+			}
+
+		default:
+			seq, err := s.Scan(line)
+			if err != nil {
+				return nil, fmt.Errorf("sequence: line %d: %v", lineno, err)
+			}
+
+			if _, err := sequenceVariants(seq); err != nil {
+				return nil, fmt.Errorf("sequence: line %d: %v", lineno, err)
+			}
+
+			pat.Sequence = seq.withoutOffsets()
+			if pat.ID == "" {
+				pat.ID = patternID(seq)
+			}
+
+			patterns = append(patterns, pat)
+			last, pat = pat, &Pattern{}
+		}
+	}
+
+	if err := ls.Err(); err != nil {
+		return nil, err
+	}
+
+	return patterns, nil
+}
+
+// ExampleFailure is an example message of a pattern that did not parse to the
+// pattern it belongs to.
+type ExampleFailure struct {
+	// Pattern is the pattern the example belongs to.
+	Pattern *Pattern
+
+	// Example is the example message.
+	Example string
+
+	// Matched is the pattern the example matched instead. It is nil if the example
+	// did not match any pattern.
+	Matched *Pattern
+
+	// Err is the error returned when scanning or parsing the example.
+	Err error
+}
+
+// Diff returns a word diff between the expected pattern and the pattern that was
+// matched instead, where removed tokens are marked as [-token-] and added tokens
+// are marked as {+token+}. It returns an empty string if no pattern was matched.
+func (this *ExampleFailure) Diff() string {
+	if this.Matched == nil {
+		return ""
+	}
+
+	return wordDiff(strings.Fields(this.Pattern.Sequence.String()), strings.Fields(this.Matched.Sequence.String()))
+}
+
+func (this *ExampleFailure) String() string {
+	str := fmt.Sprintf("example: %s\nexpected: %s (%s)\n", this.Example, this.Pattern.Sequence, this.Pattern.ID)
+
+	if this.Matched == nil {
+		return str + fmt.Sprintf("error: %v", this.Err)
+	}
+
+	return str + fmt.Sprintf("matched: %s (%s)\ndiff: %s", this.Matched.Sequence, this.Matched.ID, this.Diff())
+}
+
+// CheckExamples scans and parses the examples of each of the patterns, and returns
+// the examples that did not parse to their own pattern. The parser should already
+// have all the patterns added, otherwise the examples will not be able to match
+// them.
+//
+// An example is considered to match its own pattern if the pattern matched has the
+// same ID, so examples of duplicate patterns without IDs still pass.
+func CheckExamples(parser *Parser, patterns []*Pattern) []*ExampleFailure {
+	var failures []*ExampleFailure
+
+	s := NewScanner()
+
+	for _, pat := range patterns {
+		for _, ex := range pat.Examples {
+			seq, err := s.Scan(ex)
+			if err != nil {
+				failures = append(failures, &ExampleFailure{Pattern: pat, Example: ex, Err: err})
+				continue
+			}
+
+			_, matched, err := parser.Match(seq)
+			if err != nil {
+				failures = append(failures, &ExampleFailure{Pattern: pat, Example: ex, Err: err})
+				continue
+			}
+
+			if matched.ID != pat.ID {
+				failures = append(failures, &ExampleFailure{Pattern: pat, Example: ex, Matched: matched})
+			}
+		}
+	}
+
+	return failures
+}
+
+// wordDiff returns the words in a and b, with the words only in a marked as
+// [-word-], and the words only in b marked as {+word+}. Consecutive changes are
+// grouped together.
+func wordDiff(a, b []string) string {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var (
+		words          []string
+		removed, added []string
+	)
+
+	flush := func() {
+		if len(removed) > 0 {
+			words = append(words, "[-"+strings.Join(removed, " ")+"-]")
+		}
+
+		if len(added) > 0 {
+			words = append(words, "{+"+strings.Join(added, " ")+"+}")
+		}
+
+		removed, added = nil, nil
+	}
+
+	i, j := 0, 0
+
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			flush()
+			words = append(words, a[i])
+			i++
+			j++
+
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			removed = append(removed, a[i])
+			i++
+
+		default:
+			added = append(added, b[j])
+			j++
+		}
+	}
+
+	flush()
+
+	return strings.Join(words, " ")
+}
+
+func (this *Pattern) setDirective(d string) error {
+	i := strings.IndexByte(d, ':')
+	if i < 0 {
+		return fmt.Errorf("invalid directive %q, should be in the form of \"#! key: value\"", d)
+	}
+
+	k, v := strings.ToLower(strings.TrimSpace(d[:i])), strings.TrimSpace(d[i+1:])
+
+	switch k {
+	case "id":
+		this.ID = v
+
+	case "name":
+		this.Name = v
+
+	case "msgclass":
+		this.MsgClass = v
+
+	case "msgtype":
+		this.MsgType = v
+
+	case "vendor":
+		this.Vendor = v
+
+	case "product":
+		this.Product = v
+
+	case "tags":
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				this.Tags = append(this.Tags, t)
+			}
+		}
+
+	default:
+		return fmt.Errorf("unknown directive %q", k)
+	}
+
+	return nil
+}
+
+// maxVariants is the maximum number of variants a pattern can expand into.
+const maxVariants = 1024
+
+// Variants returns the sequences the pattern matches, one for each combination of
+// its optional tokens and alternatives. Tokens surrounded by "[" and "]?" are
+// optional, and tokens surrounded by "(" and ")" and separated by "|" are
+// alternatives. For example, the following pattern has four variants:
+//
+//   %createtime% %apphost% %appname% [ %sessionid% ] : ( accepted | failed ) password for %dstuser% [ , ]? from %srcipv4%
+//
+// Brackets that are not followed by "?", and parentheses without a "|" in them, are
+// literals, e.g., the brackets around %sessionid% above. Any of ( ) | [ ] ? preceded
+// by a backslash is a literal as well, e.g., \( a \| b \) matches "( a | b )". See
+// Sequence.Escape.
+func (this *Pattern) Variants() ([]Sequence, error) {
+	return sequenceVariants(this.Sequence)
+}
+
+// patternSyntax are the literals that can have a meaning in a pattern, and can be
+// escaped using a backslash.
+var patternSyntax = map[string]bool{"(": true, ")": true, "|": true, "[": true, "]": true, "?": true, "\\": true}
+
+// Escape returns a copy of the sequence where the literals that would be read as
+// optional tokens or alternatives, if the sequence is written as a pattern, are
+// escaped using a backslash, e.g., \( and \|. So are the backslashes before any
+// of ( ) | [ ] ?. The sequences returned by Analyzer.Analyze should be escaped
+// before they are written to a pattern file, since messages can contain these
+// literals, e.g., "[ a ]?".
+func (this Sequence) Escape() Sequence {
+	seq := append(Sequence(nil), this...)
+
+	for i := 0; i < len(seq)-1; i++ {
+		if isLiteral(seq[i], "\\") && seq[i+1].Type == TokenLiteral && patternSyntax[seq[i+1].Value] {
+			seq[i].Value = "\\\\"
+		}
+	}
+
+	// Once the outermost groups are escaped, the tokens inside them can form groups
+	// of their own, so they are escaped as well.
+	for marks := syntaxTokens(seq); len(marks) > 0; marks = syntaxTokens(seq) {
+		for _, i := range marks {
+			seq[i].Value = "\\" + seq[i].Value
+		}
+	}
+
+	return seq
+}
+
+// syntaxTokens returns the indexes of the literals that start, separate and end the
+// outermost optional tokens and alternatives of the sequence.
+func syntaxTokens(seq Sequence) []int {
+	var marks []int
+
+	for i := 0; i < len(seq); i++ {
+		switch {
+		case isLiteral(seq[i], "["):
+			j := closingToken(seq, i, "[", "]")
+			if j < 0 || j+1 >= len(seq) || !isLiteral(seq[j+1], "?") {
+				continue
+			}
+
+			marks, i = append(marks, i, j, j+1), j+1
+
+		case isLiteral(seq[i], "("):
+			j := closingToken(seq, i, "(", ")")
+			if j < 0 {
+				continue
+			}
+
+			seps := alternativeSeparators(seq[i+1 : j])
+			if len(seps) == 0 {
+				continue
+			}
+
+			marks = append(marks, i, j)
+			for _, k := range seps {
+				marks = append(marks, i+1+k)
+			}
+
+			i = j
+		}
+	}
+
+	return marks
+}
+
+// isEscaped returns true if the token is an escaped literal, e.g., \(.
+func isEscaped(token Token) bool {
+	return token.Type == TokenLiteral && len(token.Value) >= 2 && token.Value[0] == '\\' &&
+		patternSyntax[token.Value[1:]]
+}
+
+// sequenceVariants returns the variants of the pattern sequence, where the escaped
+// literals are unescaped.
+func sequenceVariants(seq Sequence) ([]Sequence, error) {
+	// The Scanner splits \( into two tokens, which are joined first, so the literal
+	// is not taken as the start of a group
+	joined := make(Sequence, 0, len(seq))
+
+	for i := 0; i < len(seq); i++ {
+		if isLiteral(seq[i], "\\") && i+1 < len(seq) && seq[i+1].Type == TokenLiteral && patternSyntax[seq[i+1].Value] {
+			token := seq[i+1]
+			token.Value, token.Start, token.Original = "\\"+token.Value, seq[i].Start, seq[i].Original+token.Original
+			joined = append(joined, token)
+			i++
+			continue
+		}
+
+		joined = append(joined, seq[i])
+	}
+
+	variants, err := expandSequence(joined)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each of the variants has its own copy of the tokens
+	for _, v := range variants {
+		for i := range v {
+			if isEscaped(v[i]) {
+				v[i].Value = v[i].Value[1:]
+			}
+		}
+	}
+
+	return variants, nil
+}
+
+// expandSequence returns the variants of the pattern sequence. See Pattern.Variants.
+func expandSequence(seq Sequence) ([]Sequence, error) {
+	variants := []Sequence{Sequence{}}
+
+	for i := 0; i < len(seq); i++ {
+		var alts []Sequence
+
+		switch {
+		case isLiteral(seq[i], "["):
+			j := closingToken(seq, i, "[", "]")
+			if j < 0 || j+1 >= len(seq) || !isLiteral(seq[j+1], "?") {
+				break
+			}
+
+			inner, err := expandSequence(seq[i+1 : j])
+			if err != nil {
+				return nil, err
+			}
+
+			alts, i = append(inner, Sequence{}), j+1
+
+		case isLiteral(seq[i], "("):
+			j := closingToken(seq, i, "(", ")")
+			if j < 0 {
+				break
+			}
+
+			branches := splitAlternatives(seq[i+1 : j])
+			if len(branches) < 2 {
+				break
+			}
+
+			for _, branch := range branches {
+				inner, err := expandSequence(branch)
+				if err != nil {
+					return nil, err
+				}
+
+				alts = append(alts, inner...)
+			}
+
+			i = j
+		}
+
+		if alts == nil {
+			alts = []Sequence{seq[i : i+1]}
+		}
+
+		if len(variants)*len(alts) > maxVariants {
+			return nil, ErrTooManyVariants
+		}
+
+		product := make([]Sequence, 0, len(variants)*len(alts))
+		seen := make(map[string]bool)
+
+		for _, v := range variants {
+			for _, a := range alts {
+				v2 := append(append(make(Sequence, 0, len(v)+len(a)), v...), a...)
+
+				// Leaving out an empty group gives the same variant more than once
+				if str := v2.String(); !seen[str] {
+					seen[str] = true
+					product = append(product, v2)
+				}
+			}
+		}
+
+		variants = product
+	}
+
+	return variants, nil
+}
+
+// isLiteral returns true if the token is the literal value.
+func isLiteral(token Token, value string) bool {
+	return token.Type == TokenLiteral && token.Value == value
+}
+
+// closingToken returns the index of the close literal that matches the open literal
+// at seq[i], or -1 if there isn't one.
+func closingToken(seq Sequence, i int, open, close string) int {
+	depth := 0
+
+	for j := i; j < len(seq); j++ {
+		switch {
+		case isLiteral(seq[j], open):
+			depth++
+
+		case isLiteral(seq[j], close):
+			if depth--; depth == 0 {
+				return j
+			}
+		}
+	}
+
+	return -1
+}
+
+// splitAlternatives splits the sequence at each "|" that is not inside another
+// group.
+func splitAlternatives(seq Sequence) []Sequence {
+	var (
+		branches []Sequence
+		start    int
+	)
+
+	for _, i := range alternativeSeparators(seq) {
+		branches = append(branches, seq[start:i])
+		start = i + 1
+	}
+
+	return append(branches, seq[start:])
+}
+
+// alternativeSeparators returns the indexes of each "|" that is not inside another
+// group.
+func alternativeSeparators(seq Sequence) []int {
+	var (
+		seps  []int
+		depth int
+	)
+
+	for i, token := range seq {
+		switch {
+		case isLiteral(token, "(") || isLiteral(token, "["):
+			depth++
+
+		case isLiteral(token, ")") || isLiteral(token, "]"):
+			depth--
+
+		case isLiteral(token, "|") && depth == 0:
+			seps = append(seps, i)
+		}
+	}
+
+	return seps
+}
+
+// patternID returns an ID for the pattern sequence, which is the FNV-1a hash of
+// the pattern string. The same pattern will always have the same ID.
+func patternID(seq Sequence) string {
+	h := fnv.New64a()
+	io.WriteString(h, seq.String())
+	return fmt.Sprintf("%016x", h.Sum64())
+}
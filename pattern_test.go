@@ -0,0 +1,335 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dataence/assert"
+)
+
+var (
+	patternFile = `
+# patterns for sshd
+
+#! id: sshd-failed-password
+#! name: Failed password for user
+#! msgclass: authentication
+#! msgtype: failure
+#! vendor: openbsd
+#! product: openssh
+#! tags: auth, ssh,
+%createtime% %apphost% %appname% [ %sessionid% ] : failed password for %dstuser% from %srcipv4% port %srcport% ssh2
+# Jan 12 06:49:42 irc sshd[7034]: Failed password for root from 218.161.81.238 port 4228 ssh2
+
+%createtime% %apphost% %appname% [ %sessionid% ] : connection closed by %srcipv4%
+`
+
+	examplesFile = `
+%createtime% %apphost% %appname% [ %sessionid% ] : connection closed by %srcipv4%
+# Jan 12 06:49:42 irc sshd[7034]: Connection closed by 218.161.81.238
+# Jan 12 06:49:43 irc sshd[7035]: Connection closed by 10.1.1.1
+
+#! id: sshd-closed-host
+%createtime% %apphost% %appname% [ %sessionid% ] : connection closed by %srchost%
+# Jan 12 06:49:44 irc sshd[7036]: Connection closed by stat.atomsib.net
+# Jan 12 06:49:45 irc sshd[7037]: Connection closed by 10.1.1.2
+# Jan 12 06:49:46 irc sshd[7038]: Received disconnect from 10.1.1.3
+`
+)
+
+func TestReadPatterns(t *testing.T) {
+	patterns, err := ReadPatterns(strings.NewReader(patternFile))
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, 2, len(patterns))
+
+	pat := patterns[0]
+	assert.Equal(t, true, "sshd-failed-password", pat.ID)
+	assert.Equal(t, true, "Failed password for user", pat.Name)
+	assert.Equal(t, true, "authentication", pat.MsgClass)
+	assert.Equal(t, true, "failure", pat.MsgType)
+	assert.Equal(t, true, "openbsd", pat.Vendor)
+	assert.Equal(t, true, "openssh", pat.Product)
+	assert.Equal(t, true, []string{"auth", "ssh"}, pat.Tags)
+	assert.Equal(t, true, "%createtime% %apphost% %appname% [ %sessionid% ] : failed password for %dstuser% from %srcipv4% port %srcport% ssh2", pat.Sequence.String())
+	assert.Equal(t, true, []string{"Jan 12 06:49:42 irc sshd[7034]: Failed password for root from 218.161.81.238 port 4228 ssh2"}, pat.Examples)
+
+	// The directives only apply to the pattern that immediately follows
+	pat = patterns[1]
+	assert.Equal(t, true, patternID(pat.Sequence), pat.ID)
+	assert.Equal(t, true, 16, len(pat.ID))
+	assert.Equal(t, true, "", pat.Name)
+	assert.Equal(t, true, 0, len(pat.Tags))
+	assert.Equal(t, true, 0, len(pat.Examples))
+
+	_, err = ReadPatterns(strings.NewReader("#! owner: me\n%string%"))
+	assert.NotNil(t, true, err)
+
+	_, err = ReadPatterns(strings.NewReader("#! id sshd-001\n%string%"))
+	assert.NotNil(t, true, err)
+}
+
+func TestReadPatternFiles(t *testing.T) {
+	for _, fname := range []string{"patterns/asa.txt", "patterns/sshd.txt", "patterns/sudo.txt"} {
+		f, err := os.Open(fname)
+		assert.NoError(t, true, err)
+
+		patterns, err := ReadPatterns(f)
+		f.Close()
+		assert.NoError(t, true, err)
+		assert.True(t, true, len(patterns) > 0)
+	}
+}
+
+func TestParserMatchPatternID(t *testing.T) {
+	parser := NewParser()
+
+	patterns, err := ReadPatterns(strings.NewReader(patternFile))
+	assert.NoError(t, true, err)
+
+	for _, pat := range patterns {
+		assert.NoError(t, true, parser.AddPattern(pat))
+	}
+
+	msg := &message{}
+	msg.data = "Jan 12 06:49:42 irc sshd[7034]: Failed password for root from 218.161.81.238 port 4228 ssh2"
+	assert.NoError(t, true, msg.tokenize())
+
+	seq, pat, err := parser.Match(msg.tokens)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, "sshd-failed-password", pat.ID)
+	assert.Equal(t, true, pat.Sequence.String(), seq.String())
+
+	msg.data = "Jan 12 06:49:42 irc sshd[7034]: Connection closed by 218.161.81.238"
+	assert.NoError(t, true, msg.tokenize())
+
+	_, pat, err = parser.Match(msg.tokens)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, patterns[1].ID, pat.ID)
+
+	// Adding a pattern with the same sequence keeps the first pattern
+	assert.NoError(t, true, parser.Add(patterns[0].Sequence))
+
+	msg.data = "Jan 12 06:49:42 irc sshd[7034]: Failed password for root from 218.161.81.238 port 4228 ssh2"
+	assert.NoError(t, true, msg.tokenize())
+
+	_, pat, err = parser.Match(msg.tokens)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, "sshd-failed-password", pat.ID)
+
+	msg.data = "Jan 12 06:49:42 irc sshd[7034]: Received disconnect from 218.161.81.238"
+	assert.NoError(t, true, msg.tokenize())
+
+	_, pat, err = parser.Match(msg.tokens)
+	assert.Equal(t, true, ErrNoMatch, err)
+	assert.Nil(t, true, pat)
+}
+
+func TestParserDuplicateID(t *testing.T) {
+	read := func(data string) []*Pattern {
+		patterns, err := ReadPatterns(strings.NewReader(data))
+		assert.NoError(t, true, err)
+		return patterns
+	}
+
+	closed := "#! id: conn\n%createtime% %apphost% %appname% : connection closed by %srcipv4%\n"
+	opened := "#! id: conn\n%createtime% %apphost% %appname% : connection opened by %srcipv4%\n"
+
+	msg, err := NewScanner().Scan("Jan 12 06:49:42 irc sshd: connection opened by 10.0.0.1")
+	assert.NoError(t, true, err)
+
+	// Patterns with the same ID and different sequences are rejected, whether they
+	// are added together or one after the other, e.g., from different files
+	parser := NewParser()
+	assert.Equal(t, true, ErrDuplicateID, parser.AddPatterns(read(closed+opened)))
+
+	_, err = parser.Parse(msg)
+	assert.Equal(t, true, ErrNoMatch, err)
+
+	assert.NoError(t, true, parser.AddPatterns(read(closed)))
+	assert.Equal(t, true, ErrDuplicateID, parser.AddPatterns(read(opened)))
+
+	// The IDs are kept in the compiled parser
+	data, err := parser.MarshalBinary()
+	assert.NoError(t, true, err)
+
+	parser2 := NewParser()
+	assert.NoError(t, true, parser2.UnmarshalBinary(data))
+	assert.Equal(t, true, ErrDuplicateID, parser2.AddPatterns(read(opened)))
+
+	// The same pattern can be added again, e.g., from a file loaded twice
+	assert.NoError(t, true, parser.AddPatterns(read(closed)))
+
+	// A pattern with the same sequence is a duplicate, and the first pattern is kept
+	assert.NoError(t, true, parser.AddPatterns(read(strings.Replace(opened, "conn", "conn-opened", 1))))
+	assert.NoError(t, true, parser.AddPatterns(read(strings.Replace(opened, "conn", "conn-opened-again", 1))))
+
+	_, pat, err := parser.Match(msg)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, "conn-opened", pat.ID)
+}
+
+func TestPatternVariants(t *testing.T) {
+	samples := map[string][]string{
+		"error retrieving information about user %dstuser% [ , ]?": []string{
+			"error retrieving information about user %dstuser% ,",
+			"error retrieving information about user %dstuser%",
+		},
+		"%appname% [ %sessionid% ] : ( accepted | failed ) password": []string{
+			"%appname% [ %sessionid% ] : accepted password",
+			"%appname% [ %sessionid% ] : failed password",
+		},
+		"a [ b ( c | d ) ]? ( e | ) f": []string{
+			"a b c e f",
+			"a b c f",
+			"a b d e f",
+			"a b d f",
+			"a e f",
+			"a f",
+		},
+		"a ( b ) [ c ] d": []string{
+			"a ( b ) [ c ] d",
+		},
+	}
+
+	for pat, expected := range samples {
+		seq, err := NewScanner().Scan(pat)
+		assert.NoError(t, true, err)
+		assert.Equal(t, true, pat, seq.String())
+
+		variants, err := NewPattern(seq).Variants()
+		assert.NoError(t, true, err)
+
+		var actual []string
+		for _, v := range variants {
+			actual = append(actual, v.String())
+		}
+
+		assert.Equal(t, true, expected, actual)
+	}
+
+	seq, err := NewScanner().Scan(strings.Repeat("( a | b ) ", 11))
+	assert.NoError(t, true, err)
+
+	_, err = NewPattern(seq).Variants()
+	assert.Equal(t, true, ErrTooManyVariants, err)
+
+	parser := NewParser()
+	seq, err = NewScanner().Scan("%createtime% %apphost% %appname% [ %sessionid% ] : ( accepted | failed ) password for %dstuser% [ , ]? from %srcipv4%")
+	assert.NoError(t, true, err)
+
+	pat := NewPattern(seq)
+	assert.NoError(t, true, parser.AddPattern(pat))
+
+	for _, data := range []string{
+		"Jan 12 06:49:42 irc sshd[7034]: Failed password for root from 218.161.81.238",
+		"Jan 12 06:49:42 irc sshd[7034]: Accepted password for root, from 218.161.81.238",
+	} {
+		msg, err := NewScanner().Scan(data)
+		assert.NoError(t, true, err)
+
+		_, matched, err := parser.Match(msg)
+		assert.NoError(t, true, err)
+		assert.Equal(t, true, pat.ID, matched.ID)
+	}
+}
+
+func TestPatternEscape(t *testing.T) {
+	parser := NewParser()
+
+	for data, expected := range map[string]string{
+		"menu ( file | edit ) opened":          `menu \( file \| edit \) opened`,
+		"option [ -v ]? given":                 `option \[ -v \] \? given`,
+		"nested ( a [ b ]? | c ) done":         `nested \( a \[ b \] \? \| c \) done`,
+		"path c:\\(x86) [ a ]?":                `path c : \\ ( x86 ) \[ a \] \?`,
+		"Jan 12 06:49:42 irc app[1]: ( done )": "%time% irc app [ %integer% ] : ( done )",
+	} {
+		msg, err := NewScanner().Scan(data)
+		assert.NoError(t, true, err)
+
+		escaped := msg.Escape()
+		assert.Equal(t, true, expected, escaped.String())
+
+		// Reading the escaped sequence back as a pattern gives the same sequence
+		patterns, err := ReadPatterns(strings.NewReader(escaped.String()))
+		assert.NoError(t, true, err)
+
+		variants, err := patterns[0].Variants()
+		assert.NoError(t, true, err)
+		assert.Equal(t, true, 1, len(variants))
+		assert.Equal(t, true, msg.String(), variants[0].String())
+
+		assert.NoError(t, true, parser.AddPattern(patterns[0]))
+
+		_, pat, err := parser.Match(msg)
+		assert.NoError(t, true, err)
+		assert.Equal(t, true, patterns[0].ID, pat.ID)
+	}
+
+	// The message is not changed
+	msg, err := NewScanner().Scan("( a | b )")
+	assert.NoError(t, true, err)
+
+	msg.Escape()
+	assert.Equal(t, true, "( a | b )", msg.String())
+}
+
+func TestCheckExamples(t *testing.T) {
+	parser := NewParser()
+
+	patterns, err := ReadPatterns(strings.NewReader(examplesFile))
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, 2, len(patterns))
+	assert.Equal(t, true, 2, len(patterns[0].Examples))
+	assert.Equal(t, true, 3, len(patterns[1].Examples))
+
+	for _, pat := range patterns {
+		assert.NoError(t, true, parser.AddPattern(pat))
+	}
+
+	failures := CheckExamples(parser, patterns)
+	assert.Equal(t, true, 2, len(failures))
+
+	// An IPv4 address is a better match for the %srcipv4% pattern
+	f := failures[0]
+	assert.Equal(t, true, "sshd-closed-host", f.Pattern.ID)
+	assert.Equal(t, true, "Jan 12 06:49:45 irc sshd[7037]: Connection closed by 10.1.1.2", f.Example)
+	assert.Equal(t, true, patterns[0].ID, f.Matched.ID)
+	assert.Equal(t, true, "%createtime% %apphost% %appname% [ %sessionid% ] : connection closed by [-%srchost%-] {+%srcipv4%+}", f.Diff())
+
+	f = failures[1]
+	assert.Equal(t, true, "Jan 12 06:49:46 irc sshd[7038]: Received disconnect from 10.1.1.3", f.Example)
+	assert.Nil(t, true, f.Matched)
+	assert.Equal(t, true, ErrNoMatch, f.Err)
+	assert.Equal(t, true, "", f.Diff())
+}
+
+func TestWordDiff(t *testing.T) {
+	samples := []struct {
+		a, b, diff string
+	}{
+		{"a b c", "a b c", "a b c"},
+		{"a b c", "a x c", "a [-b-] {+x+} c"},
+		{"a b c d", "a d", "a [-b c-] d"},
+		{"a d", "a b c d", "a {+b c+} d"},
+		{"", "a", "{+a+}"},
+	}
+
+	for _, s := range samples {
+		assert.Equal(t, true, s.diff, wordDiff(strings.Fields(s.a), strings.Fields(s.b)))
+	}
+}
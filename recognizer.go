@@ -0,0 +1,324 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"strings"
+	"unicode"
+)
+
+// TokenRecognizer recognizes a lexical type of token that the Scanner does not know
+// about, such as a UUID or an email address. Recognizers are added with their own
+// TokenType using RegisterTokenType.
+type TokenRecognizer interface {
+	// Recognize returns the length, in bytes, of the token at the start of data, or
+	// 0 if data does not start with a token it recognizes. The token should end at
+	// the end of a word, e.g., before a space or punctuation.
+	Recognize(data string) int
+}
+
+// TokenRecognizerFunc is a function that can be used as a TokenRecognizer.
+type TokenRecognizerFunc func(data string) int
+
+// Recognize calls this(data).
+func (this TokenRecognizerFunc) Recognize(data string) int {
+	return this(data)
+}
+
+// The following recognizers can be registered using RegisterTokenType, under the
+// names of the application's choosing. None of them are registered by default.
+var (
+	// UUIDRecognizer recognizes UUIDs, e.g., 123e4567-e89b-12d3-a456-426614174000.
+	UUIDRecognizer TokenRecognizer = TokenRecognizerFunc(recognizeUUID)
+
+	// HashRecognizer recognizes hex encoded MD5, SHA-1, SHA-224, SHA-256, SHA-384
+	// and SHA-512 hashes, i.e., 32, 40, 56, 64, 96 or 128 hex digits.
+	HashRecognizer TokenRecognizer = TokenRecognizerFunc(recognizeHash)
+
+	// EmailRecognizer recognizes email addresses, e.g., jdoe@example.com.
+	EmailRecognizer TokenRecognizer = TokenRecognizerFunc(recognizeEmail)
+
+	// FQDNRecognizer recognizes host names with at least one dot, where the last
+	// label is made up of letters, e.g., www.example.com.
+	FQDNRecognizer TokenRecognizer = TokenRecognizerFunc(recognizeFQDN)
+
+	// PathRecognizer recognizes absolute file paths, e.g., /usr/bin/find, ~/.ssh or
+	// C:\Windows\System32.
+	PathRecognizer TokenRecognizer = TokenRecognizerFunc(recognizePath)
+
+	// HexRecognizer recognizes hex numbers that start with 0x, e.g., 0x1f.
+	HexRecognizer TokenRecognizer = TokenRecognizerFunc(recognizeHex)
+
+	// DurationRecognizer recognizes durations made up of numbers and units, e.g.,
+	// 250ms, 1.5s or 1h30m. The units are ns, us, ms, s, m, h and d.
+	DurationRecognizer TokenRecognizer = TokenRecognizerFunc(recognizeDuration)
+)
+
+// RegisterTokenType adds a new token type with the name and the recognizer for its
+// tokens. The Scanner runs the recognizers alongside its own, and the longest token
+// wins. If a recognizer and the Scanner find tokens of the same length, the
+// recognizer wins if the Scanner's is a literal. If several recognizers find tokens
+// of the same length, the one registered first wins. The name follows the same rules
+// as the names of field types. For example:
+//
+//   TokenUUID, err := sequence.RegisterTokenType("uuid", sequence.UUIDRecognizer)
+//
+// The new token type can be used in patterns, e.g., %uuid%, and in field types
+// registered using RegisterField. Token types should be registered before any
+// messages or patterns that use them are scanned.
+func RegisterTokenType(name string, r TokenRecognizer) (TokenType, error) {
+	name = "%" + strings.Trim(name, "%") + "%"
+
+	if !validTypeName(name) || r == nil {
+		return TokenUnknown, ErrInvalidTokenType
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if field2Token(name).Field != FieldUnknown || name == FieldUnknown.String() ||
+		name == TokenUnknown.String() || name2TokenType(name) != TokenUnknown {
+
+		return TokenUnknown, ErrTokenTypeExists
+	}
+
+	types := loadTokenTypes()
+
+	if len(types) >= maxTokenTypes {
+		return TokenUnknown, ErrTooManyTokenTypes
+	}
+
+	t := TokenType(len(types))
+	tokenTypes.Store(append(types[:t:t], tokenType{name, r}))
+
+	return t, nil
+}
+
+// recognizeToken runs the registered recognizers on data, and returns the length and
+// the type of the longest token found, or 0 if none of them found a token.
+func recognizeToken(data string) (int, TokenType) {
+	tokenTypes := loadTokenTypes()
+
+	var (
+		l int
+		t TokenType
+	)
+
+	for i := token__END__; int(i) < len(tokenTypes); i++ {
+		if n := tokenTypes[i].recognizer.Recognize(data); n > l && n <= len(data) {
+			l, t = n, i
+		}
+	}
+
+	return l, t
+}
+
+// wordEnd returns n if the token of length n at the start of data ends a word, i.e.,
+// it's followed by the end of data, a space or a punctuation other than the extra
+// characters supplied, or 0 otherwise.
+func wordEnd(data string, n int, extra string) int {
+	if n == 0 || n > len(data) {
+		return 0
+	}
+
+	if n < len(data) {
+		r := rune(data[n])
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune(extra, r) {
+			return 0
+		}
+	}
+
+	return n
+}
+
+func isHex(r byte) bool {
+	return (r >= '0' && r <= '9') || (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F')
+}
+
+// hexLen returns the number of hex digits at the start of data.
+func hexLen(data string) int {
+	n := 0
+	for n < len(data) && isHex(data[n]) {
+		n++
+	}
+
+	return n
+}
+
+func recognizeUUID(data string) int {
+	i := 0
+
+	for g, l := range []int{8, 4, 4, 4, 12} {
+		if g > 0 {
+			if i == len(data) || data[i] != '-' {
+				return 0
+			}
+			i++
+		}
+
+		if hexLen(data[i:]) < l {
+			return 0
+		}
+		i += l
+	}
+
+	return wordEnd(data, i, "-")
+}
+
+func recognizeHash(data string) int {
+	switch n := hexLen(data); n {
+	case 32, 40, 56, 64, 96, 128:
+		return wordEnd(data, n, "")
+	}
+
+	return 0
+}
+
+func recognizeEmail(data string) int {
+	i := 0
+	for i < len(data) && (isWordByte(data[i]) || strings.IndexByte(".%+-", data[i]) >= 0) {
+		i++
+	}
+
+	if i == 0 || i == len(data) || data[i] != '@' {
+		return 0
+	}
+
+	if n := recognizeFQDN(data[i+1:]); n > 0 {
+		return i + 1 + n
+	}
+
+	return 0
+}
+
+func recognizeFQDN(data string) int {
+	var (
+		i, labels, last int
+		alpha           bool
+	)
+
+	for {
+		start := i
+		alpha = true
+
+		for i < len(data) && (isWordByte(data[i]) && data[i] != '_' || data[i] == '-') {
+			alpha = alpha && unicode.IsLetter(rune(data[i]))
+			i++
+		}
+
+		if i == start || data[start] == '-' || data[i-1] == '-' {
+			return 0
+		}
+
+		labels++
+		last = start
+
+		// The host name ends at the first character that's not part of a label, or
+		// at a dot that's not followed by a label, e.g., at the end of a sentence
+		if i+1 >= len(data) || data[i] != '.' || !isWordByte(data[i+1]) {
+			break
+		}
+
+		i++
+	}
+
+	if labels < 2 || !alpha || i-last < 2 {
+		return 0
+	}
+
+	return wordEnd(data, i, "-")
+}
+
+func recognizePath(data string) int {
+	var start int
+
+	switch {
+	case strings.HasPrefix(data, "/"):
+		start = 1
+
+	case strings.HasPrefix(data, "~/"):
+		start = 2
+
+	case len(data) > 3 && unicode.IsLetter(rune(data[0])) && data[1] == ':' && data[2] == '\\':
+		start = 3
+
+	default:
+		return 0
+	}
+
+	i := start
+	for i < len(data) && !unicode.IsSpace(rune(data[i])) && strings.IndexByte("\"'<>|", data[i]) < 0 {
+		i++
+	}
+
+	// Punctuation at the end is more likely to belong to the message than the path
+	for i > start && strings.IndexByte(",;:.)]}", data[i-1]) >= 0 {
+		i--
+	}
+
+	if i == start {
+		return 0
+	}
+
+	return i
+}
+
+func recognizeHex(data string) int {
+	if len(data) < 3 || data[0] != '0' || (data[1] != 'x' && data[1] != 'X') {
+		return 0
+	}
+
+	if n := hexLen(data[2:]); n > 0 {
+		return wordEnd(data, n+2, "")
+	}
+
+	return 0
+}
+
+func recognizeDuration(data string) int {
+	i := 0
+
+	for i < len(data) && data[i] >= '0' && data[i] <= '9' {
+		start := i
+
+		for i < len(data) && ((data[i] >= '0' && data[i] <= '9') || data[i] == '.') {
+			i++
+		}
+
+		if data[i-1] == '.' || strings.Count(data[start:i], ".") > 1 {
+			return 0
+		}
+
+		unit := 0
+		for _, u := range []string{"ns", "us", "ms", "s", "m", "h", "d"} {
+			if strings.HasPrefix(data[i:], u) {
+				unit = len(u)
+				break
+			}
+		}
+
+		if unit == 0 {
+			return 0
+		}
+
+		i += unit
+	}
+
+	return wordEnd(data, i, "")
+}
+
+func isWordByte(r byte) bool {
+	return r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Record is the set of semantic fields extracted from a parsed message, keyed by
+// FieldType. Since a pattern can contain the same field more than once, e.g., the
+// two %srcuser% fields in some of the sudo patterns, each field is a list of values
+// in the order they appeared in the message.
+//
+// The values are converted to Go types based on the token type of the field:
+//
+//   - TokenIPv4 and TokenIPv6 are converted to net.IP
+//   - TokenInteger is converted to int64
+//   - TokenFloat is converted to float64
+//   - TokenTime is converted to time.Time
+//   - TokenMac is converted to net.HardwareAddr
+//   - everything else, including values that fail to convert, are kept as string
+type Record map[FieldType][]interface{}
+
+// Get returns the first value of the field, or nil if the field does not exist.
+func (this Record) Get(f FieldType) interface{} {
+	if v := this[f]; len(v) > 0 {
+		return v[0]
+	}
+
+	return nil
+}
+
+// Extract returns a Record of all the tokens in the sequence that have a known
+// FieldType. It is typically called on the Sequence returned by Parser.Parse. Time
+// stamps are converted using the builtin TimeFormats, and are in UTC if they don't
+// have a time zone. If the message was scanned by a Scanner with its own time formats,
+// epoch window or Location, use Scanner.Extract instead.
+func (this Sequence) Extract() Record {
+	return this.extract(parseTime)
+}
+
+// Extract is the same as Sequence.Extract, except that time stamps are converted
+// using ParseTime, so the time formats, epoch window and Location of the Scanner that
+// scanned the message are used.
+func (this Scanner) Extract(seq Sequence) Record {
+	return seq.extract(this.ParseTime)
+}
+
+func (this Sequence) extract(parseTime func(string) (time.Time, error)) Record {
+	rec := make(Record)
+
+	for _, token := range this {
+		if token.Field == FieldUnknown {
+			continue
+		}
+
+		rec[token.Field] = append(rec[token.Field], convertValue(token.Type, token.Value, parseTime))
+	}
+
+	return rec
+}
+
+// ParseRecord will take the message sequence supplied, find the matching pattern
+// sequence in the parser tree, and return the extracted fields as a Record. Like
+// Sequence.Extract, it uses the builtin time formats, so use Parse and Scanner.Extract
+// if the message was scanned using other time formats.
+func (this *Parser) ParseRecord(seq Sequence) (Record, error) {
+	pseq, err := this.Parse(seq)
+	if err != nil {
+		return nil, err
+	}
+
+	return pseq.Extract(), nil
+}
+
+func convertValue(t TokenType, v string, parseTime func(string) (time.Time, error)) interface{} {
+	v = strings.TrimSpace(v)
+
+	switch t {
+	case TokenIPv4, TokenIPv6:
+		// remove the zone index, e.g., fe80::1%eth0, since net.IP can't hold it
+		if i := strings.IndexByte(v, '%'); i > 0 {
+			v = v[:i]
+		}
+
+		if ip := net.ParseIP(v); ip != nil {
+			return ip
+		}
+
+	case TokenInteger:
+		if i, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return i
+		}
+
+	case TokenFloat:
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+
+	case TokenTime:
+		if t, err := parseTime(v); err == nil {
+			return t
+		}
+
+	case TokenMac:
+		if mac, err := net.ParseMAC(v); err == nil {
+			return mac
+		}
+	}
+
+	return v
+}
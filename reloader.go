@@ -0,0 +1,215 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// ReloadHandler is called by the Reloader each time the pattern files change and the
+// parser is reloaded, with the list of pattern files that were read. If any of them
+// could not be read or has an invalid pattern, err is set, and the parser keeps the
+// patterns it had before.
+type ReloadHandler func(files []string, err error)
+
+// Reloader watches pattern files and directories, and reloads the parser in the
+// background when any of them change. Changes are detected by checking the size and
+// modification time of the files, including all the files in the directories, at a
+// regular interval. When they change, all the pattern files are read into a new
+// parser, which then replaces the patterns of the parser being reloaded, using
+// Parser.Replace. Messages being parsed never wait for the reload, and each of them
+// is parsed using either the old or the new patterns, never a mix of both.
+type Reloader struct {
+	parser  *Parser
+	paths   []string
+	handler ReloadHandler
+
+	mu    sync.Mutex
+	stamp string
+	quit  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// NewReloader returns a Reloader that reloads parser from the pattern files in paths.
+// Each of the paths can be a pattern file or a directory, in which case all of the
+// files in it are pattern files. Nothing is loaded until Reload or Watch is called.
+// handler is called each time Watch reloads the parser.
+func NewReloader(parser *Parser, handler ReloadHandler, paths ...string) *Reloader {
+	return &Reloader{
+		parser:  parser,
+		paths:   paths,
+		handler: handler,
+	}
+}
+
+// Reload reads all the pattern files now, and replaces the patterns of the parser
+// with them. The handler is not called, the error is returned instead.
+func (this *Reloader) Reload() error {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	files, stamp, err := this.stat()
+	this.stamp = stamp
+
+	if err != nil {
+		return err
+	}
+
+	return this.load(files)
+}
+
+// Watch starts checking the pattern files for changes every interval, until Close
+// is called. If the parser has not been loaded using Reload, it's loaded at the first
+// check.
+func (this *Reloader) Watch(interval time.Duration) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.quit != nil {
+		return
+	}
+
+	this.quit = make(chan struct{})
+
+	this.wg.Add(1)
+	go this.watch(interval, this.quit)
+}
+
+// Close stops watching the pattern files, and waits for a reload in progress to
+// finish.
+func (this *Reloader) Close() error {
+	this.mu.Lock()
+	quit := this.quit
+	this.quit = nil
+	this.mu.Unlock()
+
+	if quit != nil {
+		close(quit)
+	}
+
+	this.wg.Wait()
+	return nil
+}
+
+func (this *Reloader) watch(interval time.Duration, quit chan struct{}) {
+	defer this.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-quit:
+			return
+
+		case <-ticker.C:
+		}
+
+		this.mu.Lock()
+
+		files, stamp, err := this.stat()
+		if stamp == this.stamp {
+			this.mu.Unlock()
+			continue
+		}
+
+		this.stamp = stamp
+
+		if err == nil {
+			err = this.load(files)
+		}
+
+		this.mu.Unlock()
+
+		if this.handler != nil {
+			this.handler(files, err)
+		}
+	}
+}
+
+// stat returns the list of pattern files, and a stamp that changes whenever any of
+// the files change, or files are added to or removed from the directories. If any
+// of the paths could not be read, the error is returned, and it's also part of the
+// stamp, so the same error is only reported once.
+func (this *Reloader) stat() ([]string, string, error) {
+	var (
+		files    []string
+		stamp    bytes.Buffer
+		firstErr error
+	)
+
+	for _, path := range this.paths {
+		fi, err := os.Stat(path)
+		if err == nil && fi.IsDir() {
+			var fis []os.FileInfo
+
+			// ReadDir returns the files sorted by name, so the patterns are always
+			// added in the same order
+			if fis, err = ioutil.ReadDir(path); err == nil {
+				for _, fi := range fis {
+					if !fi.IsDir() {
+						files = append(files, filepath.Join(path, fi.Name()))
+						fmt.Fprintf(&stamp, "%s %d %d\n", files[len(files)-1], fi.Size(), fi.ModTime().UnixNano())
+					}
+				}
+			}
+		} else if err == nil {
+			files = append(files, path)
+			fmt.Fprintf(&stamp, "%s %d %d\n", path, fi.Size(), fi.ModTime().UnixNano())
+		}
+
+		if err != nil {
+			fmt.Fprintf(&stamp, "%v\n", err)
+
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	return files, stamp.String(), firstErr
+}
+
+// load reads the pattern files into a new parser, and replaces the patterns of the
+// parser being reloaded with them.
+func (this *Reloader) load(files []string) error {
+	parser := NewParser()
+
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		patterns, err := ReadPatterns(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+
+		if err := parser.AddPatterns(patterns); err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+	}
+
+	this.parser.Replace(parser)
+
+	return nil
+}
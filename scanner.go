@@ -18,32 +18,216 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 	"unicode"
 )
 
 var (
-	ErrNegativeAdvance = errors.New("sequence: negative advance count")
-	ErrAdvanceTooFar   = errors.New("sequence: advance count beyond input")
-	ErrUnknownToken    = errors.New("sequence: unknown token encountered")
-	ErrNoMatch         = errors.New("sequence: no pattern matched for this message")
-	ErrInvalidCount    = errors.New("sequence: invalid count for field token")
+	ErrNegativeAdvance    = errors.New("sequence: negative advance count")
+	ErrAdvanceTooFar      = errors.New("sequence: advance count beyond input")
+	ErrUnknownToken       = errors.New("sequence: unknown token encountered")
+	ErrNoMatch            = errors.New("sequence: no pattern matched for this message")
+	ErrInvalidCount       = errors.New("sequence: invalid count for field token")
+	ErrUnknownTimeFormat  = errors.New("sequence: unknown time format")
+	ErrInvalidTimeFormat  = errors.New("sequence: invalid time format")
+	ErrInvalidEpochWindow = errors.New("sequence: epoch window ends before it starts")
+	ErrNotCompiled        = errors.New("sequence: not a compiled parser")
+	ErrCompiledVersion    = errors.New("sequence: unsupported compiled parser version")
+	ErrCompiledCorrupt    = errors.New("sequence: compiled parser is corrupted")
+	ErrNotAnalyzer        = errors.New("sequence: not a saved analyzer")
+	ErrAnalyzerVersion    = errors.New("sequence: unsupported saved analyzer version")
+	ErrAnalyzerCorrupt    = errors.New("sequence: saved analyzer is corrupted")
+	ErrTooManyVariants    = errors.New("sequence: pattern has too many variants")
+	ErrInvalidConstraint  = errors.New("sequence: invalid constraint for field token")
+	ErrInvalidField       = errors.New("sequence: invalid field type name or token type")
+	ErrFieldExists        = errors.New("sequence: field type already exists with a different token type")
+	ErrTooManyFields      = errors.New("sequence: too many field types")
+	ErrInvalidTokenType   = errors.New("sequence: invalid token type name or recognizer")
+	ErrTokenTypeExists    = errors.New("sequence: token type already exists")
+	ErrTooManyTokenTypes  = errors.New("sequence: too many token types")
+	ErrInvalidKeyValue    = errors.New("sequence: invalid key=value separator, quote or escape character")
+	ErrInvalidSpan        = errors.New("sequence: span of a token type other than %string%")
+	ErrDuplicateID        = errors.New("sequence: pattern ID is already used by a different pattern")
 )
 
 // Scanner is a sequential lexical analyzer that breaks a log message into a sequence
 // of tokens. It is sequential because it goes through log message sequentially
 // tokentizing each part of the message, without the use of regular expressions.
-// The scanner currently recognizes time stamps, IPv4 addresses, URLs, MAC addresses,
-// integers and floating point numbers. It also recgonizes key=value or key="value"
-// or key='value' or key=<value> pairs.
+// The scanner currently recognizes time stamps, IPv4 and IPv6 addresses, URLs, MAC
+// addresses, integers and floating point numbers. It also recgonizes key=value or
+// key="value" or key='value' or key=<value> pairs, and flattens messages that are
+// JSON objects into key = value pairs. Scanners created using NewScannerWithOptions
+// can recognize other separators, quote characters and escaped quotes.
 type Scanner struct {
+	formats  []string
+	timeFsm  *timeNode
+	location *time.Location
+	epoch    *epochWindow
+	kv       *kvSyntax
 }
 
+// ScannerOptions are the options of a Scanner created using NewScannerWithOptions.
+type ScannerOptions struct {
+	// TimeFormats are the time formats, in the layout of the time package, that the
+	// Scanner recognizes in addition to the builtin TimeFormats, e.g., a vendor
+	// specific format such as "02-Jan-2006 15:04:05.000".
+	TimeFormats []string
+
+	// Location is the time zone ParseTime uses for time stamps without one. If nil,
+	// UTC is used.
+	Location *time.Location
+
+	// EpochTimes makes the Scanner recognize integers and floating point numbers
+	// that are Unix epoch times in seconds, milliseconds, microseconds or
+	// nanoseconds, e.g., 1697040000 or 1697040000.123, as time stamps, if they are
+	// between EpochStart and EpochEnd.
+	EpochTimes bool
+
+	// EpochStart and EpochEnd are the window of the epoch times recognized. If they
+	// are zero, the window is from 2000-01-01 to 2100-01-01 UTC.
+	EpochStart, EpochEnd time.Time
+
+	// Separators are the separators between the keys and the values of key=value
+	// pairs, e.g., ":" for key: value, or "=>" for key=>value. A separator must
+	// immediately follow its key, and each of its characters is a token of its own,
+	// as it is when the separator is not recognized. If empty, = is the only
+	// separator.
+	Separators []string
+
+	// Quotes are the characters that can quote keys and values, e.g., `"'` for both
+	// "key"="value" and 'key'='value'. If empty, only double quotes are used.
+	Quotes string
+
+	// Escape is the character that escapes a quote character inside a quoted value,
+	// e.g., \ for "say \"hi\"", in which case it also escapes itself. If it's a quote
+	// character, that quote character is escaped by doubling it, e.g., "say ""hi""".
+	// The escaped characters are unescaped in the value, but not in the original
+	// value. If zero, quotes can't be escaped.
+	Escape byte
+}
+
+// kvSyntax is the syntax of the key=value pairs recognized by a Scanner.
+type kvSyntax struct {
+	// separators are sorted from the longest to the shortest, so the longest
+	// separator is recognized, e.g., => rather than =
+	separators []string
+	quotes     string
+	escape     byte
+}
+
+var defaultKVSyntax = &kvSyntax{separators: []string{"="}, quotes: `"`}
+
 func NewScanner() *Scanner {
 	return &Scanner{}
 }
 
+// NewScannerWithOptions returns a Scanner with the options supplied. The time
+// formats are compiled into a time FSM that belongs to the Scanner, so they don't
+// affect other Scanners. It returns ErrInvalidTimeFormat if a time format does not
+// contain any time elements, or cannot parse the times it formats,
+// ErrInvalidEpochWindow if EpochEnd is before EpochStart, and ErrInvalidKeyValue
+// if a separator, quote or escape character is not a punctuation character, or is
+// %, which starts the %field% tokens in patterns.
+func NewScannerWithOptions(opts ScannerOptions) (*Scanner, error) {
+	scanner := &Scanner{location: opts.Location}
+
+	if len(opts.Separators) > 0 || opts.Quotes != "" || opts.Escape != 0 {
+		kv := &kvSyntax{
+			separators: append([]string(nil), opts.Separators...),
+			quotes:     opts.Quotes,
+			escape:     opts.Escape,
+		}
+
+		if len(kv.separators) == 0 {
+			kv.separators = defaultKVSyntax.separators
+		}
+
+		if kv.quotes == "" {
+			kv.quotes = defaultKVSyntax.quotes
+		}
+
+		sort.SliceStable(kv.separators, func(i, j int) bool {
+			return len(kv.separators[i]) > len(kv.separators[j])
+		})
+
+		chars := strings.Join(kv.separators, "") + kv.quotes
+		if kv.escape != 0 {
+			chars += string(kv.escape)
+		}
+
+		for _, sep := range kv.separators {
+			if sep == "" {
+				return nil, ErrInvalidKeyValue
+			}
+		}
+
+		for i := 0; i < len(chars); i++ {
+			if c := rune(chars[i]); c > unicode.MaxASCII || c == '%' || !unicode.IsPunct(c) && !unicode.IsSymbol(c) {
+				return nil, ErrInvalidKeyValue
+			}
+		}
+
+		scanner.kv = kv
+	}
+
+	if opts.EpochTimes {
+		scanner.epoch = &epochWindow{opts.EpochStart, opts.EpochEnd}
+
+		if scanner.epoch.start.IsZero() {
+			scanner.epoch.start = defaultEpochWindow.start
+		}
+
+		if scanner.epoch.end.IsZero() {
+			scanner.epoch.end = defaultEpochWindow.end
+		}
+
+		if scanner.epoch.end.Before(scanner.epoch.start) {
+			return nil, ErrInvalidEpochWindow
+		}
+	}
+
+	if len(opts.TimeFormats) > 0 {
+		for _, f := range opts.TimeFormats {
+			if !validTimeFormat(f) {
+				return nil, ErrInvalidTimeFormat
+			}
+		}
+
+		scanner.formats = append(append([]string(nil), TimeFormats...), opts.TimeFormats...)
+		scanner.timeFsm = buildTimeFSM(scanner.formats)
+	}
+
+	return scanner, nil
+}
+
+// ParseTime converts the value of a TokenTime token returned by this Scanner to a
+// time.Time, using the time format the Scanner matched. If the format does not
+// contain a year, the current year is assumed, unless that puts the time more than
+// 30 days in the future, in which case it's from the year before, e.g., a message
+// from Dec 31 read on Jan 1. Time stamps without a time zone are in the Location of
+// the Scanner. Epoch times are converted if they are in the window of the Scanner,
+// or in the default window if the Scanner doesn't recognize epoch times.
+func (this Scanner) ParseTime(v string) (time.Time, error) {
+	root, formats, epoch, loc := this.timeFsm, this.formats, this.epoch, this.location
+	if root == nil {
+		root, formats = timeFsmRoot, TimeFormats
+	}
+
+	if epoch == nil {
+		epoch = defaultEpochWindow
+	}
+
+	if loc == nil {
+		loc = time.UTC
+	}
+
+	return parseTimeAt(v, root, formats, epoch, loc, time.Now())
+}
+
 // Scan returns a Sequence, or a list of tokens, for the data string supplied.
 // For example, the following message
 //
@@ -52,22 +236,22 @@ func NewScanner() *Scanner {
 // Returns the following Sequence:
 //
 //   Sequence{
-//   	Token{TokenTime, FieldUnknown, "jan 12 06:49:42", false, false, 0},
-//   	Token{TokenLiteral, FieldUnknown, "irc", false, false, 0},
-//   	Token{TokenLiteral, FieldUnknown, "sshd", false, false, 0},
-//   	Token{TokenLiteral, FieldUnknown, "[", false, false, 0},
-//   	Token{TokenInteger, FieldUnknown, "7034", false, false, 0},
-//   	Token{TokenLiteral, FieldUnknown, "]", false, false, 0},
-//   	Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-//   	Token{TokenLiteral, FieldUnknown, "failed", false, false, 0},
-//   	Token{TokenLiteral, FieldUnknown, "password", false, false, 0},
-//   	Token{TokenLiteral, FieldUnknown, "for", false, false, 0},
-//   	Token{TokenLiteral, FieldUnknown, "root", false, false, 0},
-//   	Token{TokenLiteral, FieldUnknown, "from", false, false, 0},
-//   	Token{TokenIPv4, FieldUnknown, "218.161.81.238", false, false, 0},
-//   	Token{TokenLiteral, FieldUnknown, "port", false, false, 0},
-//   	Token{TokenInteger, FieldUnknown, "4228", false, false, 0},
-//   	Token{TokenLiteral, FieldUnknown, "ssh2", false, false, 0},
+//   	Token{TokenTime, FieldUnknown, "jan 12 06:49:42", false, false, 0, 0, 15, "Jan 12 06:49:42"},
+//   	Token{TokenLiteral, FieldUnknown, "irc", false, false, 0, 16, 19, "irc"},
+//   	Token{TokenLiteral, FieldUnknown, "sshd", false, false, 0, 20, 24, "sshd"},
+//   	Token{TokenLiteral, FieldUnknown, "[", false, false, 0, 24, 25, "["},
+//   	Token{TokenInteger, FieldUnknown, "7034", false, false, 0, 25, 29, "7034"},
+//   	Token{TokenLiteral, FieldUnknown, "]", false, false, 0, 29, 30, "]"},
+//   	Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 30, 31, ":"},
+//   	Token{TokenLiteral, FieldUnknown, "failed", false, false, 0, 32, 38, "Failed"},
+//   	Token{TokenLiteral, FieldUnknown, "password", false, false, 0, 39, 47, "password"},
+//   	Token{TokenLiteral, FieldUnknown, "for", false, false, 0, 48, 51, "for"},
+//   	Token{TokenLiteral, FieldUnknown, "root", false, false, 0, 52, 56, "root"},
+//   	Token{TokenLiteral, FieldUnknown, "from", false, false, 0, 57, 61, "from"},
+//   	Token{TokenIPv4, FieldUnknown, "218.161.81.238", false, false, 0, 62, 76, "218.161.81.238"},
+//   	Token{TokenLiteral, FieldUnknown, "port", false, false, 0, 77, 81, "port"},
+//   	Token{TokenInteger, FieldUnknown, "4228", false, false, 0, 82, 86, "4228"},
+//   	Token{TokenLiteral, FieldUnknown, "ssh2", false, false, 0, 87, 91, "ssh2"},
 //   }
 //
 // The following message
@@ -76,81 +260,163 @@ func NewScanner() *Scanner {
 //
 // Will return
 //   Sequence{
-//   	Token{TokenLiteral, FieldUnknown, "id", true, false, 0},
-//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-//   	Token{TokenString, FieldUnknown, "firewall", false, true, 0},
-//   	Token{TokenLiteral, FieldUnknown, "time", true, false, 0},
-//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-//   	Token{TokenLiteral, FieldUnknown, "\"", false, false, 0},
-//   	Token{TokenTime, FieldUnknown, "2005-03-18 14:01:43", false, true, 0},
-//   	Token{TokenLiteral, FieldUnknown, "\"", false, false, 0},
-//   	Token{TokenLiteral, FieldUnknown, "fw", true, false, 0},
-//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-//   	Token{TokenString, FieldUnknown, "topsec", false, true, 0},
-//   	Token{TokenLiteral, FieldUnknown, "priv", true, false, 0},
-//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-//   	Token{TokenInteger, FieldUnknown, "4", false, true, 0},
-//   	Token{TokenLiteral, FieldUnknown, "recorder", true, false, 0},
-//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-//   	Token{TokenString, FieldUnknown, "kernel", false, true, 0},
-//   	Token{TokenLiteral, FieldUnknown, "type", true, false, 0},
-//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-//   	Token{TokenString, FieldUnknown, "conn", false, true, 0},
-//   	Token{TokenLiteral, FieldUnknown, "policy", true, false, 0},
-//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-//   	Token{TokenInteger, FieldUnknown, "504", false, true, 0},
-//   	Token{TokenLiteral, FieldUnknown, "proto", true, false, 0},
-//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-//   	Token{TokenString, FieldUnknown, "tcp", false, true, 0},
-//   	Token{TokenLiteral, FieldUnknown, "rule", true, false, 0},
-//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-//   	Token{TokenString, FieldUnknown, "deny", false, true, 0},
-//   	Token{TokenLiteral, FieldUnknown, "src", true, false, 0},
-//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-//   	Token{TokenIPv4, FieldUnknown, "210.82.121.91", false, true, 0},
-//   	Token{TokenLiteral, FieldUnknown, "sport", true, false, 0},
-//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-//   	Token{TokenInteger, FieldUnknown, "4958", false, true, 0},
-//   	Token{TokenLiteral, FieldUnknown, "dst", true, false, 0},
-//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-//   	Token{TokenIPv4, FieldUnknown, "61.229.37.85", false, true, 0},
-//   	Token{TokenLiteral, FieldUnknown, "dport", true, false, 0},
-//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-//   	Token{TokenInteger, FieldUnknown, "23124", false, true, 0},
-//   	Token{TokenLiteral, FieldUnknown, "smac", true, false, 0},
-//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-//   	Token{TokenMac, FieldUnknown, "00:0b:5f:b2:1d:80", false, true, 0},
-//   	Token{TokenLiteral, FieldUnknown, "dmac", true, false, 0},
-//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-//   	Token{TokenMac, FieldUnknown, "00:04:c1:8b:d8:82", false, true, 0},
+//   	Token{TokenLiteral, FieldUnknown, "id", true, false, 0, 0, 2, "id"},
+//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 2, 3, "="},
+//   	Token{TokenString, FieldUnknown, "firewall", false, true, 0, 3, 11, "firewall"},
+//   	Token{TokenLiteral, FieldUnknown, "time", true, false, 0, 12, 16, "time"},
+//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 16, 17, "="},
+//   	Token{TokenLiteral, FieldUnknown, "\"", false, false, 0, 17, 18, "\""},
+//   	Token{TokenTime, FieldUnknown, "2005-03-18 14:01:43", false, true, 0, 18, 37, "2005-03-18 14:01:43"},
+//   	Token{TokenLiteral, FieldUnknown, "\"", false, false, 0, 37, 38, "\""},
+//   	Token{TokenLiteral, FieldUnknown, "fw", true, false, 0, 39, 41, "fw"},
+//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 41, 42, "="},
+//   	Token{TokenString, FieldUnknown, "topsec", false, true, 0, 42, 48, "TOPSEC"},
+//   	Token{TokenLiteral, FieldUnknown, "priv", true, false, 0, 49, 53, "priv"},
+//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 53, 54, "="},
+//   	Token{TokenInteger, FieldUnknown, "4", false, true, 0, 54, 55, "4"},
+//   	Token{TokenLiteral, FieldUnknown, "recorder", true, false, 0, 56, 64, "recorder"},
+//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 64, 65, "="},
+//   	Token{TokenString, FieldUnknown, "kernel", false, true, 0, 65, 71, "kernel"},
+//   	Token{TokenLiteral, FieldUnknown, "type", true, false, 0, 72, 76, "type"},
+//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 76, 77, "="},
+//   	Token{TokenString, FieldUnknown, "conn", false, true, 0, 77, 81, "conn"},
+//   	Token{TokenLiteral, FieldUnknown, "policy", true, false, 0, 82, 88, "policy"},
+//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 88, 89, "="},
+//   	Token{TokenInteger, FieldUnknown, "504", false, true, 0, 89, 92, "504"},
+//   	Token{TokenLiteral, FieldUnknown, "proto", true, false, 0, 93, 98, "proto"},
+//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 98, 99, "="},
+//   	Token{TokenString, FieldUnknown, "tcp", false, true, 0, 99, 102, "TCP"},
+//   	Token{TokenLiteral, FieldUnknown, "rule", true, false, 0, 103, 107, "rule"},
+//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 107, 108, "="},
+//   	Token{TokenString, FieldUnknown, "deny", false, true, 0, 108, 112, "deny"},
+//   	Token{TokenLiteral, FieldUnknown, "src", true, false, 0, 113, 116, "src"},
+//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 116, 117, "="},
+//   	Token{TokenIPv4, FieldUnknown, "210.82.121.91", false, true, 0, 117, 130, "210.82.121.91"},
+//   	Token{TokenLiteral, FieldUnknown, "sport", true, false, 0, 131, 136, "sport"},
+//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 136, 137, "="},
+//   	Token{TokenInteger, FieldUnknown, "4958", false, true, 0, 137, 141, "4958"},
+//   	Token{TokenLiteral, FieldUnknown, "dst", true, false, 0, 142, 145, "dst"},
+//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 145, 146, "="},
+//   	Token{TokenIPv4, FieldUnknown, "61.229.37.85", false, true, 0, 146, 158, "61.229.37.85"},
+//   	Token{TokenLiteral, FieldUnknown, "dport", true, false, 0, 159, 164, "dport"},
+//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 164, 165, "="},
+//   	Token{TokenInteger, FieldUnknown, "23124", false, true, 0, 165, 170, "23124"},
+//   	Token{TokenLiteral, FieldUnknown, "smac", true, false, 0, 171, 175, "smac"},
+//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 175, 176, "="},
+//   	Token{TokenMac, FieldUnknown, "00:0b:5f:b2:1d:80", false, true, 0, 176, 193, "00:0b:5f:b2:1d:80"},
+//   	Token{TokenLiteral, FieldUnknown, "dmac", true, false, 0, 194, 198, "dmac"},
+//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 198, 199, "="},
+//   	Token{TokenMac, FieldUnknown, "00:04:c1:8b:d8:82", false, true, 0, 199, 216, "00:04:c1:8b:d8:82"},
+//   }
+//
+// A message that is a JSON object is scanned into the same key = value tokens, with
+// the keys of nested objects joined with dots. The type of a value is the type of
+// the single token it's scanned into, if it's not a literal, otherwise it's a string.
+// Arrays are not flattened, each array is a single string value. The offsets of a
+// key are those of its last part, and the original value of a string is unescaped.
+// For example, the following message
+//
+//   {"src": {"ip": "10.1.1.1", "port": 22}, "msg": "Login failed"}
+//
+// Will return
+//
+//   Sequence{
+//   	Token{TokenLiteral, FieldUnknown, "src.ip", true, false, 0, 10, 12, "src.ip"},
+//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 13, 14, ":"},
+//   	Token{TokenIPv4, FieldUnknown, "10.1.1.1", false, true, 0, 16, 24, "10.1.1.1"},
+//   	Token{TokenLiteral, FieldUnknown, "src.port", true, false, 0, 28, 32, "src.port"},
+//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 33, 34, ":"},
+//   	Token{TokenInteger, FieldUnknown, "22", false, true, 0, 35, 37, "22"},
+//   	Token{TokenLiteral, FieldUnknown, "msg", true, false, 0, 41, 44, "msg"},
+//   	Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 45, 46, ":"},
+//   	Token{TokenString, FieldUnknown, "login failed", false, true, 0, 48, 60, "Login failed"},
 //   }
 func (this Scanner) Scan(data string) (Sequence, error) {
-	msg := &message{data: data}
-	if err := msg.tokenize(); err != nil {
+	seq, err := this.ScanInto(make(Sequence, 0, 20), data)
+	if err != nil {
 		return nil, err
 	}
 
-	return msg.tokens, nil
+	return seq, nil
+}
+
+// ScanInto is the same as Scan, but it appends the tokens to seq[:0], so the caller
+// can reuse the same Sequence for each message. The state of the Scanner is pooled,
+// so once seq has grown to the number of tokens in the messages, scanning does not
+// allocate, except for lowercasing messages that are not already in lower case, and
+// for values made up of several tokens, such as quoted values. For example:
+//
+//   var seq sequence.Sequence
+//
+//   for lines.Scan() {
+//   	seq, err = scanner.ScanInto(seq, lines.Text())
+//   	...
+//   }
+//
+// The tokens in seq are only valid until seq is reused.
+func (this Scanner) ScanInto(seq Sequence, data string) (Sequence, error) {
+	msg := messagePool.Get().(*message)
+	defer messagePool.Put(msg)
+
+	msg.data, msg.timeFsm, msg.epoch, msg.kv = data, this.timeFsm, this.epoch, this.kv
+
+	err := msg.tokenizeInto(seq)
+	seq = msg.tokens
+
+	// The pooled message must not hold on to the caller's data
+	msg.data, msg.lower, msg.tokens = "", "", nil
+
+	if err != nil {
+		return seq[:0], err
+	}
+
+	return seq, nil
+}
+
+// messagePool keeps the messages used by ScanInto, so they are not allocated for
+// each message scanned.
+var messagePool = sync.Pool{
+	New: func() interface{} {
+		return &message{}
+	},
 }
 
 type message struct {
 	data   string
 	tokens Sequence
 
+	// lower is data in lower case, if lowercasing does not change its length
+	lower string
+
+	// timeFsm is the time FSM of the Scanner, nil for the builtin TimeFormats
+	timeFsm *timeNode
+
+	// epoch is the window of the epoch times recognized, nil if they are not
+	epoch *epochWindow
+
+	// kv is the key=value syntax of the Scanner, nil for the default syntax
+	kv *kvSyntax
+
 	state struct {
 		// these are per token states
 		tokenType TokenType
 		tokenStop bool
 		dots      int
 
+		// these are per token states for the ipv6 scanner
+		ipv6 ipv6State
+
 		// these are per message states
 		prevToken Token
 
 		// single quote
 		single bool
 
-		// double quote
-		double bool
+		// the quote character of the quoted value we are in, 0 if we are not
+		quote byte
+
+		// number of separator characters left to scan as tokens of their own
+		sepRest int
 
 		// square and angle bracket
 		square, angle bool
@@ -167,9 +433,51 @@ type message struct {
 }
 
 func (this *message) tokenize() error {
-	this.data = strings.TrimSpace(this.data)
+	return this.tokenizeInto(make(Sequence, 0, 20))
+}
+
+// tokenizeInto scans the message, and appends the tokens to tokens[:0].
+func (this *message) tokenizeInto(tokens Sequence) error {
+	this.tokens = tokens[:0]
 
-	if len(this.data) == 0 {
+	// The leading spaces are skipped rather than trimmed, so the offsets of the
+	// tokens are those in the original data
+	this.data = strings.TrimRightFunc(this.data, unicode.IsSpace)
+
+	// A message that is a JSON object, even one that spans several lines, is
+	// flattened into key = value tokens
+	if isJSONObject(this.data) {
+		this.tokenizeJSON()
+
+		if len(this.tokens) == 0 {
+			return fmt.Errorf("Zero length message")
+		}
+
+		return nil
+	}
+
+	// A message framed from several lines is scanned up to the end of its first
+	// line that's not blank, and the rest of the lines are kept as a single
+	// %trailer% token
+	var trailer Token
+
+	first := len(this.data) - len(strings.TrimLeftFunc(this.data, unicode.IsSpace))
+
+	if i := strings.IndexByte(this.data[first:], '\n'); i >= 0 {
+		i += first
+		trailer = Token{
+			Type:     TokenString,
+			Field:    FieldTrailer,
+			Value:    this.data[i+1:],
+			Start:    i + 1,
+			End:      len(this.data),
+			Original: this.data[i+1:],
+		}
+
+		this.data = strings.TrimRightFunc(this.data[:i], unicode.IsSpace)
+	}
+
+	if len(strings.TrimLeftFunc(this.data, unicode.IsSpace)) == 0 {
 		return fmt.Errorf("Zero length message")
 	}
 
@@ -185,6 +493,10 @@ func (this *message) tokenize() error {
 		return err
 	}
 
+	if trailer.Field == FieldTrailer {
+		this.tokens = append(this.tokens, trailer)
+	}
+
 	return nil
 }
 
@@ -194,10 +506,55 @@ func (this *message) scan() error {
 		nss := this.skipSpace(this.data[this.state.start:])
 		this.state.start += nss
 
-		l, t, err := this.scanToken(this.data[this.state.start:])
-		if err != nil {
-			return err
-		} else if t == TokenUnknown {
+		kv := this.kv
+		if kv == nil {
+			kv = defaultKVSyntax
+		}
+
+		var (
+			l, sep, key = 0, 0, -1
+			t           TokenType
+			escaped     bool
+		)
+
+		// A separator that immediately follows a key, e.g., "abc=", is scanned one
+		// character at a time
+		if this.state.sepRest == 0 && nss == 0 && !this.state.nextIsValue {
+			if key = this.keyIndex(kv); key >= 0 {
+				sep = kv.separatorLen(this.data[this.state.start:])
+			}
+		}
+
+		if sep > 0 || this.state.sepRest > 0 {
+			l, t = 1, TokenLiteral
+		} else {
+			var err error
+
+			l, t, err = this.scanToken(this.data[this.state.start:])
+			if err != nil {
+				return err
+			}
+
+			// The registered token types are recognized alongside the builtin ones, and
+			// the longest token wins. Pattern tokens such as %uuid% are left alone.
+			if this.data[this.state.start] != '%' {
+				if rl, rt := recognizeToken(this.data[this.state.start:]); rl > l || (rl == l && rl > 0 && t == TokenLiteral) {
+					l, t = rl, rt
+				}
+			}
+
+			// Quote characters and escaped characters in values are tokens of their
+			// own, so quoted values start and end at the right quotes
+			if this.state.nextIsValue && t != TokenUnknown {
+				var vl int
+
+				if vl, escaped = kv.valueLen(this.data[this.state.start:], l, this.state.quote); vl != l {
+					l, t = vl, TokenLiteral
+				}
+			}
+		}
+
+		if t == TokenUnknown {
 			//return fmt.ErrUnknownToken
 			return fmt.Errorf("unknown token encountered: %s\n%v", this.data[this.state.start:], t)
 		}
@@ -207,24 +564,55 @@ func (this *message) scan() error {
 			l--
 		}
 
-		v := this.data[this.state.start : this.state.start+l]
+		start, end := this.state.start, this.state.start+l
+		v := this.data[start:end]
+		raw := v
 		this.state.start += l
 
+		// Epoch times look like any other number, so they can only be told apart
+		// once the whole number is scanned
+		if (t == TokenInteger || t == TokenFloat) && this.epoch != nil {
+			if _, ok := this.epoch.time(v); ok {
+				t = TokenTime
+			}
+		}
+
 		switch t {
-		case TokenMac, TokenLiteral, TokenURL, TokenTime:
-			v = strings.ToLower(v)
+		case TokenMac, TokenLiteral, TokenURL, TokenTime, TokenIPv6:
+			if this.lower != "" {
+				v = this.lower[start:end]
+			} else {
+				v = strings.ToLower(v)
+			}
 		}
 
-		token := Token{Type: t, Value: v, Field: FieldUnknown}
+		if escaped {
+			v = v[1:]
+		}
+
+		token := Token{Type: t, Value: v, Field: FieldUnknown, Start: start, End: end, Original: raw}
 
 		if v[0] == '%' && v[len(v)-1] == '%' {
 			var err error
 			r := int64(0)
 
-			// Check to see if it's a %something-N% token
+			// Check to see if it has a constraint, e.g., %srcport:0-65535%
+			cons := ""
+			if i := strings.IndexByte(v, ':'); i > 0 {
+				v, cons = v[:i]+"%", v[i+1:len(v)-1]
+			}
+
+			// Check to see if it's a %something*%, %something+% or %something-N% token
 			parts := strings.Split(v[:len(v)-1], "-")
 
-			if len(parts) > 1 {
+			switch {
+			case len(v) > 3 && v[len(v)-2] == '*':
+				r, v = RangeRest, v[:len(v)-2]+"%"
+
+			case len(v) > 3 && v[len(v)-2] == '+':
+				r, v = RangeSpan, v[:len(v)-2]+"%"
+
+			case len(parts) > 1:
 				r, err = strconv.ParseInt(parts[1], 0, 0)
 				if err != nil {
 					return ErrInvalidCount
@@ -233,8 +621,6 @@ func (this *message) scan() error {
 				v = parts[0] + "%"
 			}
 
-			token.Range = int(r)
-
 			// is this a known TokenType or FieldType?
 			isTypeToken := false
 
@@ -249,6 +635,13 @@ func (this *message) scan() error {
 			}
 
 			if isTypeToken {
+				if cons != "" {
+					if _, err := parseConstraint(cons); err != nil {
+						return err
+					}
+				}
+
+				token.Range = int(r)
 				this.tokens = append(this.tokens, token)
 				this.state.prevToken = token
 				return nil
@@ -256,54 +649,48 @@ func (this *message) scan() error {
 		}
 
 		switch {
-		case nss == 0 && v == "=" && !this.state.nextIsValue:
+		case this.state.sepRest > 0:
+			// The rest of the separator is left as is
+			this.state.sepRest--
+
+		case sep > 0:
 			// This means we hit something like "abc=", so we assume abc, which is the
-			// last token, is a key. It also means the next token should be a value
-			if len(this.tokens) >= 1 {
-				this.tokens[len(this.tokens)-1].IsKey = true
-				this.tokens[len(this.tokens)-1].Type = TokenLiteral
-				this.tokens[len(this.tokens)-1].IsValue = false
-				this.state.nextIsValue = true
-			}
+			// last token, or the quoted token before it, is a key. It also means the
+			// next token should be a value
+			this.tokens[key].IsKey = true
+			this.tokens[key].Type = TokenLiteral
+			this.tokens[key].IsValue = false
+			this.state.nextIsValue = true
+			this.state.sepRest = sep - 1
 
 		case this.state.nextIsValue:
-			switch v {
-			/*
-				case "'":
-					if this.state.single {
-						this.state.single = false
-						this.state.valueDistance = 0
-						this.state.nextIsValue = false
-					} else {
-						this.state.single = true
-						this.state.valueDistance = 1
-					}
-			*/
+			switch {
+			case !escaped && len(v) == 1 && strings.IndexByte(kv.quotes, v[0]) >= 0 &&
+				(this.state.quote == 0 || this.state.quote == v[0]):
 
-			case "\"":
-				if this.state.double {
-					this.state.double = false
+				if this.state.quote != 0 {
+					this.state.quote = 0
 					this.state.valueDistance = 0
 					this.state.nextIsValue = false
 				} else {
-					this.state.double = true
+					this.state.quote = v[0]
 					this.state.valueDistance = 1
 				}
 
-			case "<":
+			case v == "<":
 				this.state.angle = true
 				this.state.valueDistance = 1
 
-			case ">":
+			case v == ">":
 				this.state.angle = false
 				this.state.valueDistance = 0
 				this.state.nextIsValue = false
 
-			case "[":
+			case v == "[":
 				this.state.square = true
 				this.state.valueDistance = 1
 
-			case "]":
+			case v == "]":
 				this.state.square = false
 				this.state.valueDistance = 0
 				this.state.nextIsValue = false
@@ -318,6 +705,8 @@ func (this *message) scan() error {
 					} else {
 						this.tokens[last].Value += v
 					}
+					this.tokens[last].End = end
+					this.tokens[last].Original = this.data[this.tokens[last].Start:end]
 					this.state.prevToken = this.tokens[last]
 
 					if this.insideQuote() {
@@ -344,6 +733,8 @@ func (this *message) scan() error {
 			// likely just a single token, then we merge it with the previous "="
 			// token
 			this.tokens[len(this.tokens)-1].Value += v
+			this.tokens[len(this.tokens)-1].End = end
+			this.tokens[len(this.tokens)-1].Original = this.data[this.tokens[len(this.tokens)-1].Start:end]
 			this.state.prevToken = this.tokens[len(this.tokens)-1]
 			this.state.nextIsValue = false
 			this.state.valueDistance = 0
@@ -360,6 +751,35 @@ func (this *message) scan() error {
 	return io.EOF
 }
 
+// valueToken returns the token for the value v, which is at data[start:end], when
+// the value is already delimited, e.g., a JSON string. The type of the value is the
+// type of the token v is scanned into, if it's scanned into a single token that is
+// not a literal, e.g., an IP address, a time stamp or a %field% token in a pattern.
+// Otherwise, it's a string.
+func (this *message) valueToken(v string, start, end int) Token {
+	token := Token{Type: TokenString, Field: FieldUnknown, Value: strings.ToLower(v), IsValue: true,
+		Start: start, End: end, Original: v}
+
+	if strings.TrimSpace(v) == "" {
+		return token
+	}
+
+	msg := messagePool.Get().(*message)
+	defer messagePool.Put(msg)
+
+	msg.data, msg.timeFsm, msg.epoch, msg.kv = v, this.timeFsm, this.epoch, this.kv
+
+	if err := msg.tokenizeInto(nil); err == nil && len(msg.tokens) == 1 {
+		if t := msg.tokens[0]; t.Type != TokenLiteral && t.Start == 0 && t.End == len(v) {
+			token.Type, token.Field, token.Value, token.Range = t.Type, t.Field, t.Value, t.Range
+		}
+	}
+
+	msg.data, msg.lower, msg.tokens = "", "", nil
+
+	return token
+}
+
 func (this *message) skipSpace(data string) int {
 	// Skip leading spaces.
 	i := 0
@@ -377,14 +797,26 @@ func (this *message) skipSpace(data string) int {
 
 func (this *message) scanToken(data string) (int, TokenType, error) {
 	var (
-		cur                        *timeNode = timeFsmRoot
+		cur                        *timeNode = this.timeFsm
 		timeStop, macStop, macType bool
-		timeLen, tokenLen          int
+		ipv6Stop, ipv6Type         bool
+		timeLen, tokenLen, ipv6Len int
 	)
 
+	if cur == nil {
+		cur = timeFsmRoot
+	}
+
 	this.state.dots = 0
 	this.state.tokenType = TokenUnknown
 	this.state.tokenStop = false
+	this.state.ipv6 = ipv6State{}
+
+	// A %something+% or %something:constraint% token is a single token, even
+	// though + and the punctuation in constraints do not belong in a literal
+	if l := placeholderLen(data); l > 0 {
+		return l, TokenLiteral, nil
+	}
 
 	for i, r := range data {
 		if !this.state.tokenStop {
@@ -403,8 +835,24 @@ func (this *message) scanToken(data string) (int, TokenType, error) {
 			}
 		}
 
+		if !ipv6Stop {
+			if ipv6Type, ipv6Stop = this.ipv6Step(r); ipv6Type {
+				ipv6Len = i + 1
+			}
+
+			if ipv6Stop && ipv6Len > 0 {
+				// If we stopped at a letter, digit or underscore, then what we have
+				// seen so far is part of a bigger word, so it's not an address.
+				if isWordRune(r) {
+					ipv6Len = 0
+				} else {
+					return ipv6Len, TokenIPv6, nil
+				}
+			}
+		}
+
 		if !timeStop {
-			if cur = this.timeStep(r, cur); cur == nil {
+			if cur = timeStep(r, cur); cur == nil {
 				timeStop = true
 
 				if timeLen > 0 {
@@ -417,7 +865,7 @@ func (this *message) scanToken(data string) (int, TokenType, error) {
 			}
 		}
 
-		if this.state.tokenStop && timeStop && macStop {
+		if this.state.tokenStop && timeStop && macStop && ipv6Stop {
 			// If token length is 0, it means we didn't find time, nor did we find
 			// a word, it cannot be space since we skipped all space. This means it
 			// is a single character literal, so return that.
@@ -429,21 +877,63 @@ func (this *message) scanToken(data string) (int, TokenType, error) {
 		}
 	}
 
+	if ipv6Len > 0 {
+		return ipv6Len, TokenIPv6, nil
+	}
+
+	// The data ended before the time FSM stopped, e.g., the message ends with a
+	// time stamp
+	if timeLen > 0 {
+		return timeLen, TokenTime, nil
+	}
+
 	return len(data), this.state.tokenType, nil
 }
 
-func (this *message) timeStep(r rune, cur *timeNode) *timeNode {
-	t := tnType(r)
+// placeholderLen returns the length of the %something+% or %something:constraint%
+// token at the start of data, or 0 if data doesn't start with one.
+func placeholderLen(data string) int {
+	if len(data) < 4 || data[0] != '%' {
+		return 0
+	}
+
+	i := 1
+	for i < len(data) && (data[i] == '_' || data[i] == '-' || unicode.IsLetter(rune(data[i])) || unicode.IsDigit(rune(data[i]))) {
+		i++
+	}
+
+	if i == 1 || i == len(data) {
+		return 0
+	}
+
+	special := false
 
-	for _, n := range cur.children {
-		if (n.ntype == timeNodeDigitOrSpace && (t == timeNodeDigit || t == timeNodeSpace)) ||
-			(n.ntype == t && (t != timeNodeLiteral || (t == timeNodeLiteral && rune(n.value) == r))) {
+	switch data[i] {
+	case '+':
+		special = true
+		i++
 
-			return n
+	case '*':
+		i++
+	}
+
+	if i < len(data) && data[i] == ':' {
+		special = true
+
+		for i < len(data) && data[i] != '%' && !unicode.IsSpace(rune(data[i])) {
+			i++
 		}
 	}
 
-	return nil
+	if !special || i == len(data) || data[i] != '%' {
+		return 0
+	}
+
+	if i++; i < len(data) && !unicode.IsSpace(rune(data[i])) {
+		return 0
+	}
+
+	return i
 }
 
 func (this *message) tokenStep(index int, r rune) {
@@ -472,7 +962,7 @@ func (this *message) tokenStep(index int, r rune) {
 		if r == '/' {
 			if this.state.tokenType == TokenIPv4 {
 				this.state.tokenStop = true
-			} else if this.state.prevToken.Type == TokenIPv4 {
+			} else if this.state.prevToken.Type == TokenIPv4 || this.state.prevToken.Type == TokenIPv6 {
 				this.state.tokenType = TokenLiteral
 				this.state.tokenStop = true
 			} else {
@@ -593,19 +1083,260 @@ func (this *message) macStep(index int, r rune) (bool, bool) {
 	return false, true
 }
 
+// ipv6State keeps track of the progress of the IPv6 scanner within a single token.
+type ipv6State struct {
+	groups  int  // number of completed hex groups
+	hexLen  int  // number of hex digits in the current group
+	decimal bool // whether the current group contains only decimal digits
+	digits  bool // whether any of the groups contains a decimal digit
+	colons  int  // number of consecutive colons just seen
+	dcolon  bool // whether we have seen the "::" compression
+	ipv4    bool // whether we are in the embedded IPv4 part, e.g., ::ffff:1.2.3.4
+	dots    int  // number of dots seen in the embedded IPv4 part
+	octLen  int  // number of digits in the current IPv4 octet
+	zone    bool // whether we are in the zone index, e.g., fe80::1%eth0
+	zoneLen int  // number of characters in the zone index
+}
+
+// Returns bool, bool, first one is true if what we have seen so far is a valid IPv6
+// address, second is whether to stop scanning. It recognizes the full form, e.g.,
+// 2001:db8:0:0:0:0:0:1, the compressed form, e.g., 2001:db8::1, the IPv4-mapped or
+// compatible form, e.g., ::ffff:192.0.2.1, and the zone-scoped form, e.g.,
+// fe80::1%eth0. A MAC address (6 groups and no compression) or a time stamp
+// (3 groups and no compression) is never a valid IPv6 address.
+func (this *message) ipv6Step(r rune) (bool, bool) {
+	s := &this.state.ipv6
+
+	switch {
+	case s.zone:
+		if !isWordRune(r) && r != '.' && r != '-' {
+			return false, true
+		}
+
+		s.zoneLen++
+		return true, false
+
+	case s.ipv4:
+		switch {
+		case r >= '0' && r <= '9' && s.octLen < 3:
+			s.octLen++
+
+		case r == '.' && s.octLen > 0 && s.dots < 3:
+			s.dots++
+			s.octLen = 0
+
+		case r == '%' && s.dots == 3 && s.octLen > 0:
+			s.zone = true
+			return false, false
+
+		default:
+			return false, true
+		}
+
+		return s.dots == 3 && s.octLen > 0 &&
+			((s.dcolon && s.groups <= 5) || (!s.dcolon && s.groups == 6)), false
+
+	case isHexRune(r):
+		if s.hexLen == 0 {
+			if s.colons == 1 && s.groups == 0 && !s.dcolon {
+				// a single leading colon, e.g., ":1"
+				return false, true
+			}
+
+			s.decimal = true
+		}
+
+		if s.hexLen++; s.hexLen > 4 || s.groups >= 8 {
+			return false, true
+		}
+
+		s.colons = 0
+		s.decimal = s.decimal && r >= '0' && r <= '9'
+		s.digits = s.digits || r >= '0' && r <= '9'
+
+	case r == ':':
+		switch {
+		case s.hexLen > 0:
+			s.groups++
+			s.hexLen = 0
+			s.colons = 1
+
+		case s.colons == 1 && !s.dcolon:
+			s.dcolon = true
+			s.colons = 2
+
+		case s.colons == 0 && s.groups == 0:
+			// leading colon, must be followed by another colon
+			s.colons = 1
+
+		default:
+			return false, true
+		}
+
+		if s.groups > 7 {
+			return false, true
+		}
+
+	case r == '.':
+		// Only a decimal group of up to 3 digits that follows at least one other
+		// group or the "::" can start the embedded IPv4 part.
+		if s.hexLen == 0 || s.hexLen > 3 || !s.decimal || (s.groups == 0 && !s.dcolon) {
+			return false, true
+		}
+
+		s.ipv4 = true
+		s.dots = 1
+		s.octLen = 0
+		return false, false
+
+	case r == '%':
+		if !this.ipv6Valid() {
+			return false, true
+		}
+
+		s.zone = true
+		return false, false
+
+	default:
+		return false, true
+	}
+
+	return this.ipv6Valid(), false
+}
+
+// ipv6Valid returns true if the hex groups seen so far make up a complete IPv6 address.
+// A compressed address of one or two groups without any digits, e.g., cafe::add or
+// a::b, is more likely a name such as Cafe::add than an address, so it's not valid.
+func (this *message) ipv6Valid() bool {
+	s := &this.state.ipv6
+
+	groups := s.groups
+	if s.hexLen > 0 {
+		groups++
+	}
+
+	if s.dcolon && groups <= 2 && !s.digits {
+		return false
+	}
+
+	switch {
+	case s.hexLen > 0:
+		return (s.dcolon && s.groups+1 <= 7) || (!s.dcolon && s.groups+1 == 8)
+
+	case s.colons == 2:
+		// ends with "::", e.g., 2001:db8::, but "::" by itself is not an address
+		return s.groups > 0
+	}
+
+	return false
+}
+
+func isHexRune(r rune) bool {
+	return r >= 'a' && r <= 'f' || r >= 'A' && r <= 'F' || r >= '0' && r <= '9'
+}
+
+func isWordRune(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_'
+}
+
 func (this *message) reset() {
-	this.tokens = make(Sequence, 0, 20)
+	// Messages are reused, so all of the states are reset, not just the ones that
+	// are set while scanning
+	var fresh message
+	this.state = fresh.state
 	this.state.tokenType = TokenUnknown
-	this.state.tokenStop = false
-	this.state.dots = 0
-	this.state.prevToken = Token{}
-	this.state.single = false
-	this.state.start = 0
 	this.state.end = len(this.data)
-	this.state.cur = 0
-	//this.data = strings.ToLower(this.data)
+
+	// The values are sliced from the lowercased message, so it's lowercased once
+	// instead of for each token. Lowercasing some characters changes their length,
+	// in which case each value is lowercased on its own.
+	if this.lower = strings.ToLower(this.data); len(this.lower) != len(this.data) {
+		this.lower = ""
+	}
 }
 
 func (this *message) insideQuote() bool {
-	return this.state.single || this.state.double || this.state.angle || this.state.square
+	return this.state.quote != 0 || this.state.angle || this.state.square
+}
+
+// keyIndex returns the index of the token that is the key if a separator follows,
+// or -1 if there is none. The key is the last token, or the token between the last
+// two tokens if they are quotes, e.g., "abc"=. Punctuation can't be a key.
+func (this *message) keyIndex(kv *kvSyntax) int {
+	last := len(this.tokens) - 1
+	if last < 0 {
+		return -1
+	}
+
+	v := this.tokens[last].Value
+	if len(v) != 1 || isWordByte(v[0]) {
+		return last
+	}
+
+	if strings.IndexByte(kv.quotes, v[0]) >= 0 && last >= 2 && this.tokens[last-2].Value == v {
+		return last - 1
+	}
+
+	return -1
+}
+
+// separatorLen returns the length of the separator at the start of data, or 0 if
+// data doesn't start with one.
+func (this *kvSyntax) separatorLen(data string) int {
+	for _, sep := range this.separators {
+		if strings.HasPrefix(data, sep) {
+			return len(sep)
+		}
+	}
+
+	return 0
+}
+
+// valueLen returns the length of the value token at the start of data, which the
+// scanner found to be l long, and whether it's an escaped character. When not in a
+// quoted value, a quote character is a token of its own. In a quoted value, the
+// closing quote is a token of its own, and so is an escaped character, e.g., \".
+func (this *kvSyntax) valueLen(data string, l int, quote byte) (int, bool) {
+	if quote == 0 {
+		if l > 1 && strings.IndexByte(this.quotes, data[0]) >= 0 {
+			return 1, false
+		}
+
+		return l, false
+	}
+
+	for i := 0; i < l; i++ {
+		switch {
+		case this.escaped(data[i:], quote):
+			if i == 0 {
+				return 2, true
+			}
+
+			return i, false
+
+		case data[i] == quote:
+			if i == 0 {
+				return 1, false
+			}
+
+			return i, false
+		}
+	}
+
+	return l, false
+}
+
+// escaped returns true if data starts with an escaped character in a value quoted
+// by quote. If the escape character is itself a quote character, it only escapes
+// itself, e.g., "", otherwise it escapes the quote and itself, e.g., \" and \\.
+func (this *kvSyntax) escaped(data string, quote byte) bool {
+	if this.escape == 0 || len(data) < 2 || data[0] != this.escape {
+		return false
+	}
+
+	if strings.IndexByte(this.quotes, this.escape) >= 0 {
+		return this.escape == quote && data[1] == quote
+	}
+
+	return data[1] == quote || data[1] == this.escape
 }
@@ -15,8 +15,12 @@
 package sequence
 
 import (
+	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/dataence/assert"
 )
@@ -58,486 +62,486 @@ func TestMessageSignature(t *testing.T) {
 var (
 	messages map[string]Sequence = map[string]Sequence{
 		"Jan 12 06:49:41 irc sshd[7034]: pam_unix(sshd:auth): authentication failure; logname= uid=0 euid=0 tty=ssh ruser= rhost=218-161-81-238.hinet-ip.hinet.net  user=root": Sequence{
-			Token{TokenTime, FieldUnknown, "jan 12 06:49:41", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "irc", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "sshd", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "[", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "7034", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "]", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "pam_unix", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "(", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "sshd", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "auth", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ")", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "authentication", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "failure", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ";", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "logname", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "uid", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "0", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "euid", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "0", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "tty", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenString, FieldUnknown, "ssh", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "ruser", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "rhost", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenString, FieldUnknown, "218-161-81-238.hinet-ip.hinet.net", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "user", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenString, FieldUnknown, "root", false, true, 0},
+			Token{TokenTime, FieldUnknown, "jan 12 06:49:41", false, false, 0, 0, 15, "Jan 12 06:49:41"},
+			Token{TokenLiteral, FieldUnknown, "irc", false, false, 0, 16, 19, "irc"},
+			Token{TokenLiteral, FieldUnknown, "sshd", false, false, 0, 20, 24, "sshd"},
+			Token{TokenLiteral, FieldUnknown, "[", false, false, 0, 24, 25, "["},
+			Token{TokenInteger, FieldUnknown, "7034", false, false, 0, 25, 29, "7034"},
+			Token{TokenLiteral, FieldUnknown, "]", false, false, 0, 29, 30, "]"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 30, 31, ":"},
+			Token{TokenLiteral, FieldUnknown, "pam_unix", false, false, 0, 32, 40, "pam_unix"},
+			Token{TokenLiteral, FieldUnknown, "(", false, false, 0, 40, 41, "("},
+			Token{TokenLiteral, FieldUnknown, "sshd", false, false, 0, 41, 45, "sshd"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 45, 46, ":"},
+			Token{TokenLiteral, FieldUnknown, "auth", false, false, 0, 46, 50, "auth"},
+			Token{TokenLiteral, FieldUnknown, ")", false, false, 0, 50, 51, ")"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 51, 52, ":"},
+			Token{TokenLiteral, FieldUnknown, "authentication", false, false, 0, 53, 67, "authentication"},
+			Token{TokenLiteral, FieldUnknown, "failure", false, false, 0, 68, 75, "failure"},
+			Token{TokenLiteral, FieldUnknown, ";", false, false, 0, 75, 76, ";"},
+			Token{TokenLiteral, FieldUnknown, "logname", true, false, 0, 77, 84, "logname"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 84, 85, "="},
+			Token{TokenLiteral, FieldUnknown, "uid", true, false, 0, 86, 89, "uid"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 89, 90, "="},
+			Token{TokenInteger, FieldUnknown, "0", false, true, 0, 90, 91, "0"},
+			Token{TokenLiteral, FieldUnknown, "euid", true, false, 0, 92, 96, "euid"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 96, 97, "="},
+			Token{TokenInteger, FieldUnknown, "0", false, true, 0, 97, 98, "0"},
+			Token{TokenLiteral, FieldUnknown, "tty", true, false, 0, 99, 102, "tty"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 102, 103, "="},
+			Token{TokenString, FieldUnknown, "ssh", false, true, 0, 103, 106, "ssh"},
+			Token{TokenLiteral, FieldUnknown, "ruser", true, false, 0, 107, 112, "ruser"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 112, 113, "="},
+			Token{TokenLiteral, FieldUnknown, "rhost", true, false, 0, 114, 119, "rhost"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 119, 120, "="},
+			Token{TokenString, FieldUnknown, "218-161-81-238.hinet-ip.hinet.net", false, true, 0, 120, 153, "218-161-81-238.hinet-ip.hinet.net"},
+			Token{TokenLiteral, FieldUnknown, "user", true, false, 0, 155, 159, "user"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 159, 160, "="},
+			Token{TokenString, FieldUnknown, "root", false, true, 0, 160, 164, "root"},
 		},
 
 		"Jan 12 06:49:42 irc sshd[7034]: Failed password for root from 218.161.81.238 port 4228 ssh2": Sequence{
-			Token{TokenTime, FieldUnknown, "jan 12 06:49:42", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "irc", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "sshd", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "[", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "7034", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "]", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "failed", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "password", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "for", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "root", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "from", false, false, 0},
-			Token{TokenIPv4, FieldUnknown, "218.161.81.238", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "port", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "4228", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "ssh2", false, false, 0},
+			Token{TokenTime, FieldUnknown, "jan 12 06:49:42", false, false, 0, 0, 15, "Jan 12 06:49:42"},
+			Token{TokenLiteral, FieldUnknown, "irc", false, false, 0, 16, 19, "irc"},
+			Token{TokenLiteral, FieldUnknown, "sshd", false, false, 0, 20, 24, "sshd"},
+			Token{TokenLiteral, FieldUnknown, "[", false, false, 0, 24, 25, "["},
+			Token{TokenInteger, FieldUnknown, "7034", false, false, 0, 25, 29, "7034"},
+			Token{TokenLiteral, FieldUnknown, "]", false, false, 0, 29, 30, "]"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 30, 31, ":"},
+			Token{TokenLiteral, FieldUnknown, "failed", false, false, 0, 32, 38, "Failed"},
+			Token{TokenLiteral, FieldUnknown, "password", false, false, 0, 39, 47, "password"},
+			Token{TokenLiteral, FieldUnknown, "for", false, false, 0, 48, 51, "for"},
+			Token{TokenLiteral, FieldUnknown, "root", false, false, 0, 52, 56, "root"},
+			Token{TokenLiteral, FieldUnknown, "from", false, false, 0, 57, 61, "from"},
+			Token{TokenIPv4, FieldUnknown, "218.161.81.238", false, false, 0, 62, 76, "218.161.81.238"},
+			Token{TokenLiteral, FieldUnknown, "port", false, false, 0, 77, 81, "port"},
+			Token{TokenInteger, FieldUnknown, "4228", false, false, 0, 82, 86, "4228"},
+			Token{TokenLiteral, FieldUnknown, "ssh2", false, false, 0, 87, 91, "ssh2"},
 		},
 
 		//"Jan 13 17:25:59 jlz sshd[19322]: Accepted password for jlz from 108.61.8.124 port 56731 ssh2",
 		//"Jan 12 14:44:48 irc sshd[11084]: Accepted publickey for jlz from 76.21.0.16 port 36609 ssh2",
 		"Jan 12 06:49:56 irc last message repeated 6 times": Sequence{
-			Token{TokenTime, FieldUnknown, "jan 12 06:49:56", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "irc", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "last", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "message", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "repeated", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "6", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "times", false, false, 0},
+			Token{TokenTime, FieldUnknown, "jan 12 06:49:56", false, false, 0, 0, 15, "Jan 12 06:49:56"},
+			Token{TokenLiteral, FieldUnknown, "irc", false, false, 0, 16, 19, "irc"},
+			Token{TokenLiteral, FieldUnknown, "last", false, false, 0, 20, 24, "last"},
+			Token{TokenLiteral, FieldUnknown, "message", false, false, 0, 25, 32, "message"},
+			Token{TokenLiteral, FieldUnknown, "repeated", false, false, 0, 33, 41, "repeated"},
+			Token{TokenInteger, FieldUnknown, "6", false, false, 0, 42, 43, "6"},
+			Token{TokenLiteral, FieldUnknown, "times", false, false, 0, 44, 49, "times"},
 		},
 
 		"9.26.157.44 - - [16/Jan/2003:21:22:59 -0500] \"GET http://WSsamples HTTP/1.1\" 301 315": Sequence{
-			Token{TokenIPv4, FieldUnknown, "9.26.157.44", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "-", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "-", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "[", false, false, 0},
-			Token{TokenTime, FieldUnknown, "16/jan/2003:21:22:59 -0500", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "]", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "\"", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "get", false, false, 0},
-			Token{TokenURL, FieldUnknown, "http://wssamples", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "http/1.1", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "\"", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "301", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "315", false, false, 0},
+			Token{TokenIPv4, FieldUnknown, "9.26.157.44", false, false, 0, 0, 11, "9.26.157.44"},
+			Token{TokenLiteral, FieldUnknown, "-", false, false, 0, 12, 13, "-"},
+			Token{TokenLiteral, FieldUnknown, "-", false, false, 0, 14, 15, "-"},
+			Token{TokenLiteral, FieldUnknown, "[", false, false, 0, 16, 17, "["},
+			Token{TokenTime, FieldUnknown, "16/jan/2003:21:22:59 -0500", false, false, 0, 17, 43, "16/Jan/2003:21:22:59 -0500"},
+			Token{TokenLiteral, FieldUnknown, "]", false, false, 0, 43, 44, "]"},
+			Token{TokenLiteral, FieldUnknown, "\"", false, false, 0, 45, 46, "\""},
+			Token{TokenLiteral, FieldUnknown, "get", false, false, 0, 46, 49, "GET"},
+			Token{TokenURL, FieldUnknown, "http://wssamples", false, false, 0, 50, 66, "http://WSsamples"},
+			Token{TokenLiteral, FieldUnknown, "http/1.1", false, false, 0, 67, 75, "HTTP/1.1"},
+			Token{TokenLiteral, FieldUnknown, "\"", false, false, 0, 75, 76, "\""},
+			Token{TokenInteger, FieldUnknown, "301", false, false, 0, 77, 80, "301"},
+			Token{TokenInteger, FieldUnknown, "315", false, false, 0, 81, 84, "315"},
 		},
 
 		"9.26.157.45 - - [16/Jan/2003:21:22:59 -0500] \"GET /WSsamples/ HTTP/1.1\" 200 1576": Sequence{
-			Token{TokenIPv4, FieldUnknown, "9.26.157.45", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "-", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "-", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "[", false, false, 0},
-			Token{TokenTime, FieldUnknown, "16/jan/2003:21:22:59 -0500", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "]", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "\"", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "get", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "/wssamples/", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "http/1.1", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "\"", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "200", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "1576", false, false, 0},
+			Token{TokenIPv4, FieldUnknown, "9.26.157.45", false, false, 0, 0, 11, "9.26.157.45"},
+			Token{TokenLiteral, FieldUnknown, "-", false, false, 0, 12, 13, "-"},
+			Token{TokenLiteral, FieldUnknown, "-", false, false, 0, 14, 15, "-"},
+			Token{TokenLiteral, FieldUnknown, "[", false, false, 0, 16, 17, "["},
+			Token{TokenTime, FieldUnknown, "16/jan/2003:21:22:59 -0500", false, false, 0, 17, 43, "16/Jan/2003:21:22:59 -0500"},
+			Token{TokenLiteral, FieldUnknown, "]", false, false, 0, 43, 44, "]"},
+			Token{TokenLiteral, FieldUnknown, "\"", false, false, 0, 45, 46, "\""},
+			Token{TokenLiteral, FieldUnknown, "get", false, false, 0, 46, 49, "GET"},
+			Token{TokenLiteral, FieldUnknown, "/wssamples/", false, false, 0, 50, 61, "/WSsamples/"},
+			Token{TokenLiteral, FieldUnknown, "http/1.1", false, false, 0, 62, 70, "HTTP/1.1"},
+			Token{TokenLiteral, FieldUnknown, "\"", false, false, 0, 70, 71, "\""},
+			Token{TokenInteger, FieldUnknown, "200", false, false, 0, 72, 75, "200"},
+			Token{TokenInteger, FieldUnknown, "1576", false, false, 0, 76, 80, "1576"},
 		},
 
 		"209.36.88.3 - - [03/May/2004:01:19:07 +0000] \"GET http://npkclzicp.xihudohtd.ngm.au/abramson/eiyscmeqix.ac;jsessionid=b0l0v000u0?sid=00000000&sy=afr&kw=goldman&pb=fin&dt=selectRange&dr=0month&so=relevance&st=nw&ss=AFR&sf=article&rc=00&clsPage=0&docID=FIN0000000R0JL000D00 HTTP/1.0\" 200 27981": Sequence{
-			Token{TokenIPv4, FieldUnknown, "209.36.88.3", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "-", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "-", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "[", false, false, 0},
-			Token{TokenTime, FieldUnknown, "03/may/2004:01:19:07 +0000", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "]", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "\"", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "get", false, false, 0},
-			Token{TokenURL, FieldUnknown, strings.ToLower("http://npkclzicp.xihudohtd.ngm.au/abramson/eiyscmeqix.ac;jsessionid=b0l0v000u0?sid=00000000&sy=afr&kw=goldman&pb=fin&dt=selectRange&dr=0month&so=relevance&st=nw&ss=AFR&sf=article&rc=00&clsPage=0&docID=FIN0000000R0JL000D00"), false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "http/1.0", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "\"", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "200", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "27981", false, false, 0},
+			Token{TokenIPv4, FieldUnknown, "209.36.88.3", false, false, 0, 0, 11, "209.36.88.3"},
+			Token{TokenLiteral, FieldUnknown, "-", false, false, 0, 12, 13, "-"},
+			Token{TokenLiteral, FieldUnknown, "-", false, false, 0, 14, 15, "-"},
+			Token{TokenLiteral, FieldUnknown, "[", false, false, 0, 16, 17, "["},
+			Token{TokenTime, FieldUnknown, "03/may/2004:01:19:07 +0000", false, false, 0, 17, 43, "03/May/2004:01:19:07 +0000"},
+			Token{TokenLiteral, FieldUnknown, "]", false, false, 0, 43, 44, "]"},
+			Token{TokenLiteral, FieldUnknown, "\"", false, false, 0, 45, 46, "\""},
+			Token{TokenLiteral, FieldUnknown, "get", false, false, 0, 46, 49, "GET"},
+			Token{TokenURL, FieldUnknown, strings.ToLower("http://npkclzicp.xihudohtd.ngm.au/abramson/eiyscmeqix.ac;jsessionid=b0l0v000u0?sid=00000000&sy=afr&kw=goldman&pb=fin&dt=selectRange&dr=0month&so=relevance&st=nw&ss=AFR&sf=article&rc=00&clsPage=0&docID=FIN0000000R0JL000D00"), false, false, 0, 50, 271, "http://npkclzicp.xihudohtd.ngm.au/abramson/eiyscmeqix.ac;jsessionid=b0l0v000u0?sid=00000000&sy=afr&kw=goldman&pb=fin&dt=selectRange&dr=0month&so=relevance&st=nw&ss=AFR&sf=article&rc=00&clsPage=0&docID=FIN0000000R0JL000D00"},
+			Token{TokenLiteral, FieldUnknown, "http/1.0", false, false, 0, 272, 280, "HTTP/1.0"},
+			Token{TokenLiteral, FieldUnknown, "\"", false, false, 0, 280, 281, "\""},
+			Token{TokenInteger, FieldUnknown, "200", false, false, 0, 282, 285, "200"},
+			Token{TokenInteger, FieldUnknown, "27981", false, false, 0, 286, 291, "27981"},
 		},
 
 		"4/5/2012 17:55,172.23.1.101,1101,172.23.0.10,139, Generic Protocol Command Decode,3, [1:2100538:17] GPL NETBIOS SMB IPC$ unicode share access ,TCP TTL:128 TOS:0x0 ID:1643 IpLen:20 DgmLen:122 DF,***AP*** Seq: 0xCEF93F32  Ack: 0xC40C0BB  n: 0xFC9C  TcpLen: 20,": Sequence{
-			Token{TokenTime, FieldUnknown, "4/5/2012 17:55", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ",", false, false, 0},
-			Token{TokenIPv4, FieldUnknown, "172.23.1.101", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ",", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "1101", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ",", false, false, 0},
-			Token{TokenIPv4, FieldUnknown, "172.23.0.10", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ",", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "139", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ",", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "generic", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "protocol", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "command", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "decode", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ",", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "3", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ",", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "[", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "1", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "2100538", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "17", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "]", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "gpl", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "netbios", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "smb", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "ipc$", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "unicode", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "share", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "access", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ",", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "tcp", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "ttl", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "128", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "tos", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "0x0", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "id", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "1643", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "iplen", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "20", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "dgmlen", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "122", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "df", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ",", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "***ap***", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "seq", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "0xcef93f32", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "ack", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "0xc40c0bb", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "n", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "0xfc9c", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "tcplen", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "20", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ",", false, false, 0},
+			Token{TokenTime, FieldUnknown, "4/5/2012 17:55", false, false, 0, 0, 14, "4/5/2012 17:55"},
+			Token{TokenLiteral, FieldUnknown, ",", false, false, 0, 14, 15, ","},
+			Token{TokenIPv4, FieldUnknown, "172.23.1.101", false, false, 0, 15, 27, "172.23.1.101"},
+			Token{TokenLiteral, FieldUnknown, ",", false, false, 0, 27, 28, ","},
+			Token{TokenInteger, FieldUnknown, "1101", false, false, 0, 28, 32, "1101"},
+			Token{TokenLiteral, FieldUnknown, ",", false, false, 0, 32, 33, ","},
+			Token{TokenIPv4, FieldUnknown, "172.23.0.10", false, false, 0, 33, 44, "172.23.0.10"},
+			Token{TokenLiteral, FieldUnknown, ",", false, false, 0, 44, 45, ","},
+			Token{TokenInteger, FieldUnknown, "139", false, false, 0, 45, 48, "139"},
+			Token{TokenLiteral, FieldUnknown, ",", false, false, 0, 48, 49, ","},
+			Token{TokenLiteral, FieldUnknown, "generic", false, false, 0, 50, 57, "Generic"},
+			Token{TokenLiteral, FieldUnknown, "protocol", false, false, 0, 58, 66, "Protocol"},
+			Token{TokenLiteral, FieldUnknown, "command", false, false, 0, 67, 74, "Command"},
+			Token{TokenLiteral, FieldUnknown, "decode", false, false, 0, 75, 81, "Decode"},
+			Token{TokenLiteral, FieldUnknown, ",", false, false, 0, 81, 82, ","},
+			Token{TokenInteger, FieldUnknown, "3", false, false, 0, 82, 83, "3"},
+			Token{TokenLiteral, FieldUnknown, ",", false, false, 0, 83, 84, ","},
+			Token{TokenLiteral, FieldUnknown, "[", false, false, 0, 85, 86, "["},
+			Token{TokenInteger, FieldUnknown, "1", false, false, 0, 86, 87, "1"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 87, 88, ":"},
+			Token{TokenInteger, FieldUnknown, "2100538", false, false, 0, 88, 95, "2100538"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 95, 96, ":"},
+			Token{TokenInteger, FieldUnknown, "17", false, false, 0, 96, 98, "17"},
+			Token{TokenLiteral, FieldUnknown, "]", false, false, 0, 98, 99, "]"},
+			Token{TokenLiteral, FieldUnknown, "gpl", false, false, 0, 100, 103, "GPL"},
+			Token{TokenLiteral, FieldUnknown, "netbios", false, false, 0, 104, 111, "NETBIOS"},
+			Token{TokenLiteral, FieldUnknown, "smb", false, false, 0, 112, 115, "SMB"},
+			Token{TokenLiteral, FieldUnknown, "ipc$", false, false, 0, 116, 120, "IPC$"},
+			Token{TokenLiteral, FieldUnknown, "unicode", false, false, 0, 121, 128, "unicode"},
+			Token{TokenLiteral, FieldUnknown, "share", false, false, 0, 129, 134, "share"},
+			Token{TokenLiteral, FieldUnknown, "access", false, false, 0, 135, 141, "access"},
+			Token{TokenLiteral, FieldUnknown, ",", false, false, 0, 142, 143, ","},
+			Token{TokenLiteral, FieldUnknown, "tcp", false, false, 0, 143, 146, "TCP"},
+			Token{TokenLiteral, FieldUnknown, "ttl", false, false, 0, 147, 150, "TTL"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 150, 151, ":"},
+			Token{TokenInteger, FieldUnknown, "128", false, false, 0, 151, 154, "128"},
+			Token{TokenLiteral, FieldUnknown, "tos", false, false, 0, 155, 158, "TOS"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 158, 159, ":"},
+			Token{TokenLiteral, FieldUnknown, "0x0", false, false, 0, 159, 162, "0x0"},
+			Token{TokenLiteral, FieldUnknown, "id", false, false, 0, 163, 165, "ID"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 165, 166, ":"},
+			Token{TokenInteger, FieldUnknown, "1643", false, false, 0, 166, 170, "1643"},
+			Token{TokenLiteral, FieldUnknown, "iplen", false, false, 0, 171, 176, "IpLen"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 176, 177, ":"},
+			Token{TokenInteger, FieldUnknown, "20", false, false, 0, 177, 179, "20"},
+			Token{TokenLiteral, FieldUnknown, "dgmlen", false, false, 0, 180, 186, "DgmLen"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 186, 187, ":"},
+			Token{TokenInteger, FieldUnknown, "122", false, false, 0, 187, 190, "122"},
+			Token{TokenLiteral, FieldUnknown, "df", false, false, 0, 191, 193, "DF"},
+			Token{TokenLiteral, FieldUnknown, ",", false, false, 0, 193, 194, ","},
+			Token{TokenLiteral, FieldUnknown, "***ap***", false, false, 0, 194, 202, "***AP***"},
+			Token{TokenLiteral, FieldUnknown, "seq", false, false, 0, 203, 206, "Seq"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 206, 207, ":"},
+			Token{TokenLiteral, FieldUnknown, "0xcef93f32", false, false, 0, 208, 218, "0xCEF93F32"},
+			Token{TokenLiteral, FieldUnknown, "ack", false, false, 0, 220, 223, "Ack"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 223, 224, ":"},
+			Token{TokenLiteral, FieldUnknown, "0xc40c0bb", false, false, 0, 225, 234, "0xC40C0BB"},
+			Token{TokenLiteral, FieldUnknown, "n", false, false, 0, 236, 237, "n"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 237, 238, ":"},
+			Token{TokenLiteral, FieldUnknown, "0xfc9c", false, false, 0, 239, 245, "0xFC9C"},
+			Token{TokenLiteral, FieldUnknown, "tcplen", false, false, 0, 247, 253, "TcpLen"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 253, 254, ":"},
+			Token{TokenInteger, FieldUnknown, "20", false, false, 0, 255, 257, "20"},
+			Token{TokenLiteral, FieldUnknown, ",", false, false, 0, 257, 258, ","},
 		},
 
 		"2012-04-05 17:51:26     Local4.Info     172.23.0.1      %ASA-6-302016: Teardown UDP connection 1315632 for inside:172.23.0.2/514 to identity:172.23.0.1/514 duration 0:09:23 bytes 7999": Sequence{
-			Token{TokenTime, FieldUnknown, "2012-04-05 17:51:26", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "local4.info", false, false, 0},
-			Token{TokenIPv4, FieldUnknown, "172.23.0.1", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "%asa-6-302016", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "teardown", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "udp", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "connection", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "1315632", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "for", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "inside", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenIPv4, FieldUnknown, "172.23.0.2", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "/", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "514", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "to", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "identity", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenIPv4, FieldUnknown, "172.23.0.1", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "/", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "514", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "duration", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "0", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "09", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "23", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "bytes", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "7999", false, false, 0},
+			Token{TokenTime, FieldUnknown, "2012-04-05 17:51:26", false, false, 0, 0, 19, "2012-04-05 17:51:26"},
+			Token{TokenLiteral, FieldUnknown, "local4.info", false, false, 0, 24, 35, "Local4.Info"},
+			Token{TokenIPv4, FieldUnknown, "172.23.0.1", false, false, 0, 40, 50, "172.23.0.1"},
+			Token{TokenLiteral, FieldUnknown, "%asa-6-302016", false, false, 0, 56, 69, "%ASA-6-302016"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 69, 70, ":"},
+			Token{TokenLiteral, FieldUnknown, "teardown", false, false, 0, 71, 79, "Teardown"},
+			Token{TokenLiteral, FieldUnknown, "udp", false, false, 0, 80, 83, "UDP"},
+			Token{TokenLiteral, FieldUnknown, "connection", false, false, 0, 84, 94, "connection"},
+			Token{TokenInteger, FieldUnknown, "1315632", false, false, 0, 95, 102, "1315632"},
+			Token{TokenLiteral, FieldUnknown, "for", false, false, 0, 103, 106, "for"},
+			Token{TokenLiteral, FieldUnknown, "inside", false, false, 0, 107, 113, "inside"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 113, 114, ":"},
+			Token{TokenIPv4, FieldUnknown, "172.23.0.2", false, false, 0, 114, 124, "172.23.0.2"},
+			Token{TokenLiteral, FieldUnknown, "/", false, false, 0, 124, 125, "/"},
+			Token{TokenInteger, FieldUnknown, "514", false, false, 0, 125, 128, "514"},
+			Token{TokenLiteral, FieldUnknown, "to", false, false, 0, 129, 131, "to"},
+			Token{TokenLiteral, FieldUnknown, "identity", false, false, 0, 132, 140, "identity"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 140, 141, ":"},
+			Token{TokenIPv4, FieldUnknown, "172.23.0.1", false, false, 0, 141, 151, "172.23.0.1"},
+			Token{TokenLiteral, FieldUnknown, "/", false, false, 0, 151, 152, "/"},
+			Token{TokenInteger, FieldUnknown, "514", false, false, 0, 152, 155, "514"},
+			Token{TokenLiteral, FieldUnknown, "duration", false, false, 0, 156, 164, "duration"},
+			Token{TokenInteger, FieldUnknown, "0", false, false, 0, 165, 166, "0"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 166, 167, ":"},
+			Token{TokenInteger, FieldUnknown, "09", false, false, 0, 167, 169, "09"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 169, 170, ":"},
+			Token{TokenInteger, FieldUnknown, "23", false, false, 0, 170, 172, "23"},
+			Token{TokenLiteral, FieldUnknown, "bytes", false, false, 0, 173, 178, "bytes"},
+			Token{TokenInteger, FieldUnknown, "7999", false, false, 0, 179, 183, "7999"},
 		},
 
 		"2012-04-05 17:54:47     Local4.Info     172.23.0.1      %ASA-6-302015: Built outbound UDP connection 1315679 for outside:193.0.14.129/53 (193.0.14.129/53) to inside:172.23.0.10/64048 (10.32.0.1/52130)": Sequence{
-			Token{TokenTime, FieldUnknown, "2012-04-05 17:54:47", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "local4.info", false, false, 0},
-			Token{TokenIPv4, FieldUnknown, "172.23.0.1", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "%asa-6-302015", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "built", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "outbound", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "udp", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "connection", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "1315679", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "for", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "outside", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenIPv4, FieldUnknown, "193.0.14.129", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "/", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "53", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "(", false, false, 0},
-			Token{TokenIPv4, FieldUnknown, "193.0.14.129", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "/", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "53", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ")", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "to", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "inside", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenIPv4, FieldUnknown, "172.23.0.10", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "/", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "64048", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "(", false, false, 0},
-			Token{TokenIPv4, FieldUnknown, "10.32.0.1", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "/", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "52130", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ")", false, false, 0},
+			Token{TokenTime, FieldUnknown, "2012-04-05 17:54:47", false, false, 0, 0, 19, "2012-04-05 17:54:47"},
+			Token{TokenLiteral, FieldUnknown, "local4.info", false, false, 0, 24, 35, "Local4.Info"},
+			Token{TokenIPv4, FieldUnknown, "172.23.0.1", false, false, 0, 40, 50, "172.23.0.1"},
+			Token{TokenLiteral, FieldUnknown, "%asa-6-302015", false, false, 0, 56, 69, "%ASA-6-302015"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 69, 70, ":"},
+			Token{TokenLiteral, FieldUnknown, "built", false, false, 0, 71, 76, "Built"},
+			Token{TokenLiteral, FieldUnknown, "outbound", false, false, 0, 77, 85, "outbound"},
+			Token{TokenLiteral, FieldUnknown, "udp", false, false, 0, 86, 89, "UDP"},
+			Token{TokenLiteral, FieldUnknown, "connection", false, false, 0, 90, 100, "connection"},
+			Token{TokenInteger, FieldUnknown, "1315679", false, false, 0, 101, 108, "1315679"},
+			Token{TokenLiteral, FieldUnknown, "for", false, false, 0, 109, 112, "for"},
+			Token{TokenLiteral, FieldUnknown, "outside", false, false, 0, 113, 120, "outside"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 120, 121, ":"},
+			Token{TokenIPv4, FieldUnknown, "193.0.14.129", false, false, 0, 121, 133, "193.0.14.129"},
+			Token{TokenLiteral, FieldUnknown, "/", false, false, 0, 133, 134, "/"},
+			Token{TokenInteger, FieldUnknown, "53", false, false, 0, 134, 136, "53"},
+			Token{TokenLiteral, FieldUnknown, "(", false, false, 0, 137, 138, "("},
+			Token{TokenIPv4, FieldUnknown, "193.0.14.129", false, false, 0, 138, 150, "193.0.14.129"},
+			Token{TokenLiteral, FieldUnknown, "/", false, false, 0, 150, 151, "/"},
+			Token{TokenInteger, FieldUnknown, "53", false, false, 0, 151, 153, "53"},
+			Token{TokenLiteral, FieldUnknown, ")", false, false, 0, 153, 154, ")"},
+			Token{TokenLiteral, FieldUnknown, "to", false, false, 0, 155, 157, "to"},
+			Token{TokenLiteral, FieldUnknown, "inside", false, false, 0, 158, 164, "inside"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 164, 165, ":"},
+			Token{TokenIPv4, FieldUnknown, "172.23.0.10", false, false, 0, 165, 176, "172.23.0.10"},
+			Token{TokenLiteral, FieldUnknown, "/", false, false, 0, 176, 177, "/"},
+			Token{TokenInteger, FieldUnknown, "64048", false, false, 0, 177, 182, "64048"},
+			Token{TokenLiteral, FieldUnknown, "(", false, false, 0, 183, 184, "("},
+			Token{TokenIPv4, FieldUnknown, "10.32.0.1", false, false, 0, 184, 193, "10.32.0.1"},
+			Token{TokenLiteral, FieldUnknown, "/", false, false, 0, 193, 194, "/"},
+			Token{TokenInteger, FieldUnknown, "52130", false, false, 0, 194, 199, "52130"},
+			Token{TokenLiteral, FieldUnknown, ")", false, false, 0, 199, 200, ")"},
 		},
 
 		"id=firewall time=\"2005-03-18 14:01:43\" fw=TOPSEC priv=4 recorder=kernel type=conn policy=504 proto=TCP rule=deny src=210.82.121.91 sport=4958 dst=61.229.37.85 dport=23124 smac=00:0b:5f:b2:1d:80 dmac=00:04:c1:8b:d8:82": Sequence{
-			Token{TokenLiteral, FieldUnknown, "id", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenString, FieldUnknown, "firewall", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "time", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "\"", false, false, 0},
-			Token{TokenTime, FieldUnknown, "2005-03-18 14:01:43", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "\"", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "fw", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenString, FieldUnknown, "topsec", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "priv", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "4", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "recorder", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenString, FieldUnknown, "kernel", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "type", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenString, FieldUnknown, "conn", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "policy", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "504", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "proto", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenString, FieldUnknown, "tcp", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "rule", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenString, FieldUnknown, "deny", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "src", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenIPv4, FieldUnknown, "210.82.121.91", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "sport", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "4958", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "dst", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenIPv4, FieldUnknown, "61.229.37.85", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "dport", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "23124", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "smac", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenMac, FieldUnknown, "00:0b:5f:b2:1d:80", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "dmac", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenMac, FieldUnknown, "00:04:c1:8b:d8:82", false, true, 0},
+			Token{TokenLiteral, FieldUnknown, "id", true, false, 0, 0, 2, "id"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 2, 3, "="},
+			Token{TokenString, FieldUnknown, "firewall", false, true, 0, 3, 11, "firewall"},
+			Token{TokenLiteral, FieldUnknown, "time", true, false, 0, 12, 16, "time"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 16, 17, "="},
+			Token{TokenLiteral, FieldUnknown, "\"", false, false, 0, 17, 18, "\""},
+			Token{TokenTime, FieldUnknown, "2005-03-18 14:01:43", false, true, 0, 18, 37, "2005-03-18 14:01:43"},
+			Token{TokenLiteral, FieldUnknown, "\"", false, false, 0, 37, 38, "\""},
+			Token{TokenLiteral, FieldUnknown, "fw", true, false, 0, 39, 41, "fw"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 41, 42, "="},
+			Token{TokenString, FieldUnknown, "topsec", false, true, 0, 42, 48, "TOPSEC"},
+			Token{TokenLiteral, FieldUnknown, "priv", true, false, 0, 49, 53, "priv"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 53, 54, "="},
+			Token{TokenInteger, FieldUnknown, "4", false, true, 0, 54, 55, "4"},
+			Token{TokenLiteral, FieldUnknown, "recorder", true, false, 0, 56, 64, "recorder"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 64, 65, "="},
+			Token{TokenString, FieldUnknown, "kernel", false, true, 0, 65, 71, "kernel"},
+			Token{TokenLiteral, FieldUnknown, "type", true, false, 0, 72, 76, "type"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 76, 77, "="},
+			Token{TokenString, FieldUnknown, "conn", false, true, 0, 77, 81, "conn"},
+			Token{TokenLiteral, FieldUnknown, "policy", true, false, 0, 82, 88, "policy"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 88, 89, "="},
+			Token{TokenInteger, FieldUnknown, "504", false, true, 0, 89, 92, "504"},
+			Token{TokenLiteral, FieldUnknown, "proto", true, false, 0, 93, 98, "proto"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 98, 99, "="},
+			Token{TokenString, FieldUnknown, "tcp", false, true, 0, 99, 102, "TCP"},
+			Token{TokenLiteral, FieldUnknown, "rule", true, false, 0, 103, 107, "rule"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 107, 108, "="},
+			Token{TokenString, FieldUnknown, "deny", false, true, 0, 108, 112, "deny"},
+			Token{TokenLiteral, FieldUnknown, "src", true, false, 0, 113, 116, "src"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 116, 117, "="},
+			Token{TokenIPv4, FieldUnknown, "210.82.121.91", false, true, 0, 117, 130, "210.82.121.91"},
+			Token{TokenLiteral, FieldUnknown, "sport", true, false, 0, 131, 136, "sport"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 136, 137, "="},
+			Token{TokenInteger, FieldUnknown, "4958", false, true, 0, 137, 141, "4958"},
+			Token{TokenLiteral, FieldUnknown, "dst", true, false, 0, 142, 145, "dst"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 145, 146, "="},
+			Token{TokenIPv4, FieldUnknown, "61.229.37.85", false, true, 0, 146, 158, "61.229.37.85"},
+			Token{TokenLiteral, FieldUnknown, "dport", true, false, 0, 159, 164, "dport"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 164, 165, "="},
+			Token{TokenInteger, FieldUnknown, "23124", false, true, 0, 165, 170, "23124"},
+			Token{TokenLiteral, FieldUnknown, "smac", true, false, 0, 171, 175, "smac"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 175, 176, "="},
+			Token{TokenMac, FieldUnknown, "00:0b:5f:b2:1d:80", false, true, 0, 176, 193, "00:0b:5f:b2:1d:80"},
+			Token{TokenLiteral, FieldUnknown, "dmac", true, false, 0, 194, 198, "dmac"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 198, 199, "="},
+			Token{TokenMac, FieldUnknown, "00:04:c1:8b:d8:82", false, true, 0, 199, 216, "00:04:c1:8b:d8:82"},
 		},
 
 		"mar 01 09:42:03.875 pffbisvr smtp[2424]: 334 warning: denied access to command 'ehlo vishwakstg1.msn.vishwak.net' from [209.235.210.30]": Sequence{
-			Token{TokenTime, FieldUnknown, "mar 01 09:42:03.875", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "pffbisvr", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "smtp", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "[", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "2424", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "]", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "334", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "warning", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "denied", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "access", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "to", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "command", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "'", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "ehlo vishwakstg1.msn.vishwak.net", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "'", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "from", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "[", false, false, 0},
-			Token{TokenIPv4, FieldUnknown, "209.235.210.30", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "]", false, false, 0},
+			Token{TokenTime, FieldUnknown, "mar 01 09:42:03.875", false, false, 0, 0, 19, "mar 01 09:42:03.875"},
+			Token{TokenLiteral, FieldUnknown, "pffbisvr", false, false, 0, 20, 28, "pffbisvr"},
+			Token{TokenLiteral, FieldUnknown, "smtp", false, false, 0, 29, 33, "smtp"},
+			Token{TokenLiteral, FieldUnknown, "[", false, false, 0, 33, 34, "["},
+			Token{TokenInteger, FieldUnknown, "2424", false, false, 0, 34, 38, "2424"},
+			Token{TokenLiteral, FieldUnknown, "]", false, false, 0, 38, 39, "]"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 39, 40, ":"},
+			Token{TokenInteger, FieldUnknown, "334", false, false, 0, 41, 44, "334"},
+			Token{TokenLiteral, FieldUnknown, "warning", false, false, 0, 45, 52, "warning"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 52, 53, ":"},
+			Token{TokenLiteral, FieldUnknown, "denied", false, false, 0, 54, 60, "denied"},
+			Token{TokenLiteral, FieldUnknown, "access", false, false, 0, 61, 67, "access"},
+			Token{TokenLiteral, FieldUnknown, "to", false, false, 0, 68, 70, "to"},
+			Token{TokenLiteral, FieldUnknown, "command", false, false, 0, 71, 78, "command"},
+			Token{TokenLiteral, FieldUnknown, "'", false, false, 0, 79, 80, "'"},
+			Token{TokenLiteral, FieldUnknown, "ehlo vishwakstg1.msn.vishwak.net", false, false, 0, 80, 112, "ehlo vishwakstg1.msn.vishwak.net"},
+			Token{TokenLiteral, FieldUnknown, "'", false, false, 0, 112, 113, "'"},
+			Token{TokenLiteral, FieldUnknown, "from", false, false, 0, 114, 118, "from"},
+			Token{TokenLiteral, FieldUnknown, "[", false, false, 0, 119, 120, "["},
+			Token{TokenIPv4, FieldUnknown, "209.235.210.30", false, false, 0, 120, 134, "209.235.210.30"},
+			Token{TokenLiteral, FieldUnknown, "]", false, false, 0, 134, 135, "]"},
 		},
 
 		"may  2 19:00:02 dlfssrv sendmail[18980]: taa18980: from user daemon: size is 596, class is 0, priority is 30596, and nrcpts=1, message id is <200305021400.taa18980@dlfssrv.in.ibm.com>, relay=daemon@localhost": Sequence{
-			Token{TokenTime, FieldUnknown, "may  2 19:00:02", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "dlfssrv", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "sendmail", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "[", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "18980", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "]", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "taa18980", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "from", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "user", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "daemon", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "size", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "is", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "596", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ",", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "class", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "is", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "0", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ",", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "priority", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "is", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "30596", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ",", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "and", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "nrcpts", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "1", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, ",", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "message", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "id", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "is", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "<", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "200305021400.taa18980@dlfssrv.in.ibm.com", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ">", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ",", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "relay", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenString, FieldUnknown, "daemon@localhost", false, true, 0},
+			Token{TokenTime, FieldUnknown, "may  2 19:00:02", false, false, 0, 0, 15, "may  2 19:00:02"},
+			Token{TokenLiteral, FieldUnknown, "dlfssrv", false, false, 0, 16, 23, "dlfssrv"},
+			Token{TokenLiteral, FieldUnknown, "sendmail", false, false, 0, 24, 32, "sendmail"},
+			Token{TokenLiteral, FieldUnknown, "[", false, false, 0, 32, 33, "["},
+			Token{TokenInteger, FieldUnknown, "18980", false, false, 0, 33, 38, "18980"},
+			Token{TokenLiteral, FieldUnknown, "]", false, false, 0, 38, 39, "]"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 39, 40, ":"},
+			Token{TokenLiteral, FieldUnknown, "taa18980", false, false, 0, 41, 49, "taa18980"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 49, 50, ":"},
+			Token{TokenLiteral, FieldUnknown, "from", false, false, 0, 51, 55, "from"},
+			Token{TokenLiteral, FieldUnknown, "user", false, false, 0, 56, 60, "user"},
+			Token{TokenLiteral, FieldUnknown, "daemon", false, false, 0, 61, 67, "daemon"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 67, 68, ":"},
+			Token{TokenLiteral, FieldUnknown, "size", false, false, 0, 69, 73, "size"},
+			Token{TokenLiteral, FieldUnknown, "is", false, false, 0, 74, 76, "is"},
+			Token{TokenInteger, FieldUnknown, "596", false, false, 0, 77, 80, "596"},
+			Token{TokenLiteral, FieldUnknown, ",", false, false, 0, 80, 81, ","},
+			Token{TokenLiteral, FieldUnknown, "class", false, false, 0, 82, 87, "class"},
+			Token{TokenLiteral, FieldUnknown, "is", false, false, 0, 88, 90, "is"},
+			Token{TokenInteger, FieldUnknown, "0", false, false, 0, 91, 92, "0"},
+			Token{TokenLiteral, FieldUnknown, ",", false, false, 0, 92, 93, ","},
+			Token{TokenLiteral, FieldUnknown, "priority", false, false, 0, 94, 102, "priority"},
+			Token{TokenLiteral, FieldUnknown, "is", false, false, 0, 103, 105, "is"},
+			Token{TokenInteger, FieldUnknown, "30596", false, false, 0, 106, 111, "30596"},
+			Token{TokenLiteral, FieldUnknown, ",", false, false, 0, 111, 112, ","},
+			Token{TokenLiteral, FieldUnknown, "and", false, false, 0, 113, 116, "and"},
+			Token{TokenLiteral, FieldUnknown, "nrcpts", true, false, 0, 117, 123, "nrcpts"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 123, 124, "="},
+			Token{TokenInteger, FieldUnknown, "1", false, true, 0, 124, 125, "1"},
+			Token{TokenLiteral, FieldUnknown, ",", false, false, 0, 125, 126, ","},
+			Token{TokenLiteral, FieldUnknown, "message", false, false, 0, 127, 134, "message"},
+			Token{TokenLiteral, FieldUnknown, "id", false, false, 0, 135, 137, "id"},
+			Token{TokenLiteral, FieldUnknown, "is", false, false, 0, 138, 140, "is"},
+			Token{TokenLiteral, FieldUnknown, "<", false, false, 0, 141, 142, "<"},
+			Token{TokenLiteral, FieldUnknown, "200305021400.taa18980@dlfssrv.in.ibm.com", false, false, 0, 142, 182, "200305021400.taa18980@dlfssrv.in.ibm.com"},
+			Token{TokenLiteral, FieldUnknown, ">", false, false, 0, 182, 183, ">"},
+			Token{TokenLiteral, FieldUnknown, ",", false, false, 0, 183, 184, ","},
+			Token{TokenLiteral, FieldUnknown, "relay", true, false, 0, 185, 190, "relay"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 190, 191, "="},
+			Token{TokenString, FieldUnknown, "daemon@localhost", false, true, 0, 191, 207, "daemon@localhost"},
 		},
 
 		"mar 01 09:45:02.596 pffbisvr smtp[2424]: 121 statistics: duration=181.14 user=<egreetings@vishwak.com> id=zduqd sent=1440 rcvd=356 srcif=d45f49a2-b30 src=209.235.210.30/61663 cldst=192.216.179.206/25 svsrc=172.17.74.195/8423 dstif=fd3c875c-064 dst=172.17.74.52/25 op=\"to 1 recips\" arg=<vishwakstg1ojte15fo000033b4@vishwakstg1.msn.vishwak.net> result=\"250 m2004030109385301402 message accepted for delivery\" proto=smtp rule=131 (denied access to command 'ehlo vishwakstg1.msn.vishwak.net' from [209.235.210.30])": Sequence{
-			Token{TokenTime, FieldUnknown, "mar 01 09:45:02.596", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "pffbisvr", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "smtp", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "[", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "2424", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "]", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "121", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "statistics", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "duration", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenFloat, FieldUnknown, "181.14", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "user", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "<", false, false, 0},
-			Token{TokenString, FieldUnknown, "egreetings@vishwak.com", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, ">", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "id", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenString, FieldUnknown, "zduqd", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "sent", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "1440", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "rcvd", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "356", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "srcif", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenString, FieldUnknown, "d45f49a2-b30", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "src", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenIPv4, FieldUnknown, "209.235.210.30", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "/", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "61663", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "cldst", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenIPv4, FieldUnknown, "192.216.179.206", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "/", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "25", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "svsrc", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenIPv4, FieldUnknown, "172.17.74.195", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "/", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "8423", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "dstif", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenString, FieldUnknown, "fd3c875c-064", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "dst", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenIPv4, FieldUnknown, "172.17.74.52", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "/", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "25", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "op", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "\"", false, false, 0},
-			Token{TokenString, FieldUnknown, "to 1 recips", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "\"", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "arg", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "<", false, false, 0},
-			Token{TokenString, FieldUnknown, "vishwakstg1ojte15fo000033b4@vishwakstg1.msn.vishwak.net", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, ">", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "result", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "\"", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "250 m2004030109385301402 message accepted for delivery", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "\"", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "proto", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenString, FieldUnknown, "smtp", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "rule", true, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenInteger, FieldUnknown, "131", false, true, 0},
-			Token{TokenLiteral, FieldUnknown, "(", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "denied", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "access", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "to", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "command", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "'", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "ehlo vishwakstg1.msn.vishwak.net", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "'", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "from", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "[", false, false, 0},
-			Token{TokenIPv4, FieldUnknown, "209.235.210.30", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "]", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ")", false, false, 0},
+			Token{TokenTime, FieldUnknown, "mar 01 09:45:02.596", false, false, 0, 0, 19, "mar 01 09:45:02.596"},
+			Token{TokenLiteral, FieldUnknown, "pffbisvr", false, false, 0, 20, 28, "pffbisvr"},
+			Token{TokenLiteral, FieldUnknown, "smtp", false, false, 0, 29, 33, "smtp"},
+			Token{TokenLiteral, FieldUnknown, "[", false, false, 0, 33, 34, "["},
+			Token{TokenInteger, FieldUnknown, "2424", false, false, 0, 34, 38, "2424"},
+			Token{TokenLiteral, FieldUnknown, "]", false, false, 0, 38, 39, "]"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 39, 40, ":"},
+			Token{TokenInteger, FieldUnknown, "121", false, false, 0, 41, 44, "121"},
+			Token{TokenLiteral, FieldUnknown, "statistics", false, false, 0, 45, 55, "statistics"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 55, 56, ":"},
+			Token{TokenLiteral, FieldUnknown, "duration", true, false, 0, 57, 65, "duration"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 65, 66, "="},
+			Token{TokenFloat, FieldUnknown, "181.14", false, true, 0, 66, 72, "181.14"},
+			Token{TokenLiteral, FieldUnknown, "user", true, false, 0, 73, 77, "user"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 77, 78, "="},
+			Token{TokenLiteral, FieldUnknown, "<", false, false, 0, 78, 79, "<"},
+			Token{TokenString, FieldUnknown, "egreetings@vishwak.com", false, true, 0, 79, 101, "egreetings@vishwak.com"},
+			Token{TokenLiteral, FieldUnknown, ">", false, false, 0, 101, 102, ">"},
+			Token{TokenLiteral, FieldUnknown, "id", true, false, 0, 103, 105, "id"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 105, 106, "="},
+			Token{TokenString, FieldUnknown, "zduqd", false, true, 0, 106, 111, "zduqd"},
+			Token{TokenLiteral, FieldUnknown, "sent", true, false, 0, 112, 116, "sent"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 116, 117, "="},
+			Token{TokenInteger, FieldUnknown, "1440", false, true, 0, 117, 121, "1440"},
+			Token{TokenLiteral, FieldUnknown, "rcvd", true, false, 0, 122, 126, "rcvd"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 126, 127, "="},
+			Token{TokenInteger, FieldUnknown, "356", false, true, 0, 127, 130, "356"},
+			Token{TokenLiteral, FieldUnknown, "srcif", true, false, 0, 131, 136, "srcif"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 136, 137, "="},
+			Token{TokenString, FieldUnknown, "d45f49a2-b30", false, true, 0, 137, 149, "d45f49a2-b30"},
+			Token{TokenLiteral, FieldUnknown, "src", true, false, 0, 150, 153, "src"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 153, 154, "="},
+			Token{TokenIPv4, FieldUnknown, "209.235.210.30", false, true, 0, 154, 168, "209.235.210.30"},
+			Token{TokenLiteral, FieldUnknown, "/", false, false, 0, 168, 169, "/"},
+			Token{TokenInteger, FieldUnknown, "61663", false, false, 0, 169, 174, "61663"},
+			Token{TokenLiteral, FieldUnknown, "cldst", true, false, 0, 175, 180, "cldst"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 180, 181, "="},
+			Token{TokenIPv4, FieldUnknown, "192.216.179.206", false, true, 0, 181, 196, "192.216.179.206"},
+			Token{TokenLiteral, FieldUnknown, "/", false, false, 0, 196, 197, "/"},
+			Token{TokenInteger, FieldUnknown, "25", false, false, 0, 197, 199, "25"},
+			Token{TokenLiteral, FieldUnknown, "svsrc", true, false, 0, 200, 205, "svsrc"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 205, 206, "="},
+			Token{TokenIPv4, FieldUnknown, "172.17.74.195", false, true, 0, 206, 219, "172.17.74.195"},
+			Token{TokenLiteral, FieldUnknown, "/", false, false, 0, 219, 220, "/"},
+			Token{TokenInteger, FieldUnknown, "8423", false, false, 0, 220, 224, "8423"},
+			Token{TokenLiteral, FieldUnknown, "dstif", true, false, 0, 225, 230, "dstif"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 230, 231, "="},
+			Token{TokenString, FieldUnknown, "fd3c875c-064", false, true, 0, 231, 243, "fd3c875c-064"},
+			Token{TokenLiteral, FieldUnknown, "dst", true, false, 0, 244, 247, "dst"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 247, 248, "="},
+			Token{TokenIPv4, FieldUnknown, "172.17.74.52", false, true, 0, 248, 260, "172.17.74.52"},
+			Token{TokenLiteral, FieldUnknown, "/", false, false, 0, 260, 261, "/"},
+			Token{TokenInteger, FieldUnknown, "25", false, false, 0, 261, 263, "25"},
+			Token{TokenLiteral, FieldUnknown, "op", true, false, 0, 264, 266, "op"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 266, 267, "="},
+			Token{TokenLiteral, FieldUnknown, "\"", false, false, 0, 267, 268, "\""},
+			Token{TokenString, FieldUnknown, "to 1 recips", false, true, 0, 268, 279, "to 1 recips"},
+			Token{TokenLiteral, FieldUnknown, "\"", false, false, 0, 279, 280, "\""},
+			Token{TokenLiteral, FieldUnknown, "arg", true, false, 0, 281, 284, "arg"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 284, 285, "="},
+			Token{TokenLiteral, FieldUnknown, "<", false, false, 0, 285, 286, "<"},
+			Token{TokenString, FieldUnknown, "vishwakstg1ojte15fo000033b4@vishwakstg1.msn.vishwak.net", false, true, 0, 286, 341, "vishwakstg1ojte15fo000033b4@vishwakstg1.msn.vishwak.net"},
+			Token{TokenLiteral, FieldUnknown, ">", false, false, 0, 341, 342, ">"},
+			Token{TokenLiteral, FieldUnknown, "result", true, false, 0, 343, 349, "result"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 349, 350, "="},
+			Token{TokenLiteral, FieldUnknown, "\"", false, false, 0, 350, 351, "\""},
+			Token{TokenInteger, FieldUnknown, "250 m2004030109385301402 message accepted for delivery", false, true, 0, 351, 405, "250 m2004030109385301402 message accepted for delivery"},
+			Token{TokenLiteral, FieldUnknown, "\"", false, false, 0, 405, 406, "\""},
+			Token{TokenLiteral, FieldUnknown, "proto", true, false, 0, 407, 412, "proto"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 412, 413, "="},
+			Token{TokenString, FieldUnknown, "smtp", false, true, 0, 413, 417, "smtp"},
+			Token{TokenLiteral, FieldUnknown, "rule", true, false, 0, 418, 422, "rule"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 422, 423, "="},
+			Token{TokenInteger, FieldUnknown, "131", false, true, 0, 423, 426, "131"},
+			Token{TokenLiteral, FieldUnknown, "(", false, false, 0, 427, 428, "("},
+			Token{TokenLiteral, FieldUnknown, "denied", false, false, 0, 428, 434, "denied"},
+			Token{TokenLiteral, FieldUnknown, "access", false, false, 0, 435, 441, "access"},
+			Token{TokenLiteral, FieldUnknown, "to", false, false, 0, 442, 444, "to"},
+			Token{TokenLiteral, FieldUnknown, "command", false, false, 0, 445, 452, "command"},
+			Token{TokenLiteral, FieldUnknown, "'", false, false, 0, 453, 454, "'"},
+			Token{TokenLiteral, FieldUnknown, "ehlo vishwakstg1.msn.vishwak.net", false, false, 0, 454, 486, "ehlo vishwakstg1.msn.vishwak.net"},
+			Token{TokenLiteral, FieldUnknown, "'", false, false, 0, 486, 487, "'"},
+			Token{TokenLiteral, FieldUnknown, "from", false, false, 0, 488, 492, "from"},
+			Token{TokenLiteral, FieldUnknown, "[", false, false, 0, 493, 494, "["},
+			Token{TokenIPv4, FieldUnknown, "209.235.210.30", false, false, 0, 494, 508, "209.235.210.30"},
+			Token{TokenLiteral, FieldUnknown, "]", false, false, 0, 508, 509, "]"},
+			Token{TokenLiteral, FieldUnknown, ")", false, false, 0, 509, 510, ")"},
 		},
 
 		"%createtime% %apphost% %appname% : %srcuser% : tty = %string% ; pwd = %string% ; user = %dstuser% ; command = %method-10%": Sequence{
-			Token{TokenTime, FieldCreateTime, "%createtime%", false, false, 0},
-			Token{TokenString, FieldAppHost, "%apphost%", false, false, 0},
-			Token{TokenString, FieldAppName, "%appname%", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenString, FieldSrcUser, "%srcuser%", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ":", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "tty", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenString, FieldUnknown, "%string%", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ";", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "pwd", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenString, FieldUnknown, "%string%", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ";", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "user", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenString, FieldDstUser, "%dstuser%", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, ";", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "command", false, false, 0},
-			Token{TokenLiteral, FieldUnknown, "=", false, false, 0},
-			Token{TokenString, FieldMethod, "%method-10%", false, false, 10},
+			Token{TokenTime, FieldCreateTime, "%createtime%", false, false, 0, 0, 12, "%createtime%"},
+			Token{TokenString, FieldAppHost, "%apphost%", false, false, 0, 13, 22, "%apphost%"},
+			Token{TokenString, FieldAppName, "%appname%", false, false, 0, 23, 32, "%appname%"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 33, 34, ":"},
+			Token{TokenString, FieldSrcUser, "%srcuser%", false, false, 0, 35, 44, "%srcuser%"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 45, 46, ":"},
+			Token{TokenLiteral, FieldUnknown, "tty", false, false, 0, 47, 50, "tty"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 51, 52, "="},
+			Token{TokenString, FieldUnknown, "%string%", false, false, 0, 53, 61, "%string%"},
+			Token{TokenLiteral, FieldUnknown, ";", false, false, 0, 62, 63, ";"},
+			Token{TokenLiteral, FieldUnknown, "pwd", false, false, 0, 64, 67, "pwd"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 68, 69, "="},
+			Token{TokenString, FieldUnknown, "%string%", false, false, 0, 70, 78, "%string%"},
+			Token{TokenLiteral, FieldUnknown, ";", false, false, 0, 79, 80, ";"},
+			Token{TokenLiteral, FieldUnknown, "user", false, false, 0, 81, 85, "user"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 86, 87, "="},
+			Token{TokenString, FieldDstUser, "%dstuser%", false, false, 0, 88, 97, "%dstuser%"},
+			Token{TokenLiteral, FieldUnknown, ";", false, false, 0, 98, 99, ";"},
+			Token{TokenLiteral, FieldUnknown, "command", false, false, 0, 100, 107, "command"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 108, 109, "="},
+			Token{TokenString, FieldMethod, "%method-10%", false, false, 10, 110, 121, "%method-10%"},
 		},
 	}
 )
@@ -553,3 +557,599 @@ func TestMessageScan(t *testing.T) {
 		assert.Equal(t, true, tokens, msg.tokens)
 	}
 }
+
+var (
+	ipv6samples map[string]Sequence = map[string]Sequence{
+		"2001:0db8:0000:0000:0000:ff00:0042:8329": Sequence{
+			Token{TokenIPv6, FieldUnknown, "2001:0db8:0000:0000:0000:ff00:0042:8329", false, false, 0, 0, 39, "2001:0db8:0000:0000:0000:ff00:0042:8329"},
+		},
+		"2001:DB8::8:800:200C:417A port 22": Sequence{
+			Token{TokenIPv6, FieldUnknown, "2001:db8::8:800:200c:417a", false, false, 0, 0, 25, "2001:DB8::8:800:200C:417A"},
+			Token{TokenLiteral, FieldUnknown, "port", false, false, 0, 26, 30, "port"},
+			Token{TokenInteger, FieldUnknown, "22", false, false, 0, 31, 33, "22"},
+		},
+		"from ::1 port 22": Sequence{
+			Token{TokenLiteral, FieldUnknown, "from", false, false, 0, 0, 4, "from"},
+			Token{TokenIPv6, FieldUnknown, "::1", false, false, 0, 5, 8, "::1"},
+			Token{TokenLiteral, FieldUnknown, "port", false, false, 0, 9, 13, "port"},
+			Token{TokenInteger, FieldUnknown, "22", false, false, 0, 14, 16, "22"},
+		},
+		"fe80::21b:21ff:fe4e:4fa5%eth0 fe80::": Sequence{
+			Token{TokenIPv6, FieldUnknown, "fe80::21b:21ff:fe4e:4fa5%eth0", false, false, 0, 0, 29, "fe80::21b:21ff:fe4e:4fa5%eth0"},
+			Token{TokenIPv6, FieldUnknown, "fe80::", false, false, 0, 30, 36, "fe80::"},
+		},
+		"src=::ffff:192.0.2.128 dst=[2001:db8::1]:443": Sequence{
+			Token{TokenLiteral, FieldUnknown, "src", true, false, 0, 0, 3, "src"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 3, 4, "="},
+			Token{TokenIPv6, FieldUnknown, "::ffff:192.0.2.128", false, true, 0, 4, 22, "::ffff:192.0.2.128"},
+			Token{TokenLiteral, FieldUnknown, "dst", true, false, 0, 23, 26, "dst"},
+			Token{TokenLiteral, FieldUnknown, "=", false, false, 0, 26, 27, "="},
+			Token{TokenLiteral, FieldUnknown, "[", false, false, 0, 27, 28, "["},
+			Token{TokenIPv6, FieldUnknown, "2001:db8::1", false, true, 0, 28, 39, "2001:db8::1"},
+			Token{TokenLiteral, FieldUnknown, "]", false, false, 0, 39, 40, "]"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 40, 41, ":"},
+			Token{TokenInteger, FieldUnknown, "443", false, false, 0, 41, 44, "443"},
+		},
+		"route 2001:db8::/32 via fe80::1: ok": Sequence{
+			Token{TokenLiteral, FieldUnknown, "route", false, false, 0, 0, 5, "route"},
+			Token{TokenIPv6, FieldUnknown, "2001:db8::", false, false, 0, 6, 16, "2001:db8::"},
+			Token{TokenLiteral, FieldUnknown, "/", false, false, 0, 16, 17, "/"},
+			Token{TokenInteger, FieldUnknown, "32", false, false, 0, 17, 19, "32"},
+			Token{TokenLiteral, FieldUnknown, "via", false, false, 0, 20, 23, "via"},
+			Token{TokenIPv6, FieldUnknown, "fe80::1", false, false, 0, 24, 31, "fe80::1"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 31, 32, ":"},
+			Token{TokenLiteral, FieldUnknown, "ok", false, false, 0, 33, 35, "ok"},
+		},
+		"smac 00:0b:5f:b2:1d:80 duration 0:09:23 bytes 7999": Sequence{
+			Token{TokenLiteral, FieldUnknown, "smac", false, false, 0, 0, 4, "smac"},
+			Token{TokenMac, FieldUnknown, "00:0b:5f:b2:1d:80", false, false, 0, 5, 22, "00:0b:5f:b2:1d:80"},
+			Token{TokenLiteral, FieldUnknown, "duration", false, false, 0, 23, 31, "duration"},
+			Token{TokenInteger, FieldUnknown, "0", false, false, 0, 32, 33, "0"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 33, 34, ":"},
+			Token{TokenInteger, FieldUnknown, "09", false, false, 0, 34, 36, "09"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 36, 37, ":"},
+			Token{TokenInteger, FieldUnknown, "23", false, false, 0, 37, 39, "23"},
+			Token{TokenLiteral, FieldUnknown, "bytes", false, false, 0, 40, 45, "bytes"},
+			Token{TokenInteger, FieldUnknown, "7999", false, false, 0, 46, 50, "7999"},
+		},
+		"std::vector 1:2100538:17": Sequence{
+			Token{TokenLiteral, FieldUnknown, "std", false, false, 0, 0, 3, "std"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 3, 4, ":"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 4, 5, ":"},
+			Token{TokenLiteral, FieldUnknown, "vector", false, false, 0, 5, 11, "vector"},
+			Token{TokenInteger, FieldUnknown, "1", false, false, 0, 12, 13, "1"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 13, 14, ":"},
+			Token{TokenInteger, FieldUnknown, "2100538", false, false, 0, 14, 21, "2100538"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 21, 22, ":"},
+			Token{TokenInteger, FieldUnknown, "17", false, false, 0, 22, 24, "17"},
+		},
+		"error in Cafe::add called": Sequence{
+			Token{TokenLiteral, FieldUnknown, "error", false, false, 0, 0, 5, "error"},
+			Token{TokenLiteral, FieldUnknown, "in", false, false, 0, 6, 8, "in"},
+			Token{TokenLiteral, FieldUnknown, "cafe", false, false, 0, 9, 13, "Cafe"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 13, 14, ":"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 14, 15, ":"},
+			Token{TokenLiteral, FieldUnknown, "add", false, false, 0, 15, 18, "add"},
+			Token{TokenLiteral, FieldUnknown, "called", false, false, 0, 19, 25, "called"},
+		},
+		"a::b Foo::bar": Sequence{
+			Token{TokenLiteral, FieldUnknown, "a", false, false, 0, 0, 1, "a"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 1, 2, ":"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 2, 3, ":"},
+			Token{TokenLiteral, FieldUnknown, "b", false, false, 0, 3, 4, "b"},
+			Token{TokenLiteral, FieldUnknown, "foo", false, false, 0, 5, 8, "Foo"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 8, 9, ":"},
+			Token{TokenLiteral, FieldUnknown, ":", false, false, 0, 9, 10, ":"},
+			Token{TokenLiteral, FieldUnknown, "bar", false, false, 0, 10, 13, "bar"},
+		},
+	}
+)
+
+func TestMessageScanIPv6(t *testing.T) {
+	msg := &message{}
+
+	for line, tokens := range ipv6samples {
+		msg.data = line
+
+		err := msg.tokenize()
+		assert.NoError(t, true, err)
+		assert.Equal(t, true, tokens, msg.tokens)
+	}
+}
+
+func TestTokenRecognizers(t *testing.T) {
+	tests := []struct {
+		r    TokenRecognizer
+		data string
+		l    int
+	}{
+		{UUIDRecognizer, "123e4567-e89b-12d3-a456-426614174000 ok", 36},
+		{UUIDRecognizer, "123e4567-e89b-12d3-a456-42661417400", 0},
+		{UUIDRecognizer, "123e4567-e89b-12d3-a456-4266141740001", 0},
+		{HashRecognizer, "d41d8cd98f00b204e9800998ecf8427e,", 32},
+		{HashRecognizer, "d41d8cd98f00b204e9800998ecf8427", 0},
+		{EmailRecognizer, "jdoe@example.com> sent", 16},
+		{EmailRecognizer, "jdoe@localhost", 0},
+		{FQDNRecognizer, "www.example.com. next", 15},
+		{FQDNRecognizer, "example.com:22", 11},
+		{FQDNRecognizer, "192.168.1.1", 0},
+		{FQDNRecognizer, "v1.2", 0},
+		{PathRecognizer, "/usr/bin/find, ok", 13},
+		{PathRecognizer, "~/.ssh/id_rsa", 13},
+		{PathRecognizer, "/ ", 0},
+		{HexRecognizer, "0x1f ", 4},
+		{HexRecognizer, "0x1g", 0},
+		{DurationRecognizer, "1h30m ago", 5},
+		{DurationRecognizer, "1.5s", 4},
+		{DurationRecognizer, "150ms", 5},
+		{DurationRecognizer, "15 ms", 0},
+		{DurationRecognizer, "2sec", 0},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, true, tt.l, tt.r.Recognize(tt.data), tt.data)
+	}
+}
+
+func TestRegisterTokenType(t *testing.T) {
+	tokenUUID, err := RegisterTokenType("uuid", UUIDRecognizer)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, "%uuid%", tokenUUID.String())
+	assert.Equal(t, true, tokenUUID, name2TokenType("%uuid%"))
+
+	_, err = RegisterTokenType("%uuid%", UUIDRecognizer)
+	assert.Equal(t, true, ErrTokenTypeExists, err)
+
+	for _, name := range []string{"ipv4", "srcport", "funknown"} {
+		_, err = RegisterTokenType(name, UUIDRecognizer)
+		assert.Equal(t, true, ErrTokenTypeExists, err)
+	}
+
+	_, err = RegisterTokenType("UUID", UUIDRecognizer)
+	assert.Equal(t, true, ErrInvalidTokenType, err)
+
+	_, err = RegisterTokenType("guid", nil)
+	assert.Equal(t, true, ErrInvalidTokenType, err)
+
+	// A field type can't use the name of a token type
+	_, err = RegisterField("uuid", TokenString)
+	assert.Equal(t, true, ErrFieldExists, err)
+
+	// Registered token types can be used by field types
+	sessionID, err := RegisterField("session_id", tokenUUID)
+	assert.NoError(t, true, err)
+
+	msg, err := NewScanner().Scan("session 123e4567-e89b-12d3-a456-426614174000 closed")
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, 3, len(msg))
+	assert.Equal(t, true, tokenUUID, msg[1].Type)
+
+	// A builtin token that's longer than the recognized one wins
+	msg, err = NewScanner().Scan("from 192.168.1.1 port 22")
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, TokenIPv4, msg[1].Type)
+
+	for _, pat := range []string{"session %uuid% closed", "session %session_id% closed"} {
+		seq, err := NewScanner().Scan(pat)
+		assert.NoError(t, true, err)
+		assert.Equal(t, true, pat, seq.String())
+
+		parser := NewParser()
+		assert.NoError(t, true, parser.Add(seq))
+
+		msg, err := NewScanner().Scan("session 123E4567-E89B-12D3-A456-426614174000 closed")
+		assert.NoError(t, true, err)
+
+		res, err := parser.Parse(msg)
+		assert.NoError(t, true, err)
+		assert.Equal(t, true, tokenUUID, res[1].Type)
+
+		if seq[1].Field != FieldUnknown {
+			assert.Equal(t, true, sessionID, res[1].Field)
+		}
+	}
+
+	// The Analyzer adds the registered token types after the fixed nodes
+	seq, err := NewScanner().Scan("session %uuid% closed")
+	assert.NoError(t, true, err)
+
+	analyzer := NewAnalyzer()
+	assert.NoError(t, true, analyzer.Add(seq))
+	assert.NoError(t, true, analyzer.Add(seq))
+	assert.Equal(t, true, minFixedChildren+1, len(analyzer.levels[1]))
+	assert.Equal(t, true, tokenUUID, analyzer.levels[1][minFixedChildren].Type)
+}
+
+// concurrentFields numbers the field types registered by TestRegisterConcurrent, so
+// their names are unique when the test is run more than once.
+var concurrentFields int32
+
+func TestRegisterConcurrent(t *testing.T) {
+	var (
+		failed int32
+		wg     sync.WaitGroup
+	)
+
+	done := make(chan struct{})
+
+	// The types and the fields keep their names while new ones are being registered
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			scanner := NewScanner()
+
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				seq, err := scanner.Scan("%srcipv4% connected from 10.0.0.1")
+				if err != nil || seq[0].Field != FieldSrcIPv4 || seq[3].Type.String() != "%ipv4%" ||
+					FieldSrcIPv4.String() != "%srcipv4%" || FieldSrcIPv4.TokenType() != TokenIPv4 {
+
+					atomic.AddInt32(&failed, 1)
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 8; i++ {
+		name := fmt.Sprintf("concurrent_%d", atomic.AddInt32(&concurrentFields, 1))
+
+		f, err := RegisterField(name, TokenString)
+		assert.NoError(t, true, err)
+		assert.Equal(t, true, "%"+name+"%", f.String())
+		assert.Equal(t, true, f, field2Token(f.String()).Field)
+	}
+
+	close(done)
+	wg.Wait()
+
+	assert.Equal(t, true, int32(0), failed)
+}
+
+func TestScannerTimeFormats(t *testing.T) {
+	data := "17-Oct-2026 12:00:00.123 INFO server started"
+
+	seq, err := NewScanner().Scan(data)
+	assert.NoError(t, true, err)
+	assert.NotEqual(t, true, TokenTime, seq[0].Type)
+
+	est := time.FixedZone("EST", -5*3600)
+
+	scanner, err := NewScannerWithOptions(ScannerOptions{
+		TimeFormats: []string{"02-Jan-2006 15:04:05.000"},
+		Location:    est,
+	})
+	assert.NoError(t, true, err)
+
+	seq, err = scanner.Scan(data)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, TokenTime, seq[0].Type)
+	assert.Equal(t, true, "17-oct-2026 12:00:00.123", seq[0].Value)
+
+	ts, err := scanner.ParseTime(seq[0].Value)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, time.Date(2026, time.October, 17, 17, 0, 0, 123000000, time.UTC), ts.UTC())
+
+	// The builtin formats are still recognized, and use the Location as well
+	ts, err = scanner.ParseTime("2014-03-15 10:00:00")
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, 15, ts.UTC().Hour())
+
+	ts, err = scanner.ParseTime("2014-03-15 10:00:00 +0000")
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, 10, ts.UTC().Hour())
+
+	ts, err = NewScanner().ParseTime("1/2/2006 3:04:05 pm")
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, 15, ts.Hour())
+
+	_, err = NewScanner().ParseTime("17-oct-2026 12:00:00.123")
+	assert.Equal(t, true, ErrUnknownTimeFormat, err)
+
+	for _, f := range []string{"", "timestamp"} {
+		_, err = NewScannerWithOptions(ScannerOptions{TimeFormats: []string{f}})
+		assert.Equal(t, true, ErrInvalidTimeFormat, err, f)
+	}
+
+	// Time stamps without a year are from the year of now, unless that puts them
+	// too far in the future
+	now := time.Date(2027, time.January, 1, 0, 5, 0, 0, time.UTC)
+
+	ts, err = parseTimeAt("dec 31 23:59:58", timeFsmRoot, TimeFormats, defaultEpochWindow, time.UTC, now)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, time.Date(2026, time.December, 31, 23, 59, 58, 0, time.UTC), ts)
+
+	ts, err = parseTimeAt("jan  1 00:04:58", timeFsmRoot, TimeFormats, defaultEpochWindow, time.UTC, now)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, 2027, ts.Year())
+
+	ts, err = parseTimeAt("jan 15 00:00:00", timeFsmRoot, TimeFormats, defaultEpochWindow, time.UTC, now)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, 2027, ts.Year())
+}
+
+func TestScannerExtract(t *testing.T) {
+	est := time.FixedZone("EST", -5*3600)
+
+	scanner, err := NewScannerWithOptions(ScannerOptions{
+		TimeFormats: []string{"02-Jan-2006 15:04:05.000"},
+		Location:    est,
+	})
+	assert.NoError(t, true, err)
+
+	parser := NewParser()
+
+	pat, err := scanner.Scan("%createtime% %string% server started")
+	assert.NoError(t, true, err)
+	assert.NoError(t, true, parser.Add(pat))
+
+	for data, expected := range map[string]time.Time{
+		"12-Oct-2023 10:11:12.123 INFO server started": time.Date(2023, time.October, 12, 15, 11, 12, 123000000, time.UTC),
+		"2023-10-12 10:11:12 INFO server started":      time.Date(2023, time.October, 12, 15, 11, 12, 0, time.UTC),
+	} {
+		seq, err := scanner.Scan(data)
+		assert.NoError(t, true, err)
+
+		seq, err = parser.Parse(seq)
+		assert.NoError(t, true, err)
+
+		ts, ok := scanner.Extract(seq).Get(FieldCreateTime).(time.Time)
+		assert.True(t, true, ok, data)
+		assert.Equal(t, true, expected, ts.UTC(), data)
+	}
+
+	// Sequence.Extract only knows the builtin formats, in UTC
+	seq, err := scanner.Scan("2023-10-12 10:11:12 INFO server started")
+	assert.NoError(t, true, err)
+
+	seq, err = parser.Parse(seq)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, 10, seq.Extract().Get(FieldCreateTime).(time.Time).Hour())
+}
+
+func TestScannerEpochTimes(t *testing.T) {
+	data := "1697040000 1697040000.123 1697040000123 1697040000123456789 ts=1697040000 took 1500 ms"
+
+	seq, err := NewScanner().Scan(data)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, TokenInteger, seq[0].Type)
+	assert.Equal(t, true, TokenFloat, seq[1].Type)
+
+	scanner, err := NewScannerWithOptions(ScannerOptions{EpochTimes: true})
+	assert.NoError(t, true, err)
+
+	seq, err = scanner.Scan(data)
+	assert.NoError(t, true, err)
+
+	expected := []TokenType{TokenTime, TokenTime, TokenTime, TokenTime, TokenLiteral, TokenLiteral, TokenTime, TokenLiteral, TokenInteger, TokenLiteral}
+	assert.Equal(t, true, len(expected), len(seq))
+
+	for i, tt := range expected {
+		assert.Equal(t, true, tt, seq[i].Type, seq[i].Value)
+	}
+
+	assert.True(t, true, seq[6].IsValue)
+
+	times := []time.Time{
+		time.Unix(1697040000, 0),
+		time.Unix(1697040000, 123000000),
+		time.Unix(1697040000, 123000000),
+		time.Unix(1697040000, 123456789),
+	}
+
+	for i, ts := range times {
+		v, err := scanner.ParseTime(seq[i].Value)
+		assert.NoError(t, true, err)
+		assert.Equal(t, true, ts.UTC(), v)
+	}
+
+	// Numbers outside the window are left alone
+	scanner, err = NewScannerWithOptions(ScannerOptions{
+		EpochTimes: true,
+		EpochStart: time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+	})
+	assert.NoError(t, true, err)
+
+	seq, err = scanner.Scan("1697040000 1717200000")
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, TokenInteger, seq[0].Type)
+	assert.Equal(t, true, TokenTime, seq[1].Type)
+
+	_, err = NewScannerWithOptions(ScannerOptions{
+		EpochTimes: true,
+		EpochEnd:   time.Date(1999, time.January, 1, 0, 0, 0, 0, time.UTC),
+	})
+	assert.Equal(t, true, ErrInvalidEpochWindow, err)
+
+	// Epoch times match %createtime% in patterns
+	pat, err := NewScanner().Scan("%createtime% %apphost% started")
+	assert.NoError(t, true, err)
+
+	parser := NewParser()
+	assert.NoError(t, true, parser.Add(pat))
+
+	seq, err = scanner.Scan("1717200000 web01 started")
+	assert.NoError(t, true, err)
+
+	rec, err := parser.ParseRecord(seq)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, time.Unix(1717200000, 0).UTC(), rec.Get(FieldCreateTime))
+}
+
+func TestScannerScanIntoAllocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("allocations are not counted with the race detector")
+	}
+
+	scanner := NewScanner()
+
+	data := "jan 12 06:49:42 irc sshd[7034]: failed password for root from 218.161.81.238 port 4228 ssh2"
+
+	seq, err := scanner.ScanInto(nil, data)
+	assert.NoError(t, true, err)
+
+	expected, err := scanner.Scan(data)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, expected, seq)
+
+	allocs := testing.AllocsPerRun(100, func() {
+		seq, err = scanner.ScanInto(seq, data)
+	})
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, 0.0, allocs)
+
+	// A message that's not in lower case is lowercased once
+	data = "Jan 12 06:49:42 irc sshd[7034]: Failed password for ROOT from 218.161.81.238 port 4228 ssh2"
+
+	allocs = testing.AllocsPerRun(100, func() {
+		seq, err = scanner.ScanInto(seq, data)
+	})
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, 1.0, allocs)
+	assert.Equal(t, true, "root", seq[10].Value)
+	assert.Equal(t, true, "ROOT", seq[10].Original)
+}
+
+func BenchmarkScannerScan(b *testing.B) {
+	scanner := NewScanner()
+	data := "Jan 12 06:49:42 irc sshd[7034]: Failed password for root from 218.161.81.238 port 4228 ssh2"
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := scanner.Scan(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkScannerScanInto(b *testing.B) {
+	scanner := NewScanner()
+	data := "Jan 12 06:49:42 irc sshd[7034]: Failed password for root from 218.161.81.238 port 4228 ssh2"
+
+	var (
+		seq Sequence
+		err error
+	)
+
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if seq, err = scanner.ScanInto(seq, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestScannerJSON(t *testing.T) {
+	data := `{"@timestamp": "2023-10-11T22:14:15.003Z", "level": "WARN", "src": {"ip": "10.1.1.1", "port": 22}, "msg": "Failed login for \"Bob\"", "tags": ["a", "b"], "ok": true}`
+
+	seq, err := NewScanner().Scan(data)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, "@timestamp = %time% level = %string% src.ip = %ipv4% src.port = %integer% msg = %string% tags = %string% ok = %string%", seq.String())
+
+	for i := 0; i < len(seq); i += 3 {
+		assert.Equal(t, true, true, seq[i].IsKey, seq[i].Value)
+		assert.Equal(t, true, true, seq[i+2].IsValue, seq[i+2].Value)
+	}
+
+	assert.Equal(t, true, "2023-10-11t22:14:15.003z", seq[2].Value)
+	assert.Equal(t, true, "warn", seq[5].Value)
+	assert.Equal(t, true, "WARN", seq[5].Original)
+	assert.Equal(t, true, "ip", data[seq[6].Start:seq[6].End])
+	assert.Equal(t, true, "10.1.1.1", data[seq[8].Start:seq[8].End])
+	assert.Equal(t, true, `Failed login for "Bob"`, seq[14].Original)
+	assert.Equal(t, true, `["a", "b"]`, seq[17].Value)
+
+	ts, err := NewScanner().ParseTime(seq[2].Value)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, time.Date(2023, time.October, 11, 22, 14, 15, 3000000, time.UTC), ts)
+
+	// A JSON pattern is scanned into the same tokens as the pattern written as
+	// key = value pairs
+	pat1, err := NewScanner().Scan(`{"ts": "%createtime%", "src": {"ip": "%srcipv4%"}}`)
+	assert.NoError(t, true, err)
+
+	pat2, err := NewScanner().Scan("ts = %createtime% src.ip = %srcipv4%")
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, pat2.String(), pat1.String())
+	assert.Equal(t, true, FieldSrcIPv4, pat1[5].Field)
+
+	// Anything that is not a valid JSON object is scanned as text
+	seq, err = NewScanner().Scan(`{"a": 1`)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, `{ " a " : %integer%`, seq.String())
+
+	// Only JSON whitespace is skipped around the object, other Unicode spaces are
+	// text
+	seq, err = NewScanner().Scan("\t\r\n {\"a\":1}")
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, "a = %integer%", seq.String())
+
+	seq, err = NewScanner().Scan("\u00a0{\"a\":1}")
+	assert.NoError(t, true, err)
+	assert.True(t, true, strings.HasSuffix(seq.String(), `{ " a " : %integer% }`), seq.String())
+}
+
+func TestScannerKeyValue(t *testing.T) {
+	scanner, err := NewScannerWithOptions(ScannerOptions{
+		Separators: []string{"=", ":", "=>"},
+		Quotes:     `"'`,
+		Escape:     '\\',
+	})
+	assert.NoError(t, true, err)
+
+	data := `'user'='John Doe' ip: 10.1.1.1 port=>22 msg="say \"hi\"" host:web1`
+
+	seq, err := scanner.Scan(data)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, `' user ' = ' %string% ' ip : %ipv4% port = > %integer% msg = " %string% " host : %string%`, seq.String())
+
+	keys := map[string]bool{}
+	for _, token := range seq {
+		if token.IsKey {
+			keys[token.Value] = true
+		}
+	}
+
+	assert.Equal(t, true, map[string]bool{"user": true, "ip": true, "port": true, "msg": true, "host": true}, keys)
+	assert.Equal(t, true, "john doe", seq[5].Value)
+	assert.Equal(t, true, `say "hi"`, seq[17].Value)
+	assert.Equal(t, true, `say \"hi\"`, seq[17].Original)
+	assert.Equal(t, true, `say \"hi\"`, data[seq[17].Start:seq[17].End])
+
+	// Quotes can be escaped by doubling them
+	scanner, err = NewScannerWithOptions(ScannerOptions{Escape: '"'})
+	assert.NoError(t, true, err)
+
+	seq, err = scanner.Scan(`msg="say ""hi""" n=1`)
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, `say "hi"`, seq[3].Value)
+	assert.Equal(t, true, "n", seq[5].Value)
+	assert.Equal(t, true, true, seq[5].IsKey)
+
+	// Punctuation is not a key, even if a separator follows it
+	seq, err = scanner.Scan("Jan 12 06:49:42 irc sshd[7034]: Failed password for root")
+	assert.NoError(t, true, err)
+
+	for _, token := range seq {
+		assert.Equal(t, true, false, token.IsKey, token.Value)
+	}
+
+	for _, opts := range []ScannerOptions{
+		{Separators: []string{""}},
+		{Separators: []string{"is"}},
+		{Separators: []string{"%"}},
+		{Quotes: "q"},
+		{Escape: ' '},
+	} {
+		_, err = NewScannerWithOptions(opts)
+		assert.Equal(t, true, ErrInvalidKeyValue, err, opts)
+	}
+}
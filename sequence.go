@@ -26,21 +26,12 @@ type Sequence []Token
 func (this Sequence) String() string {
 	var p string
 
-	for _, token := range this {
-		if token.Field != FieldUnknown {
-			if token.Range == 0 || token.Range == 1 {
-				p += token.Field.String() + " "
-			} else {
-				f := token.Field.String()
-				p += fmt.Sprintf("%s-%d%% ", f[:len(f)-1], token.Range)
-			}
-		} else if token.Type != TokenUnknown && token.Type != TokenLiteral {
-			if token.Range == 0 || token.Range == 1 {
-				p += token.Type.String() + " "
-			} else {
-				f := token.Type.String()
-				p += fmt.Sprintf("%s-%d%% ", f[:len(f)-1], token.Range)
-			}
+	for i, token := range this {
+		if token.Field != FieldUnknown || (token.Type != TokenUnknown && token.Type != TokenLiteral) {
+			p += tokenName(token) + " "
+		} else if isLiteral(token, "?") && i > 0 && isLiteral(this[i-1], "]") {
+			// keep the ]? of optional tokens together
+			p = p[:len(p)-1] + "? "
 		} else if token.Type == TokenLiteral {
 			p += token.Value + " "
 		}
@@ -49,6 +40,40 @@ func (this Sequence) String() string {
 	return strings.TrimSpace(p)
 }
 
+// tokenName returns the name of a field or type token in a pattern, with its range
+// and constraint, e.g., %srcport:0-65535%.
+func tokenName(token Token) string {
+	name := token.Type.String()
+	if token.Field != FieldUnknown {
+		name = token.Field.String()
+	}
+
+	name = rangeName(name, token.Range)
+
+	if c := tokenConstraint(token); c != "" {
+		name = name[:len(name)-1] + ":" + c + "%"
+	}
+
+	return name
+}
+
+// rangeName returns the name of the field or token type with its range, e.g.,
+// %method-10%, %string*% or %reason+%.
+func rangeName(name string, r int) string {
+	switch r {
+	case 0, 1:
+		return name
+
+	case RangeRest:
+		return name[:len(name)-1] + "*%"
+
+	case RangeSpan:
+		return name[:len(name)-1] + "+%"
+	}
+
+	return fmt.Sprintf("%s-%d%%", name[:len(name)-1], r)
+}
+
 // Signature returns a single line string that represents a common pattern for this
 // types of messages, basically stripping any strings or literals from the message.
 func (this Sequence) Signature() string {
@@ -76,3 +101,48 @@ func (this Sequence) LongString() string {
 
 	return str[:len(str)-1]
 }
+
+// Original returns a copy of the sequence where the value of each token is the
+// token as it appears in the message, i.e., before it's lowercased. Tokens that were
+// not scanned from a message keep their values. For example, the following returns
+// the fields extracted from a message with their original case:
+//
+//   seq, err := parser.Parse(msg)
+//   rec := seq.Original().Extract()
+func (this Sequence) Original() Sequence {
+	seq := make(Sequence, len(this))
+
+	for i, token := range this {
+		if token.Original != "" {
+			token.Value = token.Original
+		}
+
+		seq[i] = token
+	}
+
+	return seq
+}
+
+// withoutOffsets returns a copy of the sequence without the offsets and original
+// values of the tokens, since they only mean something for message tokens, not for
+// pattern tokens.
+func (this Sequence) withoutOffsets() Sequence {
+	seq := make(Sequence, len(this))
+
+	for i, token := range this {
+		token.Start, token.End, token.Original = 0, 0, ""
+		seq[i] = token
+	}
+
+	return seq
+}
+
+// withoutTrailer returns the sequence without its %trailer% token, and the trailer,
+// if the sequence was scanned from a multi-line message.
+func (this Sequence) withoutTrailer() (Sequence, *Token) {
+	if n := len(this); n > 0 && this[n-1].Field == FieldTrailer {
+		return this[:n-1], &this[n-1]
+	}
+
+	return this, nil
+}
@@ -0,0 +1,231 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidPriority = errors.New("sequence: invalid syslog priority")
+	ErrEmptyMessage    = errors.New("sequence: empty syslog message")
+	ErrServerClosed    = errors.New("sequence: syslog server closed")
+)
+
+// SyslogMessage is a syslog message decoded from either the RFC 3164 (BSD) format,
+// e.g.,
+//
+//   <34>Oct 11 22:14:15 mymachine su[230]: 'su root' failed for lonvick on /dev/pts/8
+//
+// or the RFC 5424 format, e.g.,
+//
+//   <165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog 1234 ID47 [exampleSDID@32473 iut="3"] An application event log entry
+//
+// Header values that are missing, or are the RFC 5424 nil value "-", are left empty.
+type SyslogMessage struct {
+	// Priority is the PRI value, which is Facility*8 + Severity.
+	Priority int
+	Facility int
+	Severity int
+
+	// Version is the RFC 5424 version, or 0 if the message is in RFC 3164 format.
+	Version int
+
+	Timestamp      string
+	Hostname       string
+	AppName        string
+	ProcID         string
+	MsgID          string
+	StructuredData string
+
+	// Message is the free-form message body after the header, which is usually what
+	// gets scanned and parsed.
+	Message string
+}
+
+// ParseSyslog decodes the syslog message in data. RFC 5424 messages are detected by
+// the version number that immediately follows the PRI. Everything else is decoded
+// as RFC 3164, which is loosely defined, so the decoding is lenient: if the time
+// stamp or the tag is not found, they are considered part of the message body. As
+// recommended by RFC 3164, a message without PRI is given a priority of 13
+// (user.notice).
+func ParseSyslog(data string) (*SyslogMessage, error) {
+	data = strings.TrimRight(data, "\r\n\x00")
+	if len(strings.TrimSpace(data)) == 0 {
+		return nil, ErrEmptyMessage
+	}
+
+	msg := &SyslogMessage{Priority: 13}
+
+	if data[0] == '<' {
+		i := strings.IndexByte(data, '>')
+		if i < 2 || i > 4 {
+			return nil, ErrInvalidPriority
+		}
+
+		pri, err := strconv.Atoi(data[1:i])
+		if err != nil || pri < 0 || pri > 191 {
+			return nil, ErrInvalidPriority
+		}
+
+		msg.Priority = pri
+		data = data[i+1:]
+	}
+
+	msg.Facility, msg.Severity = msg.Priority/8, msg.Priority%8
+
+	if len(data) > 1 && data[0] >= '1' && data[0] <= '9' && (data[1] == ' ' || (len(data) > 2 && data[1] >= '0' && data[1] <= '9' && data[2] == ' ')) {
+		msg.parse5424(data)
+	} else {
+		msg.parse3164(data)
+	}
+
+	return msg, nil
+}
+
+func (this *SyslogMessage) parse5424(data string) {
+	var f string
+
+	f, data = syslogField(data)
+	this.Version, _ = strconv.Atoi(f)
+
+	this.Timestamp, data = syslogField(data)
+	this.Hostname, data = syslogField(data)
+	this.AppName, data = syslogField(data)
+	this.ProcID, data = syslogField(data)
+	this.MsgID, data = syslogField(data)
+
+	// Structured data is either the nil value or one or more [elements], where the
+	// parameter values are quoted and may contain escaped ", ] and \ characters.
+	if strings.HasPrefix(data, "-") {
+		data = data[1:]
+	} else {
+		i := 0
+
+		for i < len(data) && data[i] == '[' {
+			quoted := false
+
+			for i++; i < len(data); i++ {
+				if data[i] == '\\' && quoted {
+					i++
+				} else if data[i] == '"' {
+					quoted = !quoted
+				} else if data[i] == ']' && !quoted {
+					i++
+					break
+				}
+			}
+		}
+
+		if i > len(data) {
+			i = len(data)
+		}
+
+		this.StructuredData, data = data[:i], data[i:]
+	}
+
+	data = strings.TrimPrefix(data, " ")
+
+	// Remove the UTF-8 byte order mark
+	this.Message = strings.TrimPrefix(data, "\ufeff")
+}
+
+func (this *SyslogMessage) parse3164(data string) {
+	// The time stamp is in the form of "Mmm dd hh:mm:ss", where dd is space padded
+	if len(data) > 16 && data[3] == ' ' && data[6] == ' ' && data[9] == ':' && data[12] == ':' && data[15] == ' ' {
+		this.Timestamp, data = data[:15], data[16:]
+
+		// The host name follows the time stamp, unless what follows is the tag
+		if f, rest := syslogField(data); f != "" && !strings.HasSuffix(f, ":") && !strings.Contains(f, "[") {
+			this.Hostname, data = f, rest
+		}
+	}
+
+	// The tag is the app name, optionally followed by [procid], and ends with a ":"
+	tag, rest := syslogField(data)
+
+	if i := strings.IndexByte(tag, ':'); i > 0 && i == len(tag)-1 {
+		tag = tag[:i]
+
+		if j := strings.IndexByte(tag, '['); j > 0 && tag[len(tag)-1] == ']' {
+			this.AppName, this.ProcID = tag[:j], tag[j+1:len(tag)-1]
+		} else {
+			this.AppName = tag
+		}
+
+		data = rest
+	}
+
+	this.Message = data
+}
+
+// Header returns the syslog header as a Sequence, with each of the header values
+// marked with its semantic field type: the priority and severity are FieldPriority
+// and FieldSeverity, the time stamp is FieldCreateTime, the host name is
+// FieldAppHost, the app name is FieldAppName, the procid is FieldSessionID and the
+// msgid is FieldMsgType. Empty header values are not included. The procid and the
+// msgid are only an %integer% if they are numbers, e.g., 7034, since they can be any
+// name, e.g., worker-3 or ID47.
+func (this *SyslogMessage) Header() Sequence {
+	seq := Sequence{
+		Token{Type: TokenInteger, Field: FieldPriority, Value: strconv.Itoa(this.Priority)},
+		Token{Type: TokenInteger, Field: FieldSeverity, Value: strconv.Itoa(this.Severity)},
+	}
+
+	for _, h := range []struct {
+		f FieldType
+		t TokenType
+		v string
+	}{
+		{FieldCreateTime, TokenTime, this.Timestamp},
+		{FieldAppHost, TokenString, this.Hostname},
+		{FieldAppName, TokenString, this.AppName},
+		{FieldSessionID, syslogNameType(this.ProcID), this.ProcID},
+		{FieldMsgType, syslogNameType(this.MsgID), this.MsgID},
+	} {
+		if h.v != "" {
+			seq = append(seq, Token{Type: h.t, Field: h.f, Value: h.v})
+		}
+	}
+
+	return seq
+}
+
+// syslogNameType returns the token type of a header value that is a number or a name.
+func syslogNameType(v string) TokenType {
+	if _, err := strconv.ParseUint(v, 10, 64); err == nil {
+		return TokenInteger
+	}
+
+	return TokenString
+}
+
+// syslogField returns the next space delimited field, and the rest of the data after
+// the space. The RFC 5424 nil value "-" is returned as an empty field.
+func syslogField(data string) (string, string) {
+	i := strings.IndexByte(data, ' ')
+	if i < 0 {
+		i = len(data)
+	}
+
+	f, rest := data[:i], strings.TrimPrefix(data[i:], " ")
+	if f == "-" {
+		f = ""
+	}
+
+	return f, rest
+}
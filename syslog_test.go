@@ -0,0 +1,283 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dataence/assert"
+)
+
+var (
+	syslogSamples map[string]SyslogMessage = map[string]SyslogMessage{
+		"<34>Oct 11 22:14:15 mymachine su[230]: 'su root' failed for lonvick on /dev/pts/8": SyslogMessage{
+			Priority: 34, Facility: 4, Severity: 2, Timestamp: "Oct 11 22:14:15", Hostname: "mymachine",
+			AppName: "su", ProcID: "230", Message: "'su root' failed for lonvick on /dev/pts/8",
+		},
+		"<13>Feb  5 17:32:18 10.0.0.99 Use the BFG!": SyslogMessage{
+			Priority: 13, Facility: 1, Severity: 5, Timestamp: "Feb  5 17:32:18", Hostname: "10.0.0.99",
+			Message: "Use the BFG!",
+		},
+		"<38>Jan 12 06:49:42 sshd[7034]: Failed password for root": SyslogMessage{
+			Priority: 38, Facility: 4, Severity: 6, Timestamp: "Jan 12 06:49:42",
+			AppName: "sshd", ProcID: "7034", Message: "Failed password for root",
+		},
+		"Jan 12 06:49:42 irc sshd[7034]: Failed password for root\n": SyslogMessage{
+			Priority: 13, Facility: 1, Severity: 5, Timestamp: "Jan 12 06:49:42", Hostname: "irc",
+			AppName: "sshd", ProcID: "7034", Message: "Failed password for root",
+		},
+		"<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 [exampleSDID@32473 iut=\"3\" eventSource=\"Application\" eventID=\"1011\"] \ufeffAn application event log entry...": SyslogMessage{
+			Priority: 165, Facility: 20, Severity: 5, Version: 1, Timestamp: "2003-10-11T22:14:15.003Z",
+			Hostname: "mymachine.example.com", AppName: "evntslog", MsgID: "ID47",
+			StructuredData: "[exampleSDID@32473 iut=\"3\" eventSource=\"Application\" eventID=\"1011\"]",
+			Message:        "An application event log entry...",
+		},
+		"<34>1 2003-10-11T22:14:15.003Z mymachine.example.com su 4242 - - 'su root' failed for lonvick on /dev/pts/8": SyslogMessage{
+			Priority: 34, Facility: 4, Severity: 2, Version: 1, Timestamp: "2003-10-11T22:14:15.003Z",
+			Hostname: "mymachine.example.com", AppName: "su", ProcID: "4242",
+			Message: "'su root' failed for lonvick on /dev/pts/8",
+		},
+		"<165>1 2003-10-11T22:14:15.003Z - - - - [a@1 x=\"] \\\"quoted\\\"\"][b@1 y=\"2\"]": SyslogMessage{
+			Priority: 165, Facility: 20, Severity: 5, Version: 1, Timestamp: "2003-10-11T22:14:15.003Z",
+			StructuredData: "[a@1 x=\"] \\\"quoted\\\"\"][b@1 y=\"2\"]",
+		},
+	}
+)
+
+func TestParseSyslog(t *testing.T) {
+	for data, expected := range syslogSamples {
+		msg, err := ParseSyslog(data)
+		assert.NoError(t, true, err)
+		assert.Equal(t, true, expected, *msg, data)
+	}
+
+	for _, data := range []string{"<>Oct 11 22:14:15 mymachine su: x", "<192>Oct 11 22:14:15 mymachine su: x", "<abc>x"} {
+		_, err := ParseSyslog(data)
+		assert.Equal(t, true, ErrInvalidPriority, err, data)
+	}
+
+	_, err := ParseSyslog(" \r\n")
+	assert.Equal(t, true, ErrEmptyMessage, err)
+}
+
+func TestSyslogHeader(t *testing.T) {
+	msg, err := ParseSyslog("<38>Jan 12 06:49:42 irc sshd[7034]: Failed password for root")
+	assert.NoError(t, true, err)
+
+	rec := msg.Header().Extract()
+	assert.Equal(t, true, int64(38), rec.Get(FieldPriority))
+	assert.Equal(t, true, int64(6), rec.Get(FieldSeverity))
+	assert.Equal(t, true, "irc", rec.Get(FieldAppHost))
+	assert.Equal(t, true, "sshd", rec.Get(FieldAppName))
+	assert.Equal(t, true, int64(7034), rec.Get(FieldSessionID))
+	assert.Nil(t, true, rec.Get(FieldMsgType))
+
+	ts, ok := rec.Get(FieldCreateTime).(time.Time)
+	assert.True(t, true, ok)
+	assert.Equal(t, true, 12, ts.Day())
+
+	msg, err = ParseSyslog("<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 - message")
+	assert.NoError(t, true, err)
+
+	rec = msg.Header().Extract()
+	assert.Equal(t, true, "ID47", rec.Get(FieldMsgType))
+	assert.Nil(t, true, rec.Get(FieldSessionID))
+
+	ts, ok = rec.Get(FieldCreateTime).(time.Time)
+	assert.True(t, true, ok)
+	assert.Equal(t, true, 2003, ts.Year())
+
+	// The procid is a string unless it's a number
+	for data, procid := range map[string]string{
+		"<34>Oct 11 22:14:15 mymachine su[worker-3]: 'su root' failed":                 "worker-3",
+		"<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - - - message": "",
+	} {
+		msg, err = ParseSyslog(data)
+		assert.NoError(t, true, err)
+
+		seq := msg.Header()
+		rec = seq.Extract()
+
+		if procid == "" {
+			assert.Nil(t, true, rec.Get(FieldSessionID), data)
+			continue
+		}
+
+		assert.Equal(t, true, procid, rec.Get(FieldSessionID), data)
+
+		for _, token := range seq {
+			if token.Field == FieldSessionID {
+				assert.Equal(t, true, TokenString, token.Type, data)
+			}
+		}
+	}
+
+	// So is the msgid
+	for data, typ := range map[string]TokenType{
+		"<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 - message": TokenString,
+		"<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - 1011 - message": TokenInteger,
+	} {
+		msg, err = ParseSyslog(data)
+		assert.NoError(t, true, err)
+
+		for _, token := range msg.Header() {
+			if token.Field == FieldMsgType {
+				assert.Equal(t, true, typ, token.Type, data)
+			}
+		}
+	}
+
+	msg, err = ParseSyslog("<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - 1011 - message")
+	assert.NoError(t, true, err)
+	assert.Equal(t, true, int64(1011), msg.Header().Extract().Get(FieldMsgType))
+}
+
+// syslogResult is what a test server's handler was called with, so it can be checked
+// on the test goroutine.
+type syslogResult struct {
+	msg *SyslogMessage
+	err error
+}
+
+func TestSyslogServer(t *testing.T) {
+	got := make(chan syslogResult, 10)
+
+	server := NewSyslogServer(func(msg *SyslogMessage, err error) {
+		got <- syslogResult{msg, err}
+	})
+	defer server.Close()
+
+	wait := func(n int) []string {
+		var received []string
+
+		for i := 0; i < n; i++ {
+			select {
+			case r := <-got:
+				assert.NoError(t, true, r.err)
+				received = append(received, fmt.Sprintf("%d %s %s %s", r.msg.Priority, r.msg.Hostname, r.msg.AppName, r.msg.Message))
+
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Timeout waiting for message %d", i)
+			}
+		}
+
+		return received
+	}
+
+	// UDP, each datagram is a message
+	addr, err := server.Listen("udp", "127.0.0.1:0")
+	assert.NoError(t, true, err)
+
+	conn, err := net.Dial("udp", addr.String())
+	assert.NoError(t, true, err)
+	fmt.Fprint(conn, "<34>Oct 11 22:14:15 mymachine su[230]: 'su root' failed")
+	conn.Close()
+
+	assert.Equal(t, true, []string{"34 mymachine su 'su root' failed"}, wait(1))
+
+	// TCP, newline framing followed by octet counting framing
+	addr, err = server.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, true, err)
+
+	conn, err = net.Dial("tcp", addr.String())
+	assert.NoError(t, true, err)
+
+	m := "<165>1 2003-10-11T22:14:15.003Z host2 app2 - - - line\nwith newline"
+	fmt.Fprintf(conn, "<13>Feb  5 17:32:18 host1 app1: first\n%d %s", len(m), m)
+	conn.Close()
+
+	assert.Equal(t, true, []string{"13 host1 app1 first", "165 host2 app2 line\nwith newline"}, wait(2))
+
+	// Unix domain stream socket
+	dir, err := ioutil.TempDir("", "sequence")
+	assert.NoError(t, true, err)
+	defer os.RemoveAll(dir)
+
+	addr, err = server.Listen("unix", filepath.Join(dir, "syslog.sock"))
+	assert.NoError(t, true, err)
+
+	conn, err = net.Dial("unix", addr.String())
+	assert.NoError(t, true, err)
+	fmt.Fprint(conn, "<14>Feb  5 17:32:18 host3 app3: over unix\n")
+	conn.Close()
+
+	assert.Equal(t, true, []string{"14 host3 app3 over unix"}, wait(1))
+
+	_, err = server.Listen("ip", "127.0.0.1")
+	assert.NotNil(t, true, err)
+
+	server.Close()
+
+	_, err = server.Listen("udp", "127.0.0.1:0")
+	assert.Equal(t, true, ErrServerClosed, err)
+}
+
+func TestSyslogServerLongFrame(t *testing.T) {
+	got := make(chan syslogResult, 10)
+
+	server := NewSyslogServer(func(msg *SyslogMessage, err error) {
+		got <- syslogResult{msg, err}
+	})
+	defer server.Close()
+
+	addr, err := server.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, true, err)
+
+	// The server drops the connection once a frame is longer than the maximum, without
+	// waiting for the rest of it
+	for _, frame := range []string{
+		"<34>Oct 11 22:14:15 mymachine su: " + strings.Repeat("a", maxSyslogMessage),
+		strings.Repeat("1", maxSyslogMessage+1),
+	} {
+		conn, err := net.Dial("tcp", addr.String())
+		assert.NoError(t, true, err)
+
+		go fmt.Fprint(conn, frame)
+
+		// The connection is either closed or reset, depending on how much of the frame
+		// the server has read, but it doesn't time out
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		_, err = conn.Read(make([]byte, 1))
+		assert.NotNil(t, true, err)
+
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			t.Fatalf("Connection was not dropped")
+		}
+
+		conn.Close()
+	}
+
+	select {
+	case r := <-got:
+		t.Fatalf("Unexpected message of %d bytes, err=%v", len(r.msg.Message), r.err)
+	default:
+	}
+
+	for _, frame := range []string{
+		strings.Repeat("a", maxSyslogMessage),
+		"1234567890123 <34>",
+	} {
+		_, err := readSyslogFrame(bufio.NewReaderSize(strings.NewReader(frame), maxSyslogMessage))
+		assert.NotNil(t, true, err)
+	}
+}
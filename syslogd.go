@@ -0,0 +1,233 @@
+// Copyright (c) 2014 Dataence, LLC. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sequence
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// SyslogHandler is called for each message received by the SyslogServer. If the
+// message could not be decoded, err is set, and msg.Message contains the raw message.
+// The handler may be called concurrently from multiple connections.
+type SyslogHandler func(msg *SyslogMessage, err error)
+
+// SyslogServer receives syslog messages over UDP, TCP and unix domain sockets, and
+// calls the handler for each of the decoded messages. For datagram sockets, each
+// datagram is a message. For stream sockets, messages are framed either by a newline
+// or by octet counting (RFC 6587), where each message is preceded by its length.
+type SyslogServer struct {
+	handler SyslogHandler
+
+	mu      sync.Mutex
+	closers map[io.Closer]struct{}
+	closed  bool
+	wg      sync.WaitGroup
+}
+
+// maxSyslogMessage is the maximum size of a message that will be received.
+const maxSyslogMessage = 64 * 1024
+
+func NewSyslogServer(handler SyslogHandler) *SyslogServer {
+	return &SyslogServer{
+		handler: handler,
+		closers: make(map[io.Closer]struct{}),
+	}
+}
+
+// Listen starts receiving messages on the address. The network can be one of the
+// datagram networks "udp", "udp4", "udp6" and "unixgram", or one of the stream
+// networks "tcp", "tcp4", "tcp6" and "unix". It returns the address actually being
+// listened on, which is useful if the port in addr is 0.
+func (this *SyslogServer) Listen(network, addr string) (net.Addr, error) {
+	switch network {
+	case "udp", "udp4", "udp6", "unixgram":
+		conn, err := net.ListenPacket(network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		if !this.track(conn) {
+			return nil, ErrServerClosed
+		}
+
+		this.wg.Add(1)
+		go this.servePacket(conn)
+
+		return conn.LocalAddr(), nil
+
+	case "tcp", "tcp4", "tcp6", "unix":
+		l, err := net.Listen(network, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		if !this.track(l) {
+			return nil, ErrServerClosed
+		}
+
+		this.wg.Add(1)
+		go this.serveStream(l)
+
+		return l.Addr(), nil
+	}
+
+	return nil, fmt.Errorf("sequence: unsupported network %q", network)
+}
+
+// Close stops all the listeners, closes all the connections, and waits for all the
+// messages being handled to finish.
+func (this *SyslogServer) Close() error {
+	this.mu.Lock()
+	this.closed = true
+	for c := range this.closers {
+		c.Close()
+	}
+	this.mu.Unlock()
+
+	this.wg.Wait()
+	return nil
+}
+
+// track keeps track of c so it can be closed when the server is closed. It returns
+// false, after closing c, if the server is already closed.
+func (this *SyslogServer) track(c io.Closer) bool {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	if this.closed {
+		c.Close()
+		return false
+	}
+
+	this.closers[c] = struct{}{}
+	return true
+}
+
+func (this *SyslogServer) untrack(c io.Closer) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+
+	delete(this.closers, c)
+	c.Close()
+}
+
+func (this *SyslogServer) servePacket(conn net.PacketConn) {
+	defer this.wg.Done()
+	defer this.untrack(conn)
+
+	buf := make([]byte, maxSyslogMessage)
+
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+
+		this.handle(string(buf[:n]))
+	}
+}
+
+func (this *SyslogServer) serveStream(l net.Listener) {
+	defer this.wg.Done()
+	defer this.untrack(l)
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		if !this.track(conn) {
+			return
+		}
+
+		this.wg.Add(1)
+		go this.serveConn(conn)
+	}
+}
+
+func (this *SyslogServer) serveConn(conn net.Conn) {
+	defer this.wg.Done()
+	defer this.untrack(conn)
+
+	r := bufio.NewReaderSize(conn, maxSyslogMessage)
+
+	for {
+		msg, err := readSyslogFrame(r)
+		if len(msg) > 0 {
+			this.handle(msg)
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (this *SyslogServer) handle(data string) {
+	msg, err := ParseSyslog(data)
+	if err == ErrEmptyMessage {
+		return
+	} else if err != nil {
+		msg = &SyslogMessage{Message: data}
+	}
+
+	this.handler(msg, err)
+}
+
+// readSyslogFrame reads the next message from a stream. If the message starts with a
+// digit, it's framed using octet counting, e.g., "67 <34>Oct 11 22:14:15 ...",
+// otherwise the message ends with a newline. The reader's buffer must be
+// maxSyslogMessage bytes, so a frame that's longer than that returns an error before
+// it's read into memory, and the connection is dropped.
+func readSyslogFrame(r *bufio.Reader) (string, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return "", err
+	}
+
+	if b[0] >= '1' && b[0] <= '9' {
+		l, err := r.ReadSlice(' ')
+		if err == bufio.ErrBufferFull {
+			return "", fmt.Errorf("sequence: invalid syslog message length %q...", l[:10])
+		} else if err != nil {
+			return "", err
+		}
+
+		n, err := strconv.Atoi(string(l[:len(l)-1]))
+		if err != nil || n > maxSyslogMessage {
+			return "", fmt.Errorf("sequence: invalid syslog message length %q", l)
+		}
+
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return "", err
+		}
+
+		return string(buf), nil
+	}
+
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return "", fmt.Errorf("sequence: syslog message too long")
+	}
+
+	return string(line), err
+}
@@ -14,7 +14,12 @@
 
 package sequence
 
-import "bytes"
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"time"
+)
 
 // TimeFormats is a list of commonly seen time formats from log messages
 var TimeFormats []string = []string{
@@ -78,48 +83,159 @@ var (
 	timeFsmRoot *timeNode
 )
 
+// epochWindow is the range of time stamps that are recognized as Unix epoch times.
+type epochWindow struct {
+	start, end time.Time
+}
+
+// defaultEpochWindow is used when the Scanner options don't set a window.
+var defaultEpochWindow = &epochWindow{
+	start: time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC),
+	end:   time.Date(2100, time.January, 1, 0, 0, 0, 0, time.UTC),
+}
+
+// epochUnits are the units of epoch times, in the order they are tried. The
+// windows of the units don't overlap unless the window spans several centuries.
+var epochUnits = []time.Duration{time.Second, time.Millisecond, time.Microsecond, time.Nanosecond}
+
+// time converts v, a Unix epoch time in seconds, milliseconds, microseconds or
+// nanoseconds, with an optional fraction, to a time.Time. It returns false if v is
+// not a number, or if it's not in the window in any of the units.
+func (this *epochWindow) time(v string) (time.Time, bool) {
+	ip, fp := v, ""
+	if i := strings.IndexByte(v, '.'); i >= 0 {
+		ip, fp = v[:i], v[i+1:]
+	}
+
+	if len(ip) == 0 || len(ip) > 19 || len(fp) > 9 || !isDigits(ip) || !isDigits(fp) {
+		return time.Time{}, false
+	}
+
+	n, err := strconv.ParseInt(ip, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	// The fraction in nanoseconds of the unit
+	var frac int64
+	if fp != "" {
+		frac, _ = strconv.ParseInt(fp+strings.Repeat("0", 9-len(fp)), 10, 64)
+	}
+
+	for _, unit := range epochUnits {
+		if unit == time.Nanosecond && frac > 0 {
+			continue
+		}
+
+		perSec := int64(time.Second / unit)
+		t := time.Unix(n/perSec, (n%perSec)*int64(unit)+frac*int64(unit)/int64(time.Second)).UTC()
+
+		if !t.Before(this.start) && !t.After(this.end) {
+			return t, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// futureTimeSkew is how far in the future a time stamp without a year can be before
+// it's assumed to be from the previous year, e.g., a Dec 31 message read in January.
+const futureTimeSkew = 30 * 24 * time.Hour
+
 func init() {
-	timeFsmRoot = buildTimeFSM()
+	timeFsmRoot = buildTimeFSM(TimeFormats)
 }
 
-func buildTimeFSM() *timeNode {
+// buildTimeFSM compiles the time formats into a time FSM. The subtype of each final
+// node is the index of its format in formats.
+func buildTimeFSM(formats []string) *timeNode {
 	root := &timeNode{ntype: timeNodeRoot}
 
-	for i, f := range TimeFormats {
-		buf := bytes.ToLower([]byte(f))
-		parent := root
-
-		for _, b := range buf {
-			t := tnType(rune(b))
-
-			hasChild := false
-			var child *timeNode
-
-			for _, child = range parent.children {
-				if (child.ntype == t && (t != timeNodeLiteral || (t == timeNodeLiteral && child.value == b))) ||
-					(child.ntype == timeNodeDigitOrSpace && (t == timeNodeDigit || t == timeNodeSpace)) {
-					hasChild = true
-					break
-				} else if child.ntype == timeNodeDigit && t == timeNodeDigitOrSpace {
-					child.ntype = timeNodeDigitOrSpace
-					hasChild = true
-					break
-				}
-			}
+	for i, f := range formats {
+		for _, v := range timeFormatVariants(f) {
+			addTimeFormat(root, v, i)
+		}
+	}
+
+	return root
+}
+
+// timeFormatVariants returns the forms a time stamp in the format f can take, as far
+// as the time FSM is concerned. A Z07:00 or Z0700 time zone is either Z or an
+// offset, e.g., +02:00, and the fractional seconds of .999999999 can have from one
+// to nine digits.
+func timeFormatVariants(f string) []string {
+	variants := []string{f}
+
+	for _, zone := range []string{"Z07:00", "Z0700"} {
+		if i := strings.Index(f, zone); i >= 0 {
+			variants = []string{f[:i] + "Z" + f[i+len(zone):], f[:i] + "-" + zone[1:] + f[i+len(zone):]}
+			break
+		}
+	}
+
+	const frac = ".999999999"
+
+	if !strings.Contains(f, frac) {
+		return variants
+	}
+
+	var expanded []string
+
+	for _, v := range variants {
+		i := strings.Index(v, frac)
+
+		for n := 1; n < len(frac); n++ {
+			expanded = append(expanded, v[:i]+frac[:n+1]+v[i+len(frac):])
+		}
+	}
+
+	return expanded
+}
+
+// addTimeFormat adds the time format f, which is the i-th format, to the time FSM.
+func addTimeFormat(root *timeNode, f string, i int) {
+	buf := bytes.ToLower([]byte(f))
+	parent := root
+
+	for _, b := range buf {
+		t := tnType(rune(b))
+
+		hasChild := false
+		var child *timeNode
 
-			if hasChild == false {
-				child = &timeNode{ntype: t, value: b}
-				parent.children = append(parent.children, child)
+		for _, child = range parent.children {
+			if (child.ntype == t && (t != timeNodeLiteral || (t == timeNodeLiteral && child.value == b))) ||
+				(child.ntype == timeNodeDigitOrSpace && (t == timeNodeDigit || t == timeNodeSpace)) {
+				hasChild = true
+				break
+			} else if child.ntype == timeNodeDigit && t == timeNodeDigitOrSpace {
+				child.ntype = timeNodeDigitOrSpace
+				hasChild = true
+				break
 			}
+		}
 
-			parent = child
+		if hasChild == false {
+			child = &timeNode{ntype: t, value: b}
+			parent.children = append(parent.children, child)
 		}
 
-		parent.final = TokenTime
-		parent.subtype = i
+		parent = child
 	}
 
-	return root
+	parent.final = TokenTime
+	parent.subtype = i
 }
 
 func tnType(r rune) timeNodeType {
@@ -140,3 +256,129 @@ func tnType(r rune) timeNodeType {
 
 	return timeNodeLiteral
 }
+
+// timeStep returns the child of cur that accepts r, or nil if there is none.
+func timeStep(r rune, cur *timeNode) *timeNode {
+	t := tnType(r)
+
+	for _, n := range cur.children {
+		if (n.ntype == timeNodeDigitOrSpace && (t == timeNodeDigit || t == timeNodeSpace)) ||
+			(n.ntype == t && (t != timeNodeLiteral || (t == timeNodeLiteral && rune(n.value) == r))) {
+
+			return n
+		}
+	}
+
+	return nil
+}
+
+// timeFormatIndex runs the time FSM over the whole time stamp value v, and returns
+// the index of the format it matched, or -1 if it didn't match any.
+func timeFormatIndex(root *timeNode, v string) int {
+	cur := root
+
+	for _, r := range v {
+		if cur = timeStep(r, cur); cur == nil {
+			return -1
+		}
+	}
+
+	if cur.final != TokenTime {
+		return -1
+	}
+
+	return cur.subtype
+}
+
+// timePrefixLen returns the length of the longest time stamp at the start of data
+// that the time FSM matches, or 0 if data does not start with a time stamp.
+func timePrefixLen(root *timeNode, data string) int {
+	var (
+		cur = root
+		l   int
+	)
+
+	for i, r := range data {
+		if cur = timeStep(r, cur); cur == nil {
+			break
+		}
+
+		if cur.final == TokenTime {
+			l = i + 1
+		}
+	}
+
+	return l
+}
+
+// validTimeFormat returns true if f is a time format that contains at least one
+// time element, and can parse the times it formats.
+func validTimeFormat(f string) bool {
+	ref := time.Date(2006, time.January, 2, 15, 4, 5, 999999999, time.UTC)
+
+	v := ref.Format(f)
+	if v == f {
+		return false
+	}
+
+	_, err := time.Parse(f, v)
+	return err == nil
+}
+
+// parseTime converts the time stamp value v, as returned by the Scanner, to a
+// time.Time by trying each of the TimeFormats. If the matching format does not
+// contain a year, the year is inferred from the current time.
+func parseTime(v string) (time.Time, error) {
+	return parseTimeAt(v, timeFsmRoot, TimeFormats, defaultEpochWindow, time.UTC, time.Now())
+}
+
+// parseTimeAt converts the time stamp value v to a time.Time. Numbers are epoch
+// times in the epoch window. Otherwise the format matched by the time FSM is tried
+// first, then the rest of the formats. Time stamps without a time zone are in loc.
+// If the format does not contain a year, the time stamp is assumed to be from the
+// year of now, unless that puts it more than futureTimeSkew after now, in which
+// case it's from the year before.
+func parseTimeAt(v string, root *timeNode, formats []string, epoch *epochWindow, loc *time.Location, now time.Time) (time.Time, error) {
+	if t, ok := epoch.time(v); ok {
+		return t.In(loc), nil
+	}
+
+	// The Scanner lowercases time stamps, but the time package expects AM and PM
+	// in upper case. Month and day names are matched regardless of case.
+	v = strings.ToUpper(v)
+
+	i := timeFormatIndex(root, strings.ToLower(v))
+
+	for k := -1; k < len(formats); k++ {
+		var f string
+
+		switch {
+		case k == -1 && i >= 0 && i < len(formats):
+			f = formats[i]
+
+		case k >= 0 && k != i:
+			f = formats[k]
+
+		default:
+			continue
+		}
+
+		t, err := time.ParseInLocation(f, v, loc)
+		if err != nil {
+			continue
+		}
+
+		if t.Year() == 0 {
+			now = now.In(t.Location())
+
+			t = time.Date(now.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+			if t.Sub(now) > futureTimeSkew {
+				t = t.AddDate(-1, 0, 0)
+			}
+		}
+
+		return t, nil
+	}
+
+	return time.Time{}, ErrUnknownTimeFormat
+}
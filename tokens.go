@@ -14,7 +14,12 @@
 
 package sequence
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
 
 // Token is a piece of information extracted from a log message. The Scanner will do
 // its best to determine the TokenType which could be a time stamp, IPv4 or IPv6
@@ -38,10 +43,33 @@ type Token struct {
 	IsValue bool
 
 	// Range represents the number of tokens this field should consume. It is only
-	// used if Field is not FieldUnknown.
+	// used if Field is not FieldUnknown. It can also be RangeRest or RangeSpan, for
+	// fields that consume a variable number of tokens.
 	Range int
+
+	// Start and End are the byte offsets of the token in the message it was scanned
+	// from. End is the offset of the first byte after the token.
+	Start, End int
+
+	// Original is the token as it appears in the message, before it's lowercased.
+	Original string
 }
 
+const (
+	// RangeRest is the Range of a %field*% token, which consumes zero or more tokens,
+	// as many as it can. It is meant for the rest of the message, e.g., a command line.
+	RangeRest = -1
+
+	// RangeSpan is the Range of a %field+% token, which consumes one or more tokens,
+	// as few as it can. It stops at the first token that matches the rest of the
+	// pattern, e.g., the next literal.
+	//
+	// The tokens consumed by either kind of span are joined into a single string,
+	// whatever the type of the field is. So the only token type that can be a span
+	// is %string%, e.g., %string*%.
+	RangeSpan = -2
+)
+
 func (this Token) String() string {
 	return fmt.Sprintf("{ Field=%q, Type=%q, Value=%q, IsKey=%t, IsValue=%t, Range=%d }",
 		this.Field, this.Type, this.Value, this.IsKey, this.IsValue, this.Range)
@@ -56,11 +84,20 @@ type (
 )
 
 const (
-	partialMatchWeight = 1
-	fullMatchWeight    = 2
+	partialMatchWeight    = 1
+	fullMatchWeight       = 2
+	constraintMatchWeight = 1
+
+	// maxFieldTypes and maxTokenTypes are the maximum number of field and token
+	// types, including the ones added using RegisterField and RegisterTokenType.
+	maxFieldTypes = 256
+	maxTokenTypes = 64
 
-	numFieldTypes    = int(field__END__) + 1
-	numTokenTypes    = int(token__END__) + 1
+	// numFieldTypes and numTokenTypes are the number of builtin field and token
+	// types. Each level of the analyzer has a fixed node for each of them; the
+	// registered types are added to the end of the level as they are seen.
+	numFieldTypes    = int(field__END__)
+	numTokenTypes    = int(token__END__)
 	numAllTypes      = numFieldTypes + numTokenTypes
 	minFixedChildren = numAllTypes
 )
@@ -70,13 +107,13 @@ const (
 	TokenLiteral                  // Token is a fixed literal
 	TokenTime                     // Token is a timestamp, in the format listed in TimeFormats
 	TokenIPv4                     // Token is an IPv4 address, in the form of a.b.c.d
-	TokenIPv6                     // Token is an IPv6 address, not currently supported
+	TokenIPv6                     // Token is an IPv6 address, in full, compressed (::), zone-scoped or IPv4-mapped form
 	TokenInteger                  // Token is an integer number
 	TokenFloat                    // token is a floating point number
 	TokenURL                      // Token is an URL, in the form of http://... or https://...
 	TokenMac                      // Token is a mac address
 	TokenString                   // Token is a string that reprensents multiple possible values
-	token__END__                  // All token types must be inserted before this one
+	token__END__                  // All builtin token types must be inserted before this one, RegisterTokenType adds the rest
 )
 
 const (
@@ -129,418 +166,260 @@ const (
 	FieldPktsRecv             // The number of packets received
 	FieldPktsSent             // The number of packets sent
 	FieldDuration             // The duration of the session
-	field__END__              // All field types must be inserted before this one
+	FieldTrailer              // The continuation lines of a multi-line message, e.g., a stack trace
+	field__END__              // All builtin field types must be inserted before this one, RegisterField adds the rest
 )
 
+// builtinTokenTypes has the name of each builtin token type, indexed by TokenType.
+var builtinTokenTypes = []tokenType{
+	TokenUnknown: {"%tunknown%", nil},
+	TokenLiteral: {"%literal%", nil},
+	TokenTime:    {"%time%", nil},
+	TokenIPv4:    {"%ipv4%", nil},
+	TokenIPv6:    {"%ipv6%", nil},
+	TokenInteger: {"%integer%", nil},
+	TokenFloat:   {"%float%", nil},
+	TokenURL:     {"%url%", nil},
+	TokenMac:     {"%mac%", nil},
+	TokenString:  {"%string%", nil},
+}
+
+// tokenType is the name of a token type, and its recognizer if it's not builtin.
+type tokenType struct {
+	name       string
+	recognizer TokenRecognizer
+}
+
+// tokenTypes holds the []tokenType of all the token types, indexed by TokenType. The
+// slice is never changed once it's stored. Instead, RegisterTokenType stores a copy
+// with the new token type, so scanning never takes a lock.
+var tokenTypes = newRegistry(builtinTokenTypes)
+
+// loadTokenTypes returns the current token types.
+func loadTokenTypes() []tokenType {
+	return tokenTypes.Load().([]tokenType)
+}
+
 func (this TokenType) String() string {
-	switch this {
-	case TokenUnknown:
-		return "%tunknown%"
-	case TokenLiteral:
-		return "%literal%"
-	case TokenTime:
-		return "%time%"
-	case TokenIPv4:
-		return "%ipv4%"
-	case TokenIPv6:
-		return "%ipv6%"
-	case TokenInteger:
-		return "%integer%"
-	case TokenFloat:
-		return "%float%"
-	case TokenURL:
-		return "%url%"
-	case TokenMac:
-		return "%mac%"
-	case TokenString:
-		return "%string%"
+	tokenTypes := loadTokenTypes()
+
+	if this > TokenUnknown && int(this) < len(tokenTypes) {
+		return tokenTypes[this].name
 	}
 
 	return ""
 }
 
 func name2TokenType(s string) TokenType {
-	switch s {
-	case "%literal%":
-		return TokenLiteral
-	case "%time%":
-		return TokenTime
-	case "%ipv4%":
-		return TokenIPv4
-	case "%ipv6%":
-		return TokenIPv6
-	case "%integer%":
-		return TokenInteger
-	case "%float%":
-		return TokenFloat
-	case "%url%":
-		return TokenURL
-	case "%mac%":
-		return TokenMac
-	case "%string%":
-		return TokenString
+	tokenTypes := loadTokenTypes()
+
+	for i := TokenLiteral; int(i) < len(tokenTypes); i++ {
+		if tokenTypes[i].name == s {
+			return i
+		}
 	}
 
 	return TokenUnknown
 }
 
+// builtinFieldTypes has the name and the token type of the values of each builtin
+// field type, indexed by FieldType.
+var builtinFieldTypes = []fieldType{
+	FieldUnknown:    {"%funknown%", TokenUnknown},
+	FieldMsgType:    {"%msgtype%", TokenInteger},
+	FieldMsgClass:   {"%msgclass%", TokenString},
+	FieldRecvTime:   {"%recvtime%", TokenTime},
+	FieldCreateTime: {"%createtime%", TokenTime},
+	FieldSeverity:   {"%severity%", TokenInteger},
+	FieldPriority:   {"%priority%", TokenInteger},
+	FieldAppHost:    {"%apphost%", TokenString},
+	FieldAppIPv4:    {"%appipv4%", TokenIPv4},
+	FieldAppName:    {"%appname%", TokenString},
+	FieldAppType:    {"%apptype%", TokenString},
+	FieldSrcDomain:  {"%srcdomain%", TokenString},
+	FieldSrcZone:    {"%srczone%", TokenString},
+	FieldSrcHost:    {"%srchost%", TokenString},
+	FieldSrcIPv4:    {"%srcipv4%", TokenIPv4},
+	FieldSrcIPv4NAT: {"%srcipv4nat%", TokenIPv4},
+	FieldSrcIPv6:    {"%srcipv6%", TokenIPv6},
+	FieldSrcPort:    {"%srcport%", TokenInteger},
+	FieldSrcPortNAT: {"%srcportnat%", TokenInteger},
+	FieldSrcMac:     {"%srcmac%", TokenMac},
+	FieldSrcUser:    {"%srcuser%", TokenString},
+	FieldSrcEmail:   {"%srcemail%", TokenString},
+	FieldDstDomain:  {"%dstdomain%", TokenString},
+	FieldDstZone:    {"%dstzone%", TokenString},
+	FieldDstHost:    {"%dsthost%", TokenString},
+	FieldDstIPv4:    {"%dstipv4%", TokenIPv4},
+	FieldDstIPv4NAT: {"%dstipv4nat%", TokenIPv4},
+	FieldDstIPv6:    {"%dstipv6%", TokenIPv6},
+	FieldDstPort:    {"%dstport%", TokenInteger},
+	FieldDstPortNAT: {"%dstportnat%", TokenInteger},
+	FieldDstMac:     {"%dstmac%", TokenMac},
+	FieldDstUser:    {"%dstuser%", TokenString},
+	FieldDstEmail:   {"%dstemail%", TokenString},
+	FieldProtocol:   {"%protocol%", TokenString},
+	FieldInIface:    {"%iniface%", TokenString},
+	FieldOutIface:   {"%outiface%", TokenString},
+	FieldPolicyID:   {"%policyid%", TokenInteger},
+	FieldSessionID:  {"%sessionid%", TokenInteger},
+	FieldObject:     {"%object%", TokenString},
+	FieldAction:     {"%action%", TokenString},
+	FieldMethod:     {"%method%", TokenString},
+	FieldMethodType: {"%methodtype%", TokenString},
+	FieldStatus:     {"%status%", TokenString},
+	FieldReason:     {"%reason%", TokenString},
+	FieldBytesRecv:  {"%bytesrecv%", TokenInteger},
+	FieldBytesSent:  {"%bytessent%", TokenInteger},
+	FieldPktsRecv:   {"%pktsrecv%", TokenInteger},
+	FieldPktsSent:   {"%pktssent%", TokenInteger},
+	FieldDuration:   {"%duration%", TokenString},
+	FieldTrailer:    {"%trailer%", TokenString},
+}
+
+// fieldType is the name and the token type of the values of a field type.
+type fieldType struct {
+	name  string
+	ttype TokenType
+}
+
+// fieldTable is a snapshot of the field types. Once it's stored in fieldTypes,
+// neither the slice nor the map are changed again.
+type fieldTable struct {
+	// types has all the field types, indexed by FieldType
+	types []fieldType
+
+	// names maps the names of the field types to the field types
+	names map[string]FieldType
+}
+
+// fieldTypes holds the current *fieldTable. RegisterField stores a copy with the new
+// field type, so looking up field types never takes a lock.
+var fieldTypes = newRegistry(newFieldTable(builtinFieldTypes))
+
+// registryMu serializes the changes to tokenTypes and fieldTypes, so the names of
+// the new types can be checked against both.
+var registryMu sync.Mutex
+
+// newFieldTable returns a field table with the field types supplied.
+func newFieldTable(types []fieldType) *fieldTable {
+	names := make(map[string]FieldType, len(types))
+
+	for i, f := range types {
+		names[f.name] = FieldType(i)
+	}
+
+	return &fieldTable{types, names}
+}
+
+// loadFieldTypes returns the current field types.
+func loadFieldTypes() *fieldTable {
+	return fieldTypes.Load().(*fieldTable)
+}
+
+// newRegistry returns a registry of types that holds v.
+func newRegistry(v interface{}) *atomic.Value {
+	r := &atomic.Value{}
+	r.Store(v)
+	return r
+}
+
 func (this FieldType) String() string {
-	switch this {
-	case FieldMsgType:
-		return "%msgtype%"
-	case FieldMsgClass:
-		return "%msgclass%"
-	case FieldRecvTime:
-		return "%recvtime%"
-	case FieldCreateTime:
-		return "%createtime%"
-	case FieldSeverity:
-		return "%severity%"
-	case FieldPriority:
-		return "%priority%"
-	case FieldAppHost:
-		return "%apphost%"
-	case FieldAppIPv4:
-		return "%appipv4%"
-	case FieldAppName:
-		return "%appname%"
-	case FieldAppType:
-		return "%apptype%"
-	case FieldSrcDomain:
-		return "%srcdomain%"
-	case FieldSrcZone:
-		return "%srczone%"
-	case FieldSrcHost:
-		return "%srchost%"
-	case FieldSrcIPv4:
-		return "%srcipv4%"
-	case FieldSrcIPv4NAT:
-		return "%srcipv4nat%"
-	case FieldSrcIPv6:
-		return "%srcipv6%"
-	case FieldSrcPort:
-		return "%srcport%"
-	case FieldSrcPortNAT:
-		return "%srcportnat%"
-	case FieldSrcMac:
-		return "%srcmac%"
-	case FieldSrcUser:
-		return "%srcuser%"
-	case FieldSrcEmail:
-		return "%srcemail%"
-	case FieldDstDomain:
-		return "%dstdomain%"
-	case FieldDstZone:
-		return "%dstzone%"
-	case FieldDstHost:
-		return "%dsthost%"
-	case FieldDstIPv4:
-		return "%dstipv4%"
-	case FieldDstIPv4NAT:
-		return "%dstipv4nat%"
-	case FieldDstIPv6:
-		return "%dstipv6%"
-	case FieldDstPort:
-		return "%dstport%"
-	case FieldDstPortNAT:
-		return "%dstportnat%"
-	case FieldDstMac:
-		return "%dstmac%"
-	case FieldDstUser:
-		return "%dstuser%"
-	case FieldDstEmail:
-		return "%dstemail%"
-	case FieldProtocol:
-		return "%protocol%"
-	case FieldInIface:
-		return "%iniface%"
-	case FieldOutIface:
-		return "%outiface%"
-	case FieldPolicyID:
-		return "%policyid%"
-	case FieldSessionID:
-		return "%sessionid%"
-	case FieldObject:
-		return "%object%"
-	case FieldAction:
-		return "%action%"
-	case FieldMethod:
-		return "%method%"
-	case FieldMethodType:
-		return "%methodtype%"
-	case FieldStatus:
-		return "%status%"
-	case FieldReason:
-		return "%reason%"
-	case FieldBytesRecv:
-		return "%bytesrecv%"
-	case FieldBytesSent:
-		return "%bytessent%"
-	case FieldPktsRecv:
-		return "%pktsrecv%"
-	case FieldPktsSent:
-		return "%pktssent%"
-	case FieldDuration:
-		return "%duration%"
+	fieldTypes := loadFieldTypes().types
+
+	if this > FieldUnknown && int(this) < len(fieldTypes) {
+		return fieldTypes[this].name
 	}
 
 	return "%funknown%"
 }
 
-func field2TokenType(s string) TokenType {
-	switch s {
-	case "%msgtype%":
-		return TokenInteger
-	case "%msgclass%":
-		return TokenString
-	case "%recvtime%":
-		return TokenTime
-	case "%createtime%":
-		return TokenTime
-	case "%severity%":
-		return TokenInteger
-	case "%priority%":
-		return TokenInteger
-	case "%apphost%":
-		return TokenString
-	case "%appipv4%":
-		return TokenIPv4
-	case "%appname%":
-		return TokenString
-	case "%apptype%":
-		return TokenString
-	case "%srcdomain%":
-		return TokenString
-	case "%srczone%":
-		return TokenString
-	case "%srchost%":
-		return TokenString
-	case "%srcipv4%":
-		return TokenIPv4
-	case "%srcipv4nat%":
-		return TokenIPv4
-	case "%srcipv6%":
-		return TokenIPv6
-	case "%srcport%":
-		return TokenInteger
-	case "%srcportnat%":
-		return TokenInteger
-	case "%srcmac%":
-		return TokenMac
-	case "%srcuser%":
-		return TokenString
-	case "%srcemail%":
-		return TokenString
-	case "%dstdomain%":
-		return TokenString
-	case "%dstzone%":
-		return TokenString
-	case "%dsthost%":
-		return TokenString
-	case "%dstipv4%":
-		return TokenIPv4
-	case "%dstipv4nat%":
-		return TokenIPv4
-	case "%dstipv6%":
-		return TokenIPv6
-	case "%dstport%":
-		return TokenInteger
-	case "%dstportnat%":
-		return TokenInteger
-	case "%dstmac%":
-		return TokenMac
-	case "%dstuser%":
-		return TokenString
-	case "%dstemail%":
-		return TokenString
-	case "%protocol%":
-		return TokenString
-	case "%iniface%":
-		return TokenString
-	case "%outiface%":
-		return TokenString
-	case "%policyid%":
-		return TokenInteger
-	case "%sessionid%":
-		return TokenInteger
-	case "%object%":
-		return TokenString
-	case "%action%":
-		return TokenString
-	case "%method%":
-		return TokenString
-	case "%methodtype%":
-		return TokenString
-	case "%status%":
-		return TokenString
-	case "%reason%":
-		return TokenString
-	case "%bytesrecv%":
-		return TokenInteger
-	case "%bytessent%":
-		return TokenInteger
-	case "%pktsrecv%":
-		return TokenInteger
-	case "%pktssent%":
-		return TokenInteger
-	case "%duration%":
-		return TokenString
+// TokenType returns the token type of the values of the field type, e.g.,
+// TokenIPv4 for FieldSrcIPv4.
+func (this FieldType) TokenType() TokenType {
+	fieldTypes := loadFieldTypes().types
+
+	if int(this) < len(fieldTypes) {
+		return fieldTypes[this].ttype
 	}
 
 	return TokenUnknown
 }
 
-var fieldTokenMap map[string]*Token = map[string]*Token{
-	"%funknown%":   &Token{TokenUnknown, FieldUnknown, "%funknown%", false, false, 0},
-	"%msgtype%":    &Token{TokenInteger, FieldMsgType, "%msgtype%", false, false, 0},
-	"%msgclass%":   &Token{TokenString, FieldMsgClass, "%msgclass%", false, false, 0},
-	"%recvtime%":   &Token{TokenTime, FieldRecvTime, "%recvtime%", false, false, 0},
-	"%createtime%": &Token{TokenTime, FieldCreateTime, "%createtime%", false, false, 0},
-	"%severity%":   &Token{TokenInteger, FieldSeverity, "%severity%", false, false, 0},
-	"%priority%":   &Token{TokenInteger, FieldPriority, "%priority%", false, false, 0},
-	"%apphost%":    &Token{TokenString, FieldAppHost, "%apphost%", false, false, 0},
-	"%appipv4%":    &Token{TokenIPv4, FieldAppIPv4, "%appipv4%", false, false, 0},
-	"%appname%":    &Token{TokenString, FieldAppName, "%appname%", false, false, 0},
-	"%apptype%":    &Token{TokenString, FieldAppType, "%apptype%", false, false, 0},
-	"%srcdomain%":  &Token{TokenString, FieldSrcDomain, "%srcdomain%", false, false, 0},
-	"%srczone%":    &Token{TokenString, FieldSrcZone, "%srczone%", false, false, 0},
-	"%srchost%":    &Token{TokenString, FieldSrcHost, "%srchost%", false, false, 0},
-	"%srcipv4%":    &Token{TokenIPv4, FieldSrcIPv4, "%srcipv4%", false, false, 0},
-	"%srcipv4nat%": &Token{TokenIPv4, FieldSrcIPv4NAT, "%srcipv4nat%", false, false, 0},
-	"%srcipv6%":    &Token{TokenIPv6, FieldSrcIPv6, "%srcipv6%", false, false, 0},
-	"%srcport%":    &Token{TokenInteger, FieldSrcPort, "%srcport%", false, false, 0},
-	"%srcportnat%": &Token{TokenInteger, FieldSrcPortNAT, "%srcportnat%", false, false, 0},
-	"%srcmac%":     &Token{TokenMac, FieldSrcMac, "%srcmac%", false, false, 0},
-	"%srcuser%":    &Token{TokenString, FieldSrcUser, "%srcuser%", false, false, 0},
-	"%srcemail%":   &Token{TokenString, FieldSrcEmail, "%srcemail%", false, false, 0},
-	"%dstdomain%":  &Token{TokenString, FieldDstDomain, "%dstdomain%", false, false, 0},
-	"%dstzone%":    &Token{TokenString, FieldDstZone, "%dstzone%", false, false, 0},
-	"%dsthost%":    &Token{TokenString, FieldDstHost, "%dsthost%", false, false, 0},
-	"%dstipv4%":    &Token{TokenIPv4, FieldDstIPv4, "%dstipv4%", false, false, 0},
-	"%dstipv4nat%": &Token{TokenIPv4, FieldDstIPv4NAT, "%dstipv4nat%", false, false, 0},
-	"%dstipv6%":    &Token{TokenIPv6, FieldDstIPv6, "%dstipv6%", false, false, 0},
-	"%dstport%":    &Token{TokenInteger, FieldDstPort, "%dstport%", false, false, 0},
-	"%dstportnat%": &Token{TokenInteger, FieldDstPortNAT, "%dstportnat%", false, false, 0},
-	"%dstmac%":     &Token{TokenMac, FieldDstMac, "%dstmac%", false, false, 0},
-	"%dstuser%":    &Token{TokenString, FieldDstUser, "%dstuser%", false, false, 0},
-	"%dstemail%":   &Token{TokenString, FieldDstEmail, "%dstemail%", false, false, 0},
-	"%protocol%":   &Token{TokenString, FieldProtocol, "%protocol%", false, false, 0},
-	"%iniface%":    &Token{TokenString, FieldInIface, "%iniface%", false, false, 0},
-	"%outiface%":   &Token{TokenString, FieldOutIface, "%outiface%", false, false, 0},
-	"%policyid%":   &Token{TokenInteger, FieldPolicyID, "%policyid%", false, false, 0},
-	"%sessionid%":  &Token{TokenInteger, FieldSessionID, "%sessionid%", false, false, 0},
-	"%object%":     &Token{TokenString, FieldObject, "%object%", false, false, 0},
-	"%action%":     &Token{TokenString, FieldAction, "%action%", false, false, 0},
-	"%method%":     &Token{TokenString, FieldMethod, "%method%", false, false, 0},
-	"%methodtype%": &Token{TokenString, FieldMethodType, "%methodtype%", false, false, 0},
-	"%status%":     &Token{TokenString, FieldStatus, "%status%", false, false, 0},
-	"%reason%":     &Token{TokenString, FieldReason, "%reason%", false, false, 0},
-	"%bytesrecv%":  &Token{TokenInteger, FieldBytesRecv, "%bytesrecv%", false, false, 0},
-	"%bytessent%":  &Token{TokenInteger, FieldBytesSent, "%bytessent%", false, false, 0},
-	"%pktsrecv%":   &Token{TokenInteger, FieldPktsRecv, "%pktsrecv%", false, false, 0},
-	"%pktssent%":   &Token{TokenInteger, FieldPktsSent, "%pktssent%", false, false, 0},
-	"%duration%":   &Token{TokenString, FieldDuration, "%duration%", false, false, 0},
+// RegisterField adds a new field type with the name and the token type of its
+// values, so it can be used in patterns like the builtin field types. The name is
+// made up of lowercase letters, digits and underscores, and can be surrounded by %,
+// e.g., "url_path" or "%url_path%". For example:
+//
+//   FieldURLPath, err := sequence.RegisterField("url_path", sequence.TokenString)
+//
+// Field types should be registered before the patterns that use them are scanned,
+// or compiled parsers and saved analyzers that use them are loaded, e.g., in an init
+// function. Registering the same name with the same token type again returns the
+// field type registered before.
+func RegisterField(name string, t TokenType) (FieldType, error) {
+	name = "%" + strings.Trim(name, "%") + "%"
+
+	if !validTypeName(name) || t <= TokenLiteral || t.String() == "" {
+		return FieldUnknown, ErrInvalidField
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if name2TokenType(name) != TokenUnknown || name == FieldUnknown.String() || name == TokenUnknown.String() {
+		return FieldUnknown, ErrFieldExists
+	}
+
+	table := loadFieldTypes()
+
+	if f, ok := table.names[name]; ok {
+		if table.types[f].ttype != t {
+			return FieldUnknown, ErrFieldExists
+		}
+
+		return f, nil
+	}
+
+	if len(table.types) >= maxFieldTypes {
+		return FieldUnknown, ErrTooManyFields
+	}
+
+	f := FieldType(len(table.types))
+	fieldTypes.Store(newFieldTable(append(table.types[:f:f], fieldType{name, t})))
+
+	return f, nil
 }
 
+// validTypeName returns true if the %name% of a field or token type is made up of
+// lowercase letters, digits and underscores.
+func validTypeName(name string) bool {
+	if len(name) <= 2 {
+		return false
+	}
+
+	for _, r := range name[1 : len(name)-1] {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '_' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// field2TokenType returns the token type of the values of the field type name.
+func field2TokenType(s string) TokenType {
+	return field2Token(s).Type
+}
+
+// field2Token returns the token for the field type name, or a token with
+// FieldUnknown if there's no such field type.
 func field2Token(f string) Token {
-	switch f {
-	case "%msgtype%":
-		return Token{TokenInteger, FieldMsgType, "%msgtype%", false, false, 0}
-	case "%msgclass%":
-		return Token{TokenString, FieldMsgClass, "%msgclass%", false, false, 0}
-	case "%recvtime%":
-		return Token{TokenTime, FieldRecvTime, "%recvtime%", false, false, 0}
-	case "%createtime%":
-		return Token{TokenTime, FieldCreateTime, "%createtime%", false, false, 0}
-	case "%severity%":
-		return Token{TokenInteger, FieldSeverity, "%severity%", false, false, 0}
-	case "%priority%":
-		return Token{TokenInteger, FieldPriority, "%priority%", false, false, 0}
-	case "%apphost%":
-		return Token{TokenString, FieldAppHost, "%apphost%", false, false, 0}
-	case "%appipv4%":
-		return Token{TokenIPv4, FieldAppIPv4, "%appipv4%", false, false, 0}
-	case "%appname%":
-		return Token{TokenString, FieldAppName, "%appname%", false, false, 0}
-	case "%apptype%":
-		return Token{TokenString, FieldAppType, "%apptype%", false, false, 0}
-	case "%srcdomain%":
-		return Token{TokenString, FieldSrcDomain, "%srcdomain%", false, false, 0}
-	case "%srczone%":
-		return Token{TokenString, FieldSrcZone, "%srczone%", false, false, 0}
-	case "%srchost%":
-		return Token{TokenString, FieldSrcHost, "%srchost%", false, false, 0}
-	case "%srcipv4%":
-		return Token{TokenIPv4, FieldSrcIPv4, "%srcipv4%", false, false, 0}
-	case "%srcipv4nat%":
-		return Token{TokenIPv4, FieldSrcIPv4NAT, "%srcipv4nat%", false, false, 0}
-	case "%srcipv6%":
-		return Token{TokenIPv6, FieldSrcIPv6, "%srcipv6%", false, false, 0}
-	case "%srcport%":
-		return Token{TokenInteger, FieldSrcPort, "%srcport%", false, false, 0}
-	case "%srcportnat%":
-		return Token{TokenInteger, FieldSrcPortNAT, "%srcportnat%", false, false, 0}
-	case "%srcmac%":
-		return Token{TokenMac, FieldSrcMac, "%srcmac%", false, false, 0}
-	case "%srcuser%":
-		return Token{TokenString, FieldSrcUser, "%srcuser%", false, false, 0}
-	case "%srcemail%":
-		return Token{TokenString, FieldSrcEmail, "%srcemail%", false, false, 0}
-	case "%dstdomain%":
-		return Token{TokenString, FieldDstDomain, "%dstdomain%", false, false, 0}
-	case "%dstzone%":
-		return Token{TokenString, FieldDstZone, "%dstzone%", false, false, 0}
-	case "%dsthost%":
-		return Token{TokenString, FieldDstHost, "%dsthost%", false, false, 0}
-	case "%dstipv4%":
-		return Token{TokenIPv4, FieldDstIPv4, "%dstipv4%", false, false, 0}
-	case "%dstipv4nat%":
-		return Token{TokenIPv4, FieldDstIPv4NAT, "%dstipv4nat%", false, false, 0}
-	case "%dstipv6%":
-		return Token{TokenIPv6, FieldDstIPv6, "%dstipv6%", false, false, 0}
-	case "%dstport%":
-		return Token{TokenInteger, FieldDstPort, "%dstport%", false, false, 0}
-	case "%dstportnat%":
-		return Token{TokenInteger, FieldDstPortNAT, "%dstportnat%", false, false, 0}
-	case "%dstmac%":
-		return Token{TokenMac, FieldDstMac, "%dstmac%", false, false, 0}
-	case "%dstuser%":
-		return Token{TokenString, FieldDstUser, "%dstuser%", false, false, 0}
-	case "%dstemail%":
-		return Token{TokenString, FieldDstEmail, "%dstemail%", false, false, 0}
-	case "%protocol%":
-		return Token{TokenString, FieldProtocol, "%protocol%", false, false, 0}
-	case "%iniface%":
-		return Token{TokenString, FieldInIface, "%iniface%", false, false, 0}
-	case "%outiface%":
-		return Token{TokenString, FieldOutIface, "%outiface%", false, false, 0}
-	case "%policyid%":
-		return Token{TokenInteger, FieldPolicyID, "%policyid%", false, false, 0}
-	case "%sessionid%":
-		return Token{TokenInteger, FieldSessionID, "%sessionid%", false, false, 0}
-	case "%object%":
-		return Token{TokenString, FieldObject, "%object%", false, false, 0}
-	case "%action%":
-		return Token{TokenString, FieldAction, "%action%", false, false, 0}
-	case "%method%":
-		return Token{TokenString, FieldMethod, "%method%", false, false, 0}
-	case "%methodtype%":
-		return Token{TokenString, FieldMethodType, "%methodtype%", false, false, 0}
-	case "%status%":
-		return Token{TokenString, FieldStatus, "%status%", false, false, 0}
-	case "%reason%":
-		return Token{TokenString, FieldReason, "%reason%", false, false, 0}
-	case "%bytesrecv%":
-		return Token{TokenInteger, FieldBytesRecv, "%bytesrecv%", false, false, 0}
-	case "%bytessent%":
-		return Token{TokenInteger, FieldBytesSent, "%bytessent%", false, false, 0}
-	case "%pktsrecv%":
-		return Token{TokenInteger, FieldPktsRecv, "%pktsrecv%", false, false, 0}
-	case "%pktssent%":
-		return Token{TokenInteger, FieldPktsSent, "%pktssent%", false, false, 0}
-	case "%duration%":
-		return Token{TokenString, FieldDuration, "%duration%", false, false, 0}
+	table := loadFieldTypes()
+
+	if i, ok := table.names[f]; ok && i != FieldUnknown {
+		return Token{table.types[i].ttype, i, f, false, false, 0, 0, 0, ""}
 	}
 
-	return Token{TokenUnknown, FieldUnknown, "%funknown%", false, false, 0}
+	return Token{TokenUnknown, FieldUnknown, "%funknown%", false, false, 0, 0, 0, ""}
 }